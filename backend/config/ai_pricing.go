@@ -0,0 +1,19 @@
+package config
+
+// ModelPrice 模型价格，单位为元/百万token
+type ModelPrice struct {
+	Model      string  `json:"model"`      // 模型名称，按前缀匹配（如 gpt-4o-mini 匹配 gpt-4o-mini-2024-07-18）
+	Prompt     float64 `json:"prompt"`     // 输入价格
+	Completion float64 `json:"completion"` // 输出价格
+}
+
+// DefaultModelPrices 内置价格表，按官方公开价格折算，价格变动时通过 AI_PRICE_TABLE 覆盖
+var DefaultModelPrices = []ModelPrice{
+	{Model: "deepseek-chat", Prompt: 2, Completion: 8},
+	{Model: "deepseek-reasoner", Prompt: 4, Completion: 16},
+	{Model: "gpt-4o-mini", Prompt: 1.1, Completion: 4.4},
+	{Model: "gpt-4o", Prompt: 18, Completion: 72},
+	{Model: "gpt-3.5-turbo", Prompt: 3.6, Completion: 10.8},
+	{Model: "text-embedding-3-small", Prompt: 0.15, Completion: 0},
+	{Model: "mock", Prompt: 0, Completion: 0},
+}
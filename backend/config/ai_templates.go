@@ -2,22 +2,26 @@ package config
 
 // AI提示模板配置
 const (
-	// 医疗助手系统提示模板
+	// 医疗助手系统提示模板，变量说明见 services.PromptVariables；
+	// 数据库中没有审核通过的AI代理模板时使用
 	MedicalAssistantSystemPrompt = `你是一位专业的医生，请基于以下患者信息提供专业的建议：
 
 患者信息：
-- 姓名：%s
-- 性别：%s
-- 年龄：%d岁
-- 血型：%s
-- 过敏史：%s
-- 慢性病史：%s
+- 姓名：{{patient_name}}
+- 性别：{{patient_gender}}
+- 年龄：{{patient_age}}岁
+- 血型：{{blood_type}}
+- 过敏史：{{allergies}}
+- 慢性病史：{{chronic_diseases}}
 ---
 诊疗记录：
-%s
+{{medical_records}}
 ---
 随访记录:
-%s
+{{follow_up_records}}
+---
+既往对话摘要：
+{{conversation_summary}}
 ---
 请根据患者的问题和历史对话，给出专业、准确、易懂的建议。
 注意：
@@ -25,24 +29,134 @@ const (
 2. 特别注意患者的过敏史和慢性病史
 3. 使用患者容易理解的语言
 4. 以医生的口吻去回答患者`
+
+	// 结构化输出要求，追加在系统提示之后，%s 为JSON Schema
+	StructuredReplyInstruction = `
+
+---
+请只输出一个JSON对象，不要输出其他内容，格式必须符合以下JSON Schema：
+%s
+字段说明：
+- reply：给患者的完整回复
+- category：建议类别，medication=用药建议，visit=就医建议，lifestyle=生活建议，urgent=紧急建议
+- priority：紧急程度，1=低，2=普通，3=高，4=紧急，5=危急（需要立即就医）
+- confidence：你对该建议的把握程度，0到1之间
+- rationale：给医生看的简短判断依据`
+
+	// 分诊提示，判断患者消息是否包含需要紧急处理的症状
+	TriageSystemPrompt = `你是一位慢病管理中心的分诊护士。请判断患者这条消息描述的情况是否需要医生紧急处理。
+分级标准：
+- critical：可能危及生命，需要立即就医（如胸痛、呼吸困难、意识改变、卒中表现、大出血、严重低血糖、自杀念头）
+- urgent：需要医生尽快（当天）处理（如血压≥180/110、血糖明显异常、晕厥史、剧烈头痛、新发心悸）
+- normal：常规咨询或数据记录
+注意患者否认的症状（如"没有胸痛"）不算。
+请只输出一个JSON对象：{"level": "normal/urgent/critical", "rationale": "简短依据"}`
+
+	// 检索到的诊疗规范片段，追加在系统提示之后（模板中没有引用 {{guidelines}} 时），%s 为片段列表
+	GuidelinesInstruction = `
+---
+以下是与患者问题相关的诊疗规范摘录，回答时请优先依据这些内容，引用时在句末标注编号（如 [1]）；摘录与问题无关时忽略即可：
+%s`
+
+	// 生理指标趋势异常，追加在系统提示之后（模板中没有引用 {{vital_findings}} 时），%s 为异常列表
+	VitalFindingsInstruction = `
+---
+后台检测到患者近期的生理指标趋势异常如下，回复时请结合这些变化，必要时提醒患者复测或调整用药：
+%s`
+
+	// 对话摘要提示，用新增对话增量更新已有摘要
+	ConversationSummaryPrompt = `你负责为慢病管理医生维护患者的长期对话摘要。请在已有摘要的基础上，结合新增的医患对话，输出更新后的完整摘要。
+要求：
+1. 保留已有摘要中仍然有效的信息（医生修正过的内容以摘要为准），删除已经过时的内容
+2. 重点记录：症状变化、用药及依从性、检测数据趋势、生活方式、医生给出的重要建议、患者的顾虑
+3. 使用简洁的条目，总长度不超过500字
+请只输出一个JSON对象：{"summary": "更新后的摘要"}`
+
+	// 生理数据提取提示，%s 依次为可提取的测量类型说明、JSON Schema 和当前时间；
+	// 测量类型说明由 VitalSignType 生成，新增类型不需要修改本提示
+	VitalExtractionPrompt = `你是一个医疗数据分析助手。请从患者的消息中提取所有明确给出数值的测量数据及测量时间。
+可提取的测量类型：
+%s
+要求：
+1. 消息中有多次测量时逐条提取，每条一个读数，不要合并或只保留最新的
+2. 数值换算为上述单位，只提取患者明确给出的数值，不要推测；患者否认或询问的数值不提取
+3. measuredAt 使用YYYY-MM-DD HH:mm:ss格式，注意消息中说明的时间，相对时间（如"昨天早上"）需要按当前时间换算；未说明时间时留空
+4. 没有可提取的数据时返回空数组
+请只输出一个JSON对象，格式必须符合以下JSON Schema：
+%s
+当前时间: %s`
+
+	// 对已生成的回复进行分类（流式输出无法同时输出结构化结果时使用），%s 为JSON Schema
+	SuggestionClassifyPrompt = `你是一位医疗分诊助手。下面给出患者的消息和AI为医生起草的回复，请判断该回复的类别和紧急程度。
+请只输出一个JSON对象，格式必须符合以下JSON Schema：
+%s
+字段说明：
+- category：medication=用药建议，visit=就医建议，lifestyle=生活建议，urgent=紧急建议
+- priority：1=低，2=普通，3=高，4=紧急，5=危急（需要立即就医）
+- confidence：你对判断的把握程度，0到1之间
+- rationale：简短的判断依据`
 )
 
 // AIConfig AI配置选项
 type AIConfig struct {
-	Provider    string  // AI提供商：openai 或 deepseek
-	OpenAIKey   string  // OpenAI API密钥
-	DeepseekKey string  // Deepseek API密钥
-	Model       string  // 使用的模型
-	Temperature float32 // 温度参数
-	MaxTokens   int     // 最大token数
-	TopP        float32 // 采样参数
+	Provider      string  // AI提供商：openai、deepseek、openai_compatible 或 mock
+	OpenAIKey     string  // OpenAI API密钥
+	DeepseekKey   string  // Deepseek API密钥
+	APIKey        string  // OpenAI兼容接口的API密钥
+	BaseURL       string  // OpenAI兼容接口的地址（如本地部署的模型服务）
+	MockScript    string  // mock 提供商的回复脚本路径（为空时使用内置规则）
+	Model         string  // 使用的模型
+	Temperature   float32 // 温度参数
+	MaxTokens     int     // 最大token数
+	ContextTokens int     // 单次请求输入部分（提示、病历和历史对话）的token预算
+	SummaryEvery  int     // 新增多少条消息后更新一次对话摘要
+	TopP          float32 // 采样参数
+	JobWorkers    int     // AI任务并发worker数
+	JobRetries    int     // AI任务最大执行次数（含首次）
+
+	RedactExemptProviders []string // 不做脱敏的供应商（如本地部署的模型），其余供应商一律先脱敏再发送
+
+	FallbackProviders []string // 主供应商不可用时依次尝试的备用供应商，格式为 供应商 或 供应商:模型
+	MaxRetries        int      // 单个供应商失败后的最大重试次数（不含首次）
+	RetryBaseDelayMs  int      // 重试退避的基础间隔（毫秒），每次翻倍并加随机抖动
+	RetryMaxDelayMs   int      // 重试退避的最大间隔（毫秒）
+	AttemptTimeout    int      // 单次请求超时（秒）
+	CallTimeout       int      // 生成回复和摘要的总超时（秒），包含重试和切换备用供应商
+	BreakerFailures   int      // 连续失败多少次后熔断该供应商
+	BreakerCooldown   int      // 熔断后多久（秒）放行一次试探请求
+
+	Embedder       string  // 诊疗规范检索使用的嵌入方式：hashing（本地，默认）、openai 或 openai_compatible
+	EmbeddingModel string  // 远程嵌入模型名称
+	RAGTopK        int     // 每次回复检索的规范片段数量，0 表示不检索
+	RAGMinScore    float64 // 片段的最低相似度
+
+	PriceTable string // 模型价格表文件（JSON），为空时使用内置价格
+
+	VitalSignTable string // 可提取的测量类型定义文件（JSON），为空时使用内置类型
 }
 
 // 默认AI配置
 var DefaultAIConfig = AIConfig{
-	Provider:    "deepseek",
-	Model:       "deepseek-chat",
-	Temperature: 0.7,
-	MaxTokens:   2000,
-	TopP:        1.0,
+	Provider:      "deepseek",
+	Model:         "deepseek-chat",
+	Temperature:   0.7,
+	MaxTokens:     2000,
+	ContextTokens: 6000,
+	SummaryEvery:  10,
+	TopP:          1.0,
+	JobWorkers:    4,
+	JobRetries:    3,
+
+	MaxRetries:       2,
+	RetryBaseDelayMs: 500,
+	RetryMaxDelayMs:  8000,
+	AttemptTimeout:   30,
+	CallTimeout:      120,
+	BreakerFailures:  5,
+	BreakerCooldown:  60,
+
+	Embedder:       "hashing",
+	EmbeddingModel: "text-embedding-3-small",
+	RAGTopK:        3,
+	RAGMinScore:    0.2,
 }
@@ -3,13 +3,16 @@ package config
 import (
 	"log"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
 
 type Config struct {
-	DB DatabaseConfig
-	AI AIConfig
+	DB    DatabaseConfig
+	AI    AIConfig
+	Vital VitalAnomalyConfig
 }
 
 type DatabaseConfig struct {
@@ -25,7 +28,7 @@ var GlobalConfig Config
 func Init() {
 	// 添加更详细的日志
 	log.Printf("开始加载配置...")
-	
+
 	// 尝试加载 .env 文件
 	err := godotenv.Load()
 	if err != nil {
@@ -50,13 +53,51 @@ func Init() {
 			Name:     getEnvOrDefault("DB_NAME", "wedear"),
 		},
 		AI: AIConfig{
-			Provider:    getEnvOrDefault("AI_PROVIDER", DefaultAIConfig.Provider),
-			OpenAIKey:   getEnvOrDefault("OPENAI_API_KEY", ""),
-			DeepseekKey: getEnvOrDefault("DEEPSEEK_API_KEY", ""),
-			Model:       getEnvOrDefault("AI_MODEL", DefaultAIConfig.Model),
-			Temperature: DefaultAIConfig.Temperature,
-			MaxTokens:   DefaultAIConfig.MaxTokens,
-			TopP:        DefaultAIConfig.TopP,
+			Provider:      getEnvOrDefault("AI_PROVIDER", DefaultAIConfig.Provider),
+			OpenAIKey:     getEnvOrDefault("OPENAI_API_KEY", ""),
+			DeepseekKey:   getEnvOrDefault("DEEPSEEK_API_KEY", ""),
+			APIKey:        getEnvOrDefault("AI_API_KEY", ""),
+			BaseURL:       getEnvOrDefault("AI_BASE_URL", ""),
+			MockScript:    getEnvOrDefault("AI_MOCK_SCRIPT", ""),
+			Model:         getEnvOrDefault("AI_MODEL", DefaultAIConfig.Model),
+			Temperature:   DefaultAIConfig.Temperature,
+			MaxTokens:     DefaultAIConfig.MaxTokens,
+			ContextTokens: getEnvIntOrDefault("AI_CONTEXT_TOKENS", DefaultAIConfig.ContextTokens),
+			SummaryEvery:  getEnvIntOrDefault("AI_SUMMARY_EVERY", DefaultAIConfig.SummaryEvery),
+			TopP:          DefaultAIConfig.TopP,
+			JobWorkers:    getEnvIntOrDefault("AI_JOB_WORKERS", DefaultAIConfig.JobWorkers),
+			JobRetries:    getEnvIntOrDefault("AI_JOB_RETRIES", DefaultAIConfig.JobRetries),
+
+			RedactExemptProviders: getEnvListOrDefault("AI_REDACT_EXEMPT_PROVIDERS", nil),
+
+			FallbackProviders: getEnvListOrDefault("AI_FALLBACK_PROVIDERS", nil),
+			MaxRetries:        getEnvIntOrDefault("AI_MAX_RETRIES", DefaultAIConfig.MaxRetries),
+			RetryBaseDelayMs:  getEnvIntOrDefault("AI_RETRY_BASE_DELAY_MS", DefaultAIConfig.RetryBaseDelayMs),
+			RetryMaxDelayMs:   getEnvIntOrDefault("AI_RETRY_MAX_DELAY_MS", DefaultAIConfig.RetryMaxDelayMs),
+			AttemptTimeout:    getEnvIntOrDefault("AI_ATTEMPT_TIMEOUT", DefaultAIConfig.AttemptTimeout),
+			CallTimeout:       getEnvIntOrDefault("AI_CALL_TIMEOUT", DefaultAIConfig.CallTimeout),
+			BreakerFailures:   getEnvIntOrDefault("AI_BREAKER_FAILURES", DefaultAIConfig.BreakerFailures),
+			BreakerCooldown:   getEnvIntOrDefault("AI_BREAKER_COOLDOWN", DefaultAIConfig.BreakerCooldown),
+
+			Embedder:       getEnvOrDefault("AI_EMBEDDER", DefaultAIConfig.Embedder),
+			EmbeddingModel: getEnvOrDefault("AI_EMBEDDING_MODEL", DefaultAIConfig.EmbeddingModel),
+			RAGTopK:        getEnvIntOrDefault("AI_RAG_TOP_K", DefaultAIConfig.RAGTopK),
+			RAGMinScore:    getEnvFloatOrDefault("AI_RAG_MIN_SCORE", DefaultAIConfig.RAGMinScore),
+
+			PriceTable: getEnvOrDefault("AI_PRICE_TABLE", ""),
+
+			VitalSignTable: getEnvOrDefault("AI_VITAL_SIGN_TABLE", ""),
+		},
+		Vital: VitalAnomalyConfig{
+			Interval:       getEnvIntOrDefault("VITAL_ANOMALY_INTERVAL", DefaultVitalAnomalyConfig.Interval),
+			BaselineDays:   getEnvIntOrDefault("VITAL_BASELINE_DAYS", DefaultVitalAnomalyConfig.BaselineDays),
+			RecentDays:     getEnvIntOrDefault("VITAL_RECENT_DAYS", DefaultVitalAnomalyConfig.RecentDays),
+			MinReadings:    DefaultVitalAnomalyConfig.MinReadings,
+			DriftPercent:   getEnvFloatOrDefault("VITAL_DRIFT_PERCENT", DefaultVitalAnomalyConfig.DriftPercent),
+			JumpPercent:    getEnvFloatOrDefault("VITAL_JUMP_PERCENT", DefaultVitalAnomalyConfig.JumpPercent),
+			JumpDeviations: DefaultVitalAnomalyConfig.JumpDeviations,
+			GapFactor:      getEnvFloatOrDefault("VITAL_GAP_FACTOR", DefaultVitalAnomalyConfig.GapFactor),
+			MinGapDays:     DefaultVitalAnomalyConfig.MinGapDays,
 		},
 	}
 
@@ -73,6 +114,9 @@ func Init() {
 	if GlobalConfig.AI.Provider == "deepseek" && GlobalConfig.AI.DeepseekKey == "" {
 		panic("DEEPSEEK_API_KEY environment variable is not set")
 	}
+	if GlobalConfig.AI.Provider == "openai_compatible" && GlobalConfig.AI.BaseURL == "" {
+		panic("AI_BASE_URL environment variable is not set")
+	}
 }
 
 func getEnvOrDefault(key, defaultValue string) string {
@@ -81,3 +125,37 @@ func getEnvOrDefault(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvIntOrDefault(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.Atoi(value); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: invalid %s=%q, using default %d", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvFloatOrDefault(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+			return parsed
+		}
+		log.Printf("Warning: invalid %s=%q, using default %g", key, value, defaultValue)
+	}
+	return defaultValue
+}
+
+func getEnvListOrDefault(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
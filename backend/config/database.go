@@ -47,11 +47,26 @@ func InitDB() {
 	sqlDB.SetMaxOpenConns(100)
 	sqlDB.SetConnMaxLifetime(time.Hour)
 
+	// 生理数据增加确认状态前AI提取的数据都未经医生确认，迁移后需要改为待确认
+	backfillExtracted := DB.Migrator().HasTable(&models.PhysiologicalData{}) &&
+		!DB.Migrator().HasColumn(&models.PhysiologicalData{}, "Status")
+
 	// 自动迁移数据库结构
 	err = DB.AutoMigrate(
 		&models.Patient{},
 		&models.Message{},
 		&models.AISuggestion{},
+		&models.AIJob{},
+		&models.TriageDecision{},
+		&models.Escalation{},
+		&models.AICallLog{},
+		&models.AIUsageDaily{},
+		&models.AIBudget{},
+		&models.ConversationSummary{},
+		&models.SuggestionCitation{},
+		&models.SuggestionSafetyWarning{},
+		&models.GuidelineDocument{},
+		&models.GuidelineChunk{},
 		&models.MedicalRecord{},
 		&models.Doctor{},
 		&models.Department{},
@@ -61,10 +76,27 @@ func InitDB() {
 		&models.AIAgentTemplate{},
 		&models.FollowUpTemplate{},
 		&models.PhysiologicalData{},
+		&models.VitalTarget{},
+		&models.VitalAlert{},
+		&models.VitalFinding{},
+		&models.Device{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
 
+	if backfillExtracted {
+		result := DB.Model(&models.PhysiologicalData{}).
+			Where("source = ?", models.PhysiologicalSourceAIExtract).
+			Updates(map[string]interface{}{
+				"status":          models.PhysiologicalStatusPending,
+				"extracted_value": gorm.Expr("value"),
+			})
+		if result.Error != nil {
+			log.Fatalf("Failed to backfill physiological data status: %v", result.Error)
+		}
+		fmt.Printf("Marked %d AI extracted physiological records as pending\n", result.RowsAffected)
+	}
+
 	fmt.Println("Database migration completed")
 }
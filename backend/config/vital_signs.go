@@ -0,0 +1,137 @@
+package config
+
+// VitalField 测量值中的一个数值字段
+type VitalField struct {
+	Name     string  `json:"name"`     // 字段名，如 systolic
+	Label    string  `json:"label"`    // 中文名称
+	Integer  bool    `json:"integer"`  // 是否为整数
+	Decimals int     `json:"decimals"` // 保存时保留的小数位数（非整数字段）
+	Min      float64 `json:"min"`      // 合理范围下限，超出范围的读数视为提取错误
+	Max      float64 `json:"max"`      // 合理范围上限
+
+	Target   *VitalRange `json:"target,omitempty"`   // 默认目标范围，用于统计达标率和提醒，没有公认目标的字段为空
+	Critical *VitalRange `json:"critical,omitempty"` // 默认危急范围，超出时提醒为危急
+}
+
+// VitalRange 数值范围，包含两端
+type VitalRange struct {
+	Low  float64 `json:"low"`
+	High float64 `json:"high"`
+}
+
+// VitalSignType 一种可从聊天记录中提取的测量类型
+type VitalSignType struct {
+	Type     string       `json:"type"`               // 数据类型，对应 PhysiologicalData.Type
+	Name     string       `json:"name"`               // 中文名称
+	Unit     string       `json:"unit"`               // 单位
+	Fields   []VitalField `json:"fields"`             // 数值字段，多个字段保存时用 / 连接（如血压 138/88）
+	Contexts []string     `json:"contexts,omitempty"` // 测量场景可选值（如空腹/餐后），第一个为默认值
+	Hint     string       `json:"hint,omitempty"`     // 给模型的补充说明，如单位换算
+}
+
+// DefaultVitalSignTypes 内置的测量类型，新增类型或调整合理范围时通过 AI_VITAL_SIGN_TABLE 覆盖
+var DefaultVitalSignTypes = []VitalSignType{
+	{
+		Type: "blood_pressure", Name: "血压", Unit: "mmHg",
+		Fields: []VitalField{
+			{Name: "systolic", Label: "收缩压", Integer: true, Min: 50, Max: 260, Target: &VitalRange{90, 139}, Critical: &VitalRange{80, 179}},
+			{Name: "diastolic", Label: "舒张压", Integer: true, Min: 30, Max: 160, Target: &VitalRange{60, 89}, Critical: &VitalRange{40, 109}},
+		},
+	},
+	{
+		Type: "blood_sugar", Name: "血糖", Unit: "mmol/L",
+		Fields: []VitalField{
+			{Name: "value", Label: "血糖值", Decimals: 1, Min: 1, Max: 35, Target: &VitalRange{3.9, 10}, Critical: &VitalRange{3, 16.7}},
+		},
+		Contexts: []string{"随机", "空腹", "餐后"},
+		Hint:     "单位为mg/dL时除以18换算",
+	},
+	{
+		Type: "weight", Name: "体重", Unit: "kg",
+		Fields: []VitalField{
+			{Name: "value", Label: "体重", Decimals: 1, Min: 2, Max: 300},
+		},
+		Hint: "单位为斤时除以2换算",
+	},
+	{
+		Type: "heart_rate", Name: "心率", Unit: "次/分",
+		Fields: []VitalField{
+			{Name: "value", Label: "心率", Integer: true, Min: 25, Max: 250, Target: &VitalRange{60, 100}, Critical: &VitalRange{40, 130}},
+		},
+		Hint: "脉搏也记为心率",
+	},
+	{
+		Type: "blood_oxygen", Name: "血氧饱和度", Unit: "%",
+		Fields: []VitalField{
+			{Name: "value", Label: "SpO2", Integer: true, Min: 50, Max: 100, Target: &VitalRange{95, 100}, Critical: &VitalRange{90, 100}},
+		},
+	},
+	{
+		Type: "temperature", Name: "体温", Unit: "℃",
+		Fields: []VitalField{
+			{Name: "value", Label: "体温", Decimals: 1, Min: 34, Max: 43, Target: &VitalRange{36, 37.3}, Critical: &VitalRange{35, 39.5}},
+		},
+	},
+	{
+		Type: "hba1c", Name: "糖化血红蛋白", Unit: "%",
+		Fields: []VitalField{
+			{Name: "value", Label: "HbA1c", Decimals: 1, Min: 3, Max: 20, Target: &VitalRange{4, 7}},
+		},
+	},
+	{
+		Type: "steps", Name: "步数", Unit: "步",
+		Fields: []VitalField{
+			{Name: "value", Label: "步数", Integer: true, Min: 0, Max: 100000},
+		},
+		Hint: "一天的总步数",
+	},
+}
+
+// VitalTargetProtocol 按慢性病设定的目标范围，患者慢性病史包含 Disease 时代替测量类型的默认范围
+type VitalTargetProtocol struct {
+	Disease  string      `json:"disease"`            // 病种，按包含关系匹配患者慢性病史
+	Type     string      `json:"type"`               // 数据类型
+	Context  string      `json:"context,omitempty"`  // 测量场景，为空表示不区分
+	Field    string      `json:"field"`              // 数值字段
+	Target   VitalRange  `json:"target"`             // 目标范围
+	Critical *VitalRange `json:"critical,omitempty"` // 危急范围
+}
+
+// DefaultVitalTargetProtocols 内置的慢病目标范围，参考高血压和2型糖尿病防治指南；
+// 同一指标匹配多条时使用靠前的一条，因此合并症的更严格目标放在前面
+var DefaultVitalTargetProtocols = []VitalTargetProtocol{
+	// 糖尿病患者（包括合并高血压）血压控制目标 <130/80
+	{Disease: "糖尿病", Type: "blood_pressure", Field: "systolic", Target: VitalRange{90, 129}, Critical: &VitalRange{80, 179}},
+	{Disease: "糖尿病", Type: "blood_pressure", Field: "diastolic", Target: VitalRange{60, 79}, Critical: &VitalRange{40, 109}},
+	{Disease: "高血压", Type: "blood_pressure", Field: "systolic", Target: VitalRange{90, 139}, Critical: &VitalRange{80, 179}},
+	{Disease: "高血压", Type: "blood_pressure", Field: "diastolic", Target: VitalRange{60, 89}, Critical: &VitalRange{40, 109}},
+	{Disease: "糖尿病", Type: "blood_sugar", Context: "空腹", Field: "value", Target: VitalRange{4.4, 7}, Critical: &VitalRange{3, 16.7}},
+	{Disease: "糖尿病", Type: "blood_sugar", Field: "value", Target: VitalRange{4.4, 10}, Critical: &VitalRange{3, 16.7}},
+	{Disease: "糖尿病", Type: "hba1c", Field: "value", Target: VitalRange{4, 7}},
+}
+
+// VitalAnomalyConfig 生理指标趋势异常检测参数
+type VitalAnomalyConfig struct {
+	Interval       int     // 后台检测间隔（分钟），0 表示不启动后台检测
+	BaselineDays   int     // 基线窗口天数，基线取近期窗口之前这段时间的读数
+	RecentDays     int     // 近期窗口天数
+	MinReadings    int     // 基线和近期窗口各自至少需要的读数数量
+	DriftPercent   float64 // 近期均值偏离基线均值的百分比达到该值视为持续漂移
+	JumpPercent    float64 // 单次读数偏离基线均值的百分比达到该值视为突变
+	JumpDeviations float64 // 突变同时需要偏离基线均值的标准差倍数
+	GapFactor      float64 // 距上次测量超过平时测量间隔的倍数视为中断
+	MinGapDays     int     // 测量中断的最短天数，避免每天多次测量的患者隔天未测就提示
+}
+
+// DefaultVitalAnomalyConfig 默认检测参数
+var DefaultVitalAnomalyConfig = VitalAnomalyConfig{
+	Interval:       60,
+	BaselineDays:   28,
+	RecentDays:     7,
+	MinReadings:    3,
+	DriftPercent:   10,
+	JumpPercent:    20,
+	JumpDeviations: 3,
+	GapFactor:      3,
+	MinGapDays:     3,
+}
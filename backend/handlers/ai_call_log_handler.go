@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"we-dear/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 调用日志单次查询的默认和最大条数
+const (
+	defaultAICallLogLimit = 100
+	maxAICallLogLimit     = 500
+)
+
+// GetAICallLogs 查询AI调用日志（仅管理员），可按患者、消息、用途和时间范围筛选
+func GetAICallLogs(c *gin.Context) {
+	filter := storage.AICallLogFilter{
+		PatientID: c.Query("patientId"),
+		MessageID: c.Query("messageId"),
+		Purpose:   c.Query("purpose"),
+		Limit:     defaultAICallLogLimit,
+	}
+
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的limit参数"})
+			return
+		}
+		if limit > maxAICallLogLimit {
+			limit = maxAICallLogLimit
+		}
+		filter.Limit = limit
+	}
+	if value := c.Query("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的since参数，格式应为RFC3339"})
+			return
+		}
+		filter.Since = since
+	}
+	if value := c.Query("until"); value != "" {
+		until, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的until参数，格式应为RFC3339"})
+			return
+		}
+		filter.Until = until
+	}
+
+	logs, err := storage.GetAICallLogStorage().List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取AI调用日志失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, logs)
+}
+
+// GetAICallLogByID 获取AI调用日志详情（仅管理员）
+func GetAICallLogByID(c *gin.Context) {
+	log, err := storage.GetAICallLogStorage().GetByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "调用日志不存在"})
+		return
+	}
+
+	c.JSON(http.StatusOK, log)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"net/http"
+
+	"we-dear/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAIJobs 获取AI任务列表，可按患者、消息和状态筛选
+func GetAIJobs(c *gin.Context) {
+	patientID := c.Query("patientId")
+	messageID := c.Query("messageId")
+	status := c.Query("status")
+
+	// 非管理员只能查看自己患者的任务
+	role, _ := c.Get("role")
+	if role != "admin" {
+		if patientID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "patientId不能为空"})
+			return
+		}
+		if _, ok := authorizePatient(c, patientID); !ok {
+			return
+		}
+	}
+
+	jobs, err := storage.GetAIJobStorage().List(patientID, messageID, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取AI任务失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, jobs)
+}
+
+// GetAIJobByID 获取指定AI任务
+func GetAIJobByID(c *gin.Context) {
+	job, err := storage.GetAIJobStorage().GetByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return
+	}
+	if _, ok := authorizePatient(c, job.PatientID); !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
+
+// RetryAIJob 重新执行AI任务
+func RetryAIJob(c *gin.Context) {
+	job, err := storage.GetAIJobStorage().GetByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return
+	}
+	if _, ok := authorizePatient(c, job.PatientID); !ok {
+		return
+	}
+
+	job, err = aiJobQueue.Retry(job.ID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
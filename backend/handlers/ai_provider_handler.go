@@ -0,0 +1,27 @@
+package handlers
+
+import (
+	"net/http"
+
+	"we-dear/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetAIProviderStatus 获取AI供应商故障转移链及各供应商的熔断状态
+func GetAIProviderStatus(c *gin.Context) {
+	statuses := getAIService().ProviderStatuses()
+
+	available := false
+	for _, status := range statuses {
+		if status.Breaker.State != services.BreakerOpen {
+			available = true
+			break
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"available": available,
+		"providers": statuses,
+	})
+}
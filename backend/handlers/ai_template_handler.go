@@ -1,12 +1,12 @@
 package handlers
 
 import (
-	"encoding/json"
 	"net/http"
 	"time"
 
 	"we-dear/config"
 	"we-dear/models"
+	"we-dear/services"
 	"we-dear/utils"
 
 	"github.com/gin-gonic/gin"
@@ -41,10 +41,9 @@ func CreateAITemplate(c *gin.Context) {
 		return
 	}
 
-	// 验证JSON内容格式
-	var js json.RawMessage
-	if err := json.Unmarshal([]byte(template.Content), &js); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的JSON格式"})
+	// 验证模板内容格式和变量
+	if _, err := services.ParsePromptTemplateContent(template.Content); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
@@ -93,11 +92,10 @@ func UpdateAITemplate(c *gin.Context) {
 		return
 	}
 
-	// 验证JSON内容格式
+	// 验证模板内容格式和变量
 	if updateData.Content != "" {
-		var js json.RawMessage
-		if err := json.Unmarshal([]byte(updateData.Content), &js); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的JSON格式"})
+		if _, err := services.ParsePromptTemplateContent(updateData.Content); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 	}
@@ -215,3 +213,8 @@ func GetAITemplatesByCategory(c *gin.Context) {
 
 	c.JSON(http.StatusOK, templates)
 }
+
+// GetAITemplateVariables 获取模板中可以使用的变量
+func GetAITemplateVariables(c *gin.Context) {
+	c.JSON(http.StatusOK, services.PromptVariables)
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/services"
+	"we-dear/storage"
+	"we-dear/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 报表中需要补充名称的分组维度及对应的表
+var usageNameTables = map[string]string{
+	"doctor":     "doctors",
+	"department": "departments",
+	"patient":    "patients",
+	"template":   "ai_agent_templates",
+}
+
+// GetAIUsageReport 按维度汇总AI用量和费用（仅管理员），默认统计本月、按医生分组
+func GetAIUsageReport(c *gin.Context) {
+	now := time.Now()
+	filter := storage.UsageReportFilter{
+		From:         c.DefaultQuery("from", time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location()).Format("2006-01-02")),
+		To:           c.DefaultQuery("to", now.Format("2006-01-02")),
+		GroupBy:      c.DefaultQuery("groupBy", "doctor"),
+		DoctorID:     c.Query("doctorId"),
+		DepartmentID: c.Query("departmentId"),
+	}
+	for _, value := range []string{filter.From, filter.To} {
+		if _, err := time.Parse("2006-01-02", value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的日期参数，格式应为2006-01-02"})
+			return
+		}
+	}
+
+	rows, err := storage.GetAIUsageStorage().Report(filter)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if table, ok := usageNameTables[filter.GroupBy]; ok && len(rows) > 0 {
+		ids := make([]string, 0, len(rows))
+		for _, row := range rows {
+			ids = append(ids, row.Key)
+		}
+		var names []struct {
+			ID   string
+			Name string
+		}
+		if err := config.DB.Table(table).Select("id, name").Where("id IN ?", ids).Scan(&names).Error; err == nil {
+			byID := map[string]string{}
+			for _, item := range names {
+				byID[item.ID] = item.Name
+			}
+			for i := range rows {
+				rows[i].Name = byID[rows[i].Key]
+			}
+		}
+	}
+
+	total := storage.UsageReportRow{Key: "total"}
+	for _, row := range rows {
+		total.Calls += row.Calls
+		total.FailedCalls += row.FailedCalls
+		total.PromptTokens += row.PromptTokens
+		total.CompletionTokens += row.CompletionTokens
+		total.Cost += row.Cost
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":     filter.From,
+		"to":       filter.To,
+		"groupBy":  filter.GroupBy,
+		"currency": "CNY",
+		"total":    total,
+		"items":    rows,
+	})
+}
+
+// GetAIModelPrices 获取当前使用的模型价格表（元/百万token）
+func GetAIModelPrices(c *gin.Context) {
+	c.JSON(http.StatusOK, services.ModelPrices())
+}
+
+// GetAIBudgets 获取全部月度预算及本月使用情况
+func GetAIBudgets(c *gin.Context) {
+	budgets, err := storage.GetAIUsageStorage().ListBudgets()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取预算失败"})
+		return
+	}
+
+	now := time.Now()
+	statuses := make([]*services.BudgetStatus, 0, len(budgets))
+	for _, budget := range budgets {
+		status, err := services.GetBudgetStatus(budget, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "计算预算使用情况失败"})
+			return
+		}
+		statuses = append(statuses, status)
+	}
+	c.JSON(http.StatusOK, statuses)
+}
+
+// SaveAIBudgetRequest 设置月度预算的请求
+type SaveAIBudgetRequest struct {
+	Scope        string  `json:"scope" binding:"required"`
+	ScopeID      string  `json:"scopeId"`
+	MonthlyLimit float64 `json:"monthlyLimit"`
+}
+
+// SaveAIBudget 设置全院、科室或医生的月度预算，同一范围已有预算时更新
+func SaveAIBudget(c *gin.Context) {
+	var req SaveAIBudgetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	switch req.Scope {
+	case models.AIBudgetScopeGlobal:
+		req.ScopeID = ""
+	case models.AIBudgetScopeDepartment, models.AIBudgetScopeDoctor:
+		if req.ScopeID == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "科室和医生预算需要指定scopeId"})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的预算范围"})
+		return
+	}
+	if req.MonthlyLimit <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "月度预算必须大于0"})
+		return
+	}
+
+	usageStorage := storage.GetAIUsageStorage()
+	budget, err := usageStorage.GetBudget(req.Scope, req.ScopeID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取预算失败"})
+		return
+	}
+	now := time.Now()
+	if budget == nil {
+		budget = &models.AIBudget{
+			BaseModel: models.BaseModel{
+				ID:        utils.GenerateID(),
+				CreatedAt: now,
+			},
+			Scope:   req.Scope,
+			ScopeID: req.ScopeID,
+		}
+	}
+	userID, _ := c.Get("userId")
+	budget.MonthlyLimit = req.MonthlyLimit
+	budget.UpdatedBy = userID.(string)
+	budget.UpdatedAt = now
+
+	if err := usageStorage.SaveBudget(budget); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存预算失败"})
+		return
+	}
+
+	status, err := services.GetBudgetStatus(*budget, now)
+	if err != nil {
+		c.JSON(http.StatusOK, budget)
+		return
+	}
+	c.JSON(http.StatusOK, status)
+}
+
+// DeleteAIBudget 删除月度预算
+func DeleteAIBudget(c *gin.Context) {
+	if err := storage.GetAIUsageStorage().DeleteBudget(c.Param("id")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "预算不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
@@ -15,11 +15,13 @@ import (
 	"we-dear/config"
 	"we-dear/models"
 	"we-dear/services"
+	"we-dear/storage"
 )
 
 var (
-	aiService *services.AIService
-	once      sync.Once
+	aiService  *services.AIService
+	aiJobQueue *services.AIJobQueue
+	once       sync.Once
 )
 
 func getAIService() *services.AIService {
@@ -35,6 +37,8 @@ type MessageRequest struct {
 	Timestamp int64  `json:"timestamp,omitempty"`
 	Sender    string `json:"sender"`
 	Avatar    string `json:"avatar,omitempty"`
+	// SuggestionID 医生采用的AI建议，发送前检查用药安全警告是否已确认
+	SuggestionID string `json:"suggestionId,omitempty"`
 }
 
 // GetChatList 获取医生的聊天列表
@@ -71,13 +75,17 @@ func GetChatList(c *gin.Context) {
 		DoctorName    string    `json:"doctorName"`
 		LastMessage   string    `json:"lastMessage"`
 		LastMessageAt time.Time `json:"lastMessageAt"`
-		UnreadCount   int       `json:"unreadCount"`
+		UnreadCount   int       `json:"unreadCount"`             // 医生未读的患者消息数量
+		PatientUnread int       `json:"patientUnread"`           // 患者未读的医生消息数量
+		Urgency       string    `json:"urgency"`                 // 未处理升级事件中最高的紧急程度，没有时为 normal
+		Escalations   int       `json:"escalations"`             // 未处理的升级事件数量
+		VitalAlerts   int       `json:"vitalAlerts"`             // 未处理的生理指标提醒数量
+		AlertSeverity string    `json:"alertSeverity,omitempty"` // 未处理提醒中最高的严重程度（warning/critical）
 	}
 
 	var chatList []ChatItem
 	for _, patient := range patients {
 		var lastMessage models.Message
-		var unreadCount int64
 
 		// 获取最后一条消息
 		err := db.Where("patient_id = ?", patient.ID).
@@ -88,10 +96,27 @@ func GetChatList(c *gin.Context) {
 			continue
 		}
 
-		// 获取未读消息数量
-		db.Model(&models.Message{}).
-			Where("patient_id = ? AND role = ? AND read = ?", patient.ID, "patient", false).
-			Count(&unreadCount)
+		// 获取双方的未读消息数量
+		unread, _ := services.GetChatUnreadCounts(patient.ID)
+
+		// 获取未处理的升级事件
+		urgency := models.MessageUrgencyNormal
+		escalations, _ := storage.GetTriageStorage().ListEscalations("", patient.ID, "")
+		for _, escalation := range escalations {
+			if services.UrgencyRank(escalation.Level) > services.UrgencyRank(urgency) {
+				urgency = escalation.Level
+			}
+		}
+
+		// 获取未处理的生理指标提醒
+		alertCounts, _ := storage.GetVitalAlertStorage().OpenAlertCounts(patient.ID)
+		alertSeverity := ""
+		switch {
+		case alertCounts[models.VitalAlertSeverityCritical] > 0:
+			alertSeverity = models.VitalAlertSeverityCritical
+		case alertCounts[models.VitalAlertSeverityWarning] > 0:
+			alertSeverity = models.VitalAlertSeverityWarning
+		}
 
 		chatList = append(chatList, ChatItem{
 			PatientID:     patient.ID,
@@ -101,12 +126,26 @@ func GetChatList(c *gin.Context) {
 			DoctorName:    patient.Doctor.Name,
 			LastMessage:   lastMessage.Content,
 			LastMessageAt: lastMessage.CreatedAt,
-			UnreadCount:   int(unreadCount),
+			UnreadCount:   unread.Doctor,
+			PatientUnread: unread.Patient,
+			Urgency:       urgency,
+			Escalations:   len(escalations),
+			VitalAlerts:   alertCounts[models.VitalAlertSeverityCritical] + alertCounts[models.VitalAlertSeverityWarning],
+			AlertSeverity: alertSeverity,
 		})
 	}
 
-	// 按最后消息时间排序
+	// 有未处理升级事件的患者置顶（危急在前），其次是有危急、超标提醒的患者，其余按最后消息时间排序
+	alertRank := map[string]int{models.VitalAlertSeverityWarning: 1, models.VitalAlertSeverityCritical: 2}
 	sort.Slice(chatList, func(i, j int) bool {
+		ri, rj := services.UrgencyRank(chatList[i].Urgency), services.UrgencyRank(chatList[j].Urgency)
+		if ri != rj {
+			return ri > rj
+		}
+		ai, aj := alertRank[chatList[i].AlertSeverity], alertRank[chatList[j].AlertSeverity]
+		if ai != aj {
+			return ai > aj
+		}
 		return chatList[i].LastMessageAt.After(chatList[j].LastMessageAt)
 	})
 
@@ -155,6 +194,35 @@ func SendDoctorMessage(c *gin.Context) {
 		return
 	}
 
+	patient, ok := authorizePatient(c, patientId)
+	if !ok {
+		return
+	}
+
+	var suggestion *models.AISuggestion
+	if req.SuggestionID != "" {
+		suggestion = &models.AISuggestion{}
+		if err := config.DB.Preload("SafetyWarnings").
+			First(suggestion, "id = ? AND patient_id = ?", req.SuggestionID, patientId).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "AI建议不存在"})
+			return
+		}
+	}
+
+	// 无论是否采用AI建议，内容中的用药安全警告都必须已由医生确认
+	unresolved, err := services.CheckDoctorMessageSafety(patient, suggestion, req.Content, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "用药安全检查失败"})
+		return
+	}
+	if len(unresolved) > 0 {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":    "消息存在未确认的用药安全警告",
+			"warnings": unresolved,
+		})
+		return
+	}
+
 	message := models.Message{
 		BaseModel: models.BaseModel{
 			ID:        strconv.FormatInt(time.Now().UnixNano(), 10),
@@ -168,12 +236,35 @@ func SendDoctorMessage(c *gin.Context) {
 		Role:      models.MessageRoleDoctor,
 		Read:      false,
 	}
+	if suggestion != nil {
+		message.ReplyTo = suggestion.MessageID
+	}
 
 	if err := config.DB.Create(&message).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if suggestion == nil {
+		if err := storage.GetSafetyWarningStorage().AttachDrafts(patientId, message.ID); err != nil {
+			log.Printf("关联用药安全警告失败 (MessageID: %s): %v", message.ID, err)
+		}
+	}
+
+	// 发送即视为采纳该建议
+	if suggestion != nil {
+		userID, _ := c.Get("userId")
+		if err := config.DB.Model(suggestion).Updates(map[string]interface{}{
+			"status":      models.AISuggestionStatusApproved,
+			"reviewed_by": userID,
+			"reviewed_at": time.Now(),
+		}).Error; err != nil {
+			log.Printf("更新AI建议状态失败: %v", err)
+		}
+	}
+
+	services.PublishChatMessage(&message)
+	markReadOnReply(&message)
 	c.JSON(http.StatusOK, message)
 }
 
@@ -206,6 +297,7 @@ func SendPatientMessage(c *gin.Context) {
 		Type:      models.MessageTypeText,
 		Role:      models.MessageRolePatient,
 		Read:      false,
+		Urgency:   models.MessageUrgencyNormal,
 	}
 
 	// 保存患者消息
@@ -214,50 +306,97 @@ func SendPatientMessage(c *gin.Context) {
 		return
 	}
 
+	services.PublishChatMessage(&message)
+	markReadOnReply(&message)
+
+	// 红旗症状规则分诊，紧急消息立即升级给医生；模型分诊在AI任务中进行
+	if _, err := services.TriageMessageByRules(&message); err != nil {
+		log.Printf("规则分诊失败 (MessageID: %s): %v", message.ID, err)
+	}
+
 	// 将消息放入AI处理队列
-	go processAIResponse(message.ID, patientId, req.Content, &patient)
+	if _, err := aiJobQueue.Enqueue(models.AIJobTypeSuggestion, patientId, message.ID); err != nil {
+		log.Printf("创建AI任务失败 (MessageID: %s): %v", message.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "消息已保存，但创建AI任务失败"})
+		return
+	}
 
 	c.JSON(http.StatusOK, message)
 }
 
-// processAIResponse 处理AI响应的独立函数
-func processAIResponse(messageID string, patientID string, content string, patient *models.Patient) {
-	// 使用独立的数据库连接
-	db := config.DB.Session(&gorm.Session{})
-	defer func() {
-		if r := recover(); r != nil {
-			log.Printf("AI处理过程发生panic: %v", r)
-		}
-	}()
+// markReadOnReply 发送消息的一方已看过之前对方的全部消息，将其标记为已读
+func markReadOnReply(message *models.Message) {
+	receipt, err := services.MarkMessagesRead(message.PatientID, message.Role, message.ID, message.CreatedAt)
+	if err != nil {
+		log.Printf("标记已读失败 (MessageID: %s): %v", message.ID, err)
+		return
+	}
+	services.PublishChatRead(receipt, "")
+}
 
-	// 获取历史消息
-	var messages []models.Message
-	if err := db.Where("patient_id = ?", patientID).
-		Order("created_at asc").
-		Find(&messages).Error; err != nil {
-		log.Printf("获取聊天历史失败: %v", err)
+// MarkChatReadRequest 标记已读请求
+type MarkChatReadRequest struct {
+	MessageID string `json:"messageId" binding:"required"` // 已读到的消息ID
+	Reader    string `json:"reader"`                       // 阅读方，由登录身份决定，只能为 doctor
+}
+
+// MarkChatRead 将会话中另一方在指定消息及之前发送的消息标记为已读，并推送已读回执
+func MarkChatRead(c *gin.Context) {
+	patientID := c.Param("patientId")
+	if _, ok := authorizePatient(c, patientID); !ok {
 		return
 	}
 
-	// 生成AI建议
-	suggestion, err := getAIService().GenerateResponse(patient, messageID, content, messages)
+	var req MarkChatReadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "messageId不能为空"})
+		return
+	}
+	// 阅读方和实时聊天的连接一方一样由登录身份决定，不接受客户端声明为患者
+	if req.Reader != "" && req.Reader != models.MessageRoleDoctor {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有患者本人可以标记患者已读"})
+		return
+	}
+	req.Reader = models.MessageRoleDoctor
+
+	receipt, err := services.MarkMessagesRead(patientID, req.Reader, req.MessageID, time.Now())
 	if err != nil {
-		log.Printf("生成AI建议失败: %v", err)
+		switch {
+		case errors.Is(err, services.ErrInvalidReader):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, services.ErrChatMessageNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "标记已读失败"})
+		}
 		return
 	}
-	// 通过ai提取患者问题中的生理数据（血糖，血压）
-	// 尝试从患者消息中提取生理数据
-	if err := getAIService().ExtractPhysiologicalData(patientID, content); err != nil {
-		log.Printf("提取生理数据失败: %v", err)
-		// 继续处理,不中断流程
+	services.PublishChatRead(receipt, "")
+
+	unread, err := services.GetChatUnreadCounts(patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取未读数量失败"})
+		return
 	}
-	// 保存AI建议
-	if err := db.Create(&suggestion).Error; err != nil {
-		log.Printf("保存AI建议失败: %v", err)
+	c.JSON(http.StatusOK, gin.H{
+		"receipt": receipt,
+		"unread":  unread,
+	})
+}
+
+// GetChatUnread 获取会话双方的未读消息数量
+func GetChatUnread(c *gin.Context) {
+	patientID := c.Param("patientId")
+	if _, ok := authorizePatient(c, patientID); !ok {
 		return
 	}
 
-	log.Printf("成功生成并保存AI建议 (MessageID: %s)", messageID)
+	unread, err := services.GetChatUnreadCounts(patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取未读数量失败"})
+		return
+	}
+	c.JSON(http.StatusOK, unread)
 }
 
 // GetAISuggestions 获取医生视图的 AI 建议
@@ -266,7 +405,10 @@ func GetAISuggestions(c *gin.Context) {
 	messageId := c.Query("messageId")
 
 	var suggestions []models.AISuggestion
-	if err := config.DB.Where("patient_id = ? AND message_id = ?", patientId, messageId).
+	if err := config.DB.Preload("Citations", func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"index\" asc")
+	}).Preload("SafetyWarnings").Where("patient_id = ? AND message_id = ?", patientId, messageId).
+		Order("priority desc, created_at desc").
 		Find(&suggestions).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -275,6 +417,66 @@ func GetAISuggestions(c *gin.Context) {
 	c.JSON(http.StatusOK, suggestions)
 }
 
+// StreamAISuggestions 通过 Server-Sent Events 流式返回 AI 建议
+// 事件: delta（增量内容）、done（已保存的完整建议）、error（生成失败）
+func StreamAISuggestions(c *gin.Context) {
+	patientID := c.Param("patientId")
+	messageID := c.Query("messageId")
+
+	if messageID == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "messageId不能为空"})
+		return
+	}
+
+	if _, ok := authorizePatient(c, patientID); !ok {
+		return
+	}
+
+	var message models.Message
+	if err := config.DB.First(&message, "id = ? AND patient_id = ?", messageID, patientID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+		return
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	// 已经生成过的建议直接返回
+	existing, err := storage.GetPatientStorage().GetLatestAISuggestion(patientID, messageID)
+	if err != nil {
+		c.SSEvent("error", gin.H{"error": "获取AI建议失败"})
+		return
+	}
+	if existing != nil {
+		c.SSEvent("done", existing)
+		c.Writer.Flush()
+		return
+	}
+
+	// 与队列中该消息的建议任务协调，只生成一次；客户端断开后继续生成并保存，只是不再推送
+	suggestion, err := aiJobQueue.StreamSuggestion(c.Request.Context(), messageID, func(delta string) {
+		c.SSEvent("delta", gin.H{"content": delta})
+		c.Writer.Flush()
+	})
+	if err != nil {
+		log.Printf("流式生成AI建议失败: %v", err)
+		c.SSEvent("error", gin.H{"error": "生成AI建议失败"})
+		return
+	}
+
+	c.SSEvent("done", suggestion)
+	c.Writer.Flush()
+}
+
+// InitHandlers 初始化AI服务并启动AI任务队列，需在数据库初始化之后调用
 func InitHandlers() {
-	aiService = services.NewAIService()
+	aiJobQueue = services.NewAIJobQueue(getAIService(), config.GlobalConfig.AI.JobWorkers, config.GlobalConfig.AI.JobRetries)
+	aiJobQueue.Start()
+}
+
+// ShutdownHandlers 停止AI任务队列并等待执行中的任务完成
+func ShutdownHandlers() {
+	aiJobQueue.Stop()
 }
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+
+	"we-dear/models"
+	"we-dear/services"
+	"we-dear/utils"
+)
+
+const (
+	chatSocketPingInterval = 30 * time.Second // 心跳间隔，写入失败时断开连接
+	chatSocketWriteTimeout = 10 * time.Second // 单次推送的超时时间
+)
+
+// chatSocketFrame 客户端通过 WebSocket 发送的事件
+type chatSocketFrame struct {
+	Type      string `json:"type"`                // typing 或 read
+	Typing    bool   `json:"typing,omitempty"`    // typing 事件：是否正在输入
+	MessageID string `json:"messageId,omitempty"` // read 事件：已读到的消息ID
+}
+
+// ChatSocket 建立患者会话的 WebSocket 连接，推送新消息、AI建议、正在输入和已读回执；
+// 浏览器无法设置请求头，通过 token 查询参数认证
+func ChatSocket(c *gin.Context) {
+	patientID := c.Param("patientId")
+	if _, ok := authorizePatient(c, patientID); !ok {
+		return
+	}
+
+	role, ok := chatRole(c)
+	if !ok {
+		return
+	}
+
+	// 认证使用 token 而非 Cookie，跨站页面无法冒用登录状态，因此不校验 Origin
+	server := websocket.Server{Handler: func(ws *websocket.Conn) {
+		serveChatSocket(ws, patientID, role)
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// chatRole 根据登录身份确定连接在会话中的一方，不接受客户端自行声明；
+// 能登录的只有医生和管理员账号，都作为医生端，声明为患者端时返回403
+func chatRole(c *gin.Context) (string, bool) {
+	if as := c.Query("as"); as != "" && as != models.MessageRoleDoctor {
+		c.JSON(http.StatusForbidden, gin.H{"error": "只有患者本人可以作为患者端连接"})
+		return "", false
+	}
+	return models.MessageRoleDoctor, true
+}
+
+// serveChatSocket 订阅会话事件并转发给客户端，同时处理客户端发来的事件，直到连接断开
+func serveChatSocket(ws *websocket.Conn, patientID string, role string) {
+	defer ws.Close()
+
+	hub := services.GetChatHub()
+	subscriber := hub.Subscribe(patientID, utils.GenerateID(), role)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writeChatEvents(ws, subscriber)
+	}()
+
+	for {
+		var frame chatSocketFrame
+		if err := websocket.JSON.Receive(ws, &frame); err != nil {
+			break
+		}
+		event := services.ChatEvent{
+			Type:      frame.Type,
+			PatientID: patientID,
+			Role:      role,
+			SenderID:  subscriber.ID,
+		}
+		switch frame.Type {
+		case services.ChatEventTyping:
+			event.Data = gin.H{"typing": frame.Typing}
+		case services.ChatEventRead:
+			// 已读回执先保存，再推送给会话中的其他连接
+			if frame.MessageID == "" {
+				continue
+			}
+			receipt, err := services.MarkMessagesRead(patientID, role, frame.MessageID, time.Now())
+			if err != nil {
+				if !errors.Is(err, services.ErrChatMessageNotFound) {
+					log.Printf("标记已读失败 (PatientID: %s, MessageID: %s): %v", patientID, frame.MessageID, err)
+				}
+				continue
+			}
+			services.PublishChatRead(receipt, subscriber.ID)
+			continue
+		default:
+			continue
+		}
+		hub.Publish(event)
+	}
+
+	hub.Unsubscribe(subscriber)
+	<-done
+}
+
+// writeChatEvents 推送订阅到的事件并定时发送心跳，推送失败时关闭连接使读取结束
+func writeChatEvents(ws *websocket.Conn, subscriber *services.ChatSubscriber) {
+	ticker := time.NewTicker(chatSocketPingInterval)
+	defer ticker.Stop()
+
+	for {
+		var event interface{}
+		select {
+		case e, ok := <-subscriber.Events:
+			if !ok {
+				return
+			}
+			event = e
+		case <-ticker.C:
+			event = gin.H{"type": "ping"}
+		}
+		ws.SetWriteDeadline(time.Now().Add(chatSocketWriteTimeout))
+		if err := websocket.JSON.Send(ws, event); err != nil {
+			ws.Close()
+			// 继续读取直到取消订阅，避免发布方的事件堆积
+			for range subscriber.Events {
+			}
+			return
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetConversationSummary 获取患者的对话摘要
+func GetConversationSummary(c *gin.Context) {
+	patientID := c.Param("id")
+	if _, ok := authorizePatient(c, patientID); !ok {
+		return
+	}
+
+	summary, err := storage.GetConversationSummaryStorage().GetByPatientID(patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取对话摘要失败"})
+		return
+	}
+	if summary == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该患者还没有对话摘要"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// UpdateConversationSummary 医生修正对话摘要，之后的AI更新以修正后的内容为基础
+func UpdateConversationSummary(c *gin.Context) {
+	patientID := c.Param("id")
+	if _, ok := authorizePatient(c, patientID); !ok {
+		return
+	}
+
+	var req struct {
+		Content string `json:"content"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+	if strings.TrimSpace(req.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "摘要内容不能为空"})
+		return
+	}
+
+	summaryStorage := storage.GetConversationSummaryStorage()
+	summary, err := summaryStorage.GetByPatientID(patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取对话摘要失败"})
+		return
+	}
+
+	now := time.Now()
+	if summary == nil {
+		// 医生手写的摘要覆盖到目前最新的一条消息为止的对话
+		latest, err := summaryStorage.GetLatestMessage(patientID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取聊天记录失败"})
+			return
+		}
+		summary = &models.ConversationSummary{
+			BaseModel: models.BaseModel{
+				ID:        utils.GenerateID(),
+				CreatedAt: now,
+			},
+			PatientID: patientID,
+		}
+		if latest != nil {
+			summary.LastMessageID = latest.ID
+			summary.LastMessageAt = latest.CreatedAt
+		}
+	}
+	userID, _ := c.Get("userId")
+	version := summary.Version
+	summary.Content = strings.TrimSpace(req.Content)
+	summary.Version++
+	summary.EditedBy = userID.(string)
+	summary.EditedAt = now
+
+	saved, err := summaryStorage.SaveIfVersion(summary, version)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存对话摘要失败"})
+		return
+	}
+	if !saved {
+		c.JSON(http.StatusConflict, gin.H{"error": "对话摘要已被更新，请刷新后重试"})
+		return
+	}
+
+	c.JSON(http.StatusOK, summary)
+}
+
+// RefreshConversationSummary 立即创建摘要更新任务，不等待新消息达到阈值
+func RefreshConversationSummary(c *gin.Context) {
+	patientID := c.Param("id")
+	if _, ok := authorizePatient(c, patientID); !ok {
+		return
+	}
+
+	job, err := aiJobQueue.EnqueueSummary(patientID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建摘要任务失败"})
+		return
+	}
+	if job == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "已有待执行的摘要任务"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, job)
+}
@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"we-dear/models"
+	"we-dear/services"
+	"we-dear/storage"
+	"we-dear/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeviceCredentialResponse 登记设备或重置凭据的响应，凭据原文只返回这一次
+type DeviceCredentialResponse struct {
+	Device *models.Device `json:"device"`
+	APIKey string         `json:"apiKey,omitempty"` // api_key 方式的 API Key
+	Secret string         `json:"secret,omitempty"` // hmac 方式的签名密钥
+}
+
+func newDeviceCredentialResponse(device *models.Device, key string) DeviceCredentialResponse {
+	response := DeviceCredentialResponse{Device: device}
+	if device.AuthType == models.DeviceAuthHMAC {
+		response.Secret = key
+	} else {
+		response.APIKey = key
+	}
+	return response
+}
+
+// GetPatientDevices 获取患者登记的设备
+func GetPatientDevices(c *gin.Context) {
+	patient, ok := authorizePatient(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	devices, err := storage.GetDeviceStorage().ListByPatient(patient.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取设备失败"})
+		return
+	}
+	c.JSON(http.StatusOK, devices)
+}
+
+// RegisterDeviceRequest 登记设备的请求
+type RegisterDeviceRequest struct {
+	SerialNumber string `json:"serialNumber" binding:"required"`
+	Manufacturer string `json:"manufacturer"`
+	Model        string `json:"model"`
+	AuthType     string `json:"authType"` // api_key（默认）或 hmac
+}
+
+// RegisterDevice 为患者登记设备并生成上传凭据
+func RegisterDevice(c *gin.Context) {
+	patient, ok := authorizePatient(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var req RegisterDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.AuthType == "" {
+		req.AuthType = models.DeviceAuthAPIKey
+	}
+	if req.AuthType != models.DeviceAuthAPIKey && req.AuthType != models.DeviceAuthHMAC {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的认证方式"})
+		return
+	}
+
+	deviceStorage := storage.GetDeviceStorage()
+	existing, err := deviceStorage.GetBySerialNumber(req.SerialNumber)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登记设备失败"})
+		return
+	}
+	if existing != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "该序列号的设备已登记"})
+		return
+	}
+
+	userID, _ := c.Get("userId")
+	now := time.Now()
+	device := &models.Device{
+		BaseModel: models.BaseModel{
+			ID:        utils.GenerateID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		SerialNumber: req.SerialNumber,
+		Manufacturer: req.Manufacturer,
+		Model:        req.Model,
+		PatientID:    patient.ID,
+		AuthType:     req.AuthType,
+		Status:       models.DeviceStatusActive,
+		RegisteredBy: userID.(string),
+	}
+	key, err := services.IssueDeviceCredential(device)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成设备凭据失败"})
+		return
+	}
+	if err := deviceStorage.Create(device); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登记设备失败"})
+		return
+	}
+	c.JSON(http.StatusOK, newDeviceCredentialResponse(device, key))
+}
+
+// loadAuthorizedDevice 获取设备并检查当前用户是否有权管理设备所属患者
+func loadAuthorizedDevice(c *gin.Context) (*models.Device, bool) {
+	device, err := storage.GetDeviceStorage().GetByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "设备不存在"})
+		return nil, false
+	}
+	if _, ok := authorizePatient(c, device.PatientID); !ok {
+		return nil, false
+	}
+	return device, true
+}
+
+// UpdateDeviceRequest 修改设备的请求，字段为空时不修改
+type UpdateDeviceRequest struct {
+	Manufacturer string `json:"manufacturer"`
+	Model        string `json:"model"`
+	Status       string `json:"status"` // active/disabled
+}
+
+// UpdateDevice 修改设备信息或停用、启用设备
+func UpdateDevice(c *gin.Context) {
+	device, ok := loadAuthorizedDevice(c)
+	if !ok {
+		return
+	}
+	var req UpdateDeviceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Status != "" && req.Status != models.DeviceStatusActive && req.Status != models.DeviceStatusDisabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的设备状态"})
+		return
+	}
+
+	if req.Manufacturer != "" {
+		device.Manufacturer = req.Manufacturer
+	}
+	if req.Model != "" {
+		device.Model = req.Model
+	}
+	if req.Status != "" {
+		device.Status = req.Status
+	}
+	device.UpdatedAt = time.Now()
+	if err := storage.GetDeviceStorage().Save(device); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设备失败"})
+		return
+	}
+	c.JSON(http.StatusOK, device)
+}
+
+// RotateDeviceKey 重置设备凭据，旧凭据立即失效
+func RotateDeviceKey(c *gin.Context) {
+	device, ok := loadAuthorizedDevice(c)
+	if !ok {
+		return
+	}
+	key, err := services.IssueDeviceCredential(device)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成设备凭据失败"})
+		return
+	}
+	device.UpdatedAt = time.Now()
+	if err := storage.GetDeviceStorage().Save(device); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新设备失败"})
+		return
+	}
+	c.JSON(http.StatusOK, newDeviceCredentialResponse(device, key))
+}
+
+// IngestDeviceReadingsRequest 设备批量上传读数的请求
+type IngestDeviceReadingsRequest struct {
+	Readings []services.IngestReading `json:"readings" binding:"required"`
+}
+
+// IngestDeviceReadings 设备批量上传读数，由 DeviceAuthRequired 认证；
+// 每条读数单独返回处理结果，重发的读数返回 duplicate
+func IngestDeviceReadings(c *gin.Context) {
+	value, _ := c.Get("device")
+	device := value.(*models.Device)
+
+	var req IngestDeviceReadingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "请求数据过大"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的请求数据"})
+		return
+	}
+	if len(req.Readings) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "没有读数"})
+		return
+	}
+	if len(req.Readings) > services.MaxDeviceBatch {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("单次最多上传%d条读数", services.MaxDeviceBatch)})
+		return
+	}
+
+	results, err := services.IngestDeviceReadings(device, req.Readings, time.Now())
+	if err != nil {
+		log.Printf("保存设备数据失败 (DeviceID: %s): %v", device.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存设备数据失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ingestSummary(results))
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetEscalations 获取升级事件列表，默认只返回未处理完的事件
+func GetEscalations(c *gin.Context) {
+	patientID := c.Query("patientId")
+	status := c.Query("status")
+
+	// 非管理员只能查看分配给自己的事件
+	doctorID := ""
+	role, _ := c.Get("role")
+	if role != "admin" {
+		userID, _ := c.Get("userId")
+		doctorID = userID.(string)
+	}
+
+	escalations, err := storage.GetTriageStorage().ListEscalations(doctorID, patientID, status)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取升级事件失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, escalations)
+}
+
+// AcknowledgeEscalation 医生确认已看到升级事件
+func AcknowledgeEscalation(c *gin.Context) {
+	updateEscalationStatus(c, models.EscalationStatusAcknowledged)
+}
+
+// ResolveEscalation 医生标记升级事件已处理
+func ResolveEscalation(c *gin.Context) {
+	updateEscalationStatus(c, models.EscalationStatusResolved)
+}
+
+func updateEscalationStatus(c *gin.Context, status string) {
+	triageStorage := storage.GetTriageStorage()
+	escalation, err := triageStorage.GetEscalationByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "升级事件不存在"})
+		return
+	}
+	if _, ok := authorizePatient(c, escalation.PatientID); !ok {
+		return
+	}
+	if escalation.Status == models.EscalationStatusResolved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "升级事件已处理"})
+		return
+	}
+
+	userID, _ := c.Get("userId")
+	now := time.Now()
+	switch status {
+	case models.EscalationStatusAcknowledged:
+		escalation.AcknowledgedBy = userID.(string)
+		escalation.AcknowledgedAt = now
+	case models.EscalationStatusResolved:
+		if escalation.AcknowledgedBy == "" {
+			escalation.AcknowledgedBy = userID.(string)
+			escalation.AcknowledgedAt = now
+		}
+		escalation.ResolvedBy = userID.(string)
+		escalation.ResolvedAt = now
+	}
+	escalation.Status = status
+
+	if err := triageStorage.SaveEscalation(escalation); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新升级事件失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, escalation)
+}
+
+// GetMessageTriage 获取消息的分诊记录
+func GetMessageTriage(c *gin.Context) {
+	var message models.Message
+	if err := config.DB.First(&message, "id = ?", c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "消息不存在"})
+		return
+	}
+	if _, ok := authorizePatient(c, message.PatientID); !ok {
+		return
+	}
+
+	decisions, err := storage.GetTriageStorage().GetDecisionsByMessageID(message.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取分诊记录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"messageId": message.ID,
+		"urgency":   message.Urgency,
+		"decisions": decisions,
+	})
+}
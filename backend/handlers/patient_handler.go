@@ -71,3 +71,21 @@ func CreatePatient(c *gin.Context) {
 
 	c.JSON(http.StatusCreated, patient)
 }
+
+// authorizePatient 检查当前用户是否可以访问该患者（管理员或主治医生），
+// 不可访问时写入错误响应并返回 false
+func authorizePatient(c *gin.Context, patientID string) (*models.Patient, bool) {
+	userID, _ := c.Get("userId")
+	role, _ := c.Get("role")
+
+	patient, err := initPatientStorage().GetPatientByID(patientID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "患者不存在"})
+		return nil, false
+	}
+	if role != "admin" && patient.DoctorID != userID.(string) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权访问此患者的数据"})
+		return nil, false
+	}
+	return patient, true
+}
@@ -1,8 +1,13 @@
 package handlers
 
 import (
+	"errors"
+	"io"
+	"log"
 	"net/http"
+	"time"
 	"we-dear/models"
+	"we-dear/services"
 	"we-dear/storage"
 	"we-dear/utils"
 
@@ -19,16 +24,10 @@ func GetPhysiologicalData(c *gin.Context) {
 
 	// 获取数据类型参数（可选）
 	dataType := c.Query("type")
-	
-	var data []models.PhysiologicalData
-	var err error
-	
-	store := storage.GetPhysiologicalDataStorage()
-	if dataType != "" {
-		data, err = store.GetByPatientIDAndType(patientID, dataType)
-	} else {
-		data, err = store.GetByPatientID(patientID)
-	}
+	// 默认只返回已确认的数据，待确认和已驳回的AI提取数据需要指定状态
+	status := c.DefaultQuery("status", models.PhysiologicalStatusConfirmed)
+
+	data, err := storage.GetPhysiologicalDataStorage().ListByPatient(patientID, dataType, status)
 
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取生理数据失败"})
@@ -46,11 +45,20 @@ func CreatePhysiologicalData(c *gin.Context) {
 		return
 	}
 
-	// 生成ID
+	// 生成ID，手动录入的数据直接为已确认
 	data.ID = utils.GenerateID()
+	data.Status = models.PhysiologicalStatusConfirmed
+	data.MessageID = ""
+	data.ExtractedValue = ""
+	data.DeviceID = ""
+	data.IdempotencyKey = ""
+	if err := services.NormalizePhysiologicalData(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	store := storage.GetPhysiologicalDataStorage()
-	if err := store.Create(&data); err != nil {
+	// 保存后按患者的目标范围评估是否需要提醒
+	if err := services.RecordPhysiologicalData(&data); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建生理数据失败"})
 		return
 	}
@@ -72,12 +80,41 @@ func UpdatePhysiologicalData(c *gin.Context) {
 		return
 	}
 
-	data.ID = id
 	store := storage.GetPhysiologicalDataStorage()
+	existing, err := store.GetByID(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "生理数据不存在"})
+		return
+	}
+
+	// 确认状态和审核信息只能通过确认、驳回接口修改，设备和幂等键不能修改
+	data.ID = id
+	data.CreatedAt = existing.CreatedAt
+	data.Status = existing.Status
+	data.MessageID = existing.MessageID
+	data.ExtractedValue = existing.ExtractedValue
+	data.ReviewedBy = existing.ReviewedBy
+	data.ReviewedAt = existing.ReviewedAt
+	data.ReviewNote = existing.ReviewNote
+	data.DeviceID = existing.DeviceID
+	data.IdempotencyKey = existing.IdempotencyKey
+	// 只修改了数据值的旧客户端，以数据值为准重新解析数值分量
+	if data.Value != existing.Value {
+		data.Components = nil
+	}
+	if err := services.NormalizePhysiologicalData(&data); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 	if err := store.Update(&data); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新生理数据失败"})
 		return
 	}
+	if data.Value != existing.Value || !data.MeasuredAt.Equal(existing.MeasuredAt) {
+		if _, err := services.ReevaluateVitalAlerts(&data); err != nil {
+			log.Printf("重新评估生理数据提醒失败 (DataID: %s): %v", data.ID, err)
+		}
+	}
 
 	c.JSON(http.StatusOK, data)
 }
@@ -95,6 +132,134 @@ func DeletePhysiologicalData(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除生理数据失败"})
 		return
 	}
+	if err := storage.GetVitalAlertStorage().DismissAlertsForData(id); err != nil {
+		log.Printf("作废生理数据提醒失败 (DataID: %s): %v", id, err)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
-} 
\ No newline at end of file
+}
+
+// GetPhysiologicalSeries 按时间段聚合患者的生理数据，用于绘制长期趋势图，
+// 默认统计最近90天、按天聚合
+func GetPhysiologicalSeries(c *gin.Context) {
+	patientID := c.Param("id")
+	if _, ok := authorizePatient(c, patientID); !ok {
+		return
+	}
+	dataType := c.Query("type")
+	if dataType == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "数据类型不能为空"})
+		return
+	}
+
+	to := time.Now()
+	if value := c.Query("to"); value != "" {
+		parsed, err := parseSeriesTime(value, true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的结束时间"})
+			return
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -90)
+	if value := c.Query("from"); value != "" {
+		parsed, err := parseSeriesTime(value, false)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的开始时间"})
+			return
+		}
+		from = parsed
+	}
+
+	series, err := services.GetVitalSeries(services.SeriesQuery{
+		PatientID: patientID,
+		Type:      dataType,
+		Context:   c.Query("context"),
+		From:      from,
+		To:        to,
+		Bucket:    c.DefaultQuery("bucket", "day"),
+	})
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidSeriesQuery) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取生理数据趋势失败"})
+		return
+	}
+	c.JSON(http.StatusOK, series)
+}
+
+// parseSeriesTime 解析 RFC3339 时间或 2006-01-02 日期，日期作为结束时间时包含当天
+func parseSeriesTime(value string, end bool) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if end {
+		parsed = parsed.AddDate(0, 0, 1)
+	}
+	return parsed, nil
+}
+
+// 导入文件大小上限
+const maxImportFileSize = 10 << 20
+
+// ImportPhysiologicalData 从 Open mHealth 或 FHIR 文件导入患者的生理数据，
+// 文件可通过 multipart 的 file 字段上传，也可直接作为请求体；format 为空时按内容判断格式
+func ImportPhysiologicalData(c *gin.Context) {
+	patient, ok := authorizePatient(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var reader io.Reader = c.Request.Body
+	if file, err := c.FormFile("file"); err == nil {
+		opened, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+			return
+		}
+		defer opened.Close()
+		reader = opened
+	}
+	content, err := io.ReadAll(io.LimitReader(reader, maxImportFileSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "读取文件失败"})
+		return
+	}
+	if len(content) > maxImportFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "文件不能超过10MB"})
+		return
+	}
+
+	results, err := services.ImportPhysiologicalData(patient.ID, c.Query("format"), content, time.Now())
+	if err != nil {
+		if errors.Is(err, services.ErrInvalidImport) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Printf("导入生理数据失败 (PatientID: %s): %v", patient.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导入生理数据失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ingestSummary(results))
+}
+
+// ingestSummary 批量保存读数的响应：各处理结果的数量和逐条结果
+func ingestSummary(results []services.IngestResult) gin.H {
+	counts := map[string]int{}
+	for _, result := range results {
+		counts[result.Status]++
+	}
+	return gin.H{
+		"created":    counts[services.IngestCreated],
+		"duplicates": counts[services.IngestDuplicate],
+		"invalid":    counts[services.IngestInvalid],
+		"results":    results,
+	}
+}
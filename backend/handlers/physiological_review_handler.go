@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/services"
+	"we-dear/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PendingPhysiologicalData 待确认的生理数据，附带来源消息供医生核对
+type PendingPhysiologicalData struct {
+	models.PhysiologicalData
+	PatientName    string `json:"patientName"`    // 患者姓名
+	MessageContent string `json:"messageContent"` // 来源消息内容
+}
+
+// GetPendingPhysiologicalData 获取待确认的AI提取数据，非管理员只返回自己患者的数据
+func GetPendingPhysiologicalData(c *gin.Context) {
+	doctorID := ""
+	role, _ := c.Get("role")
+	if role != "admin" {
+		userID, _ := c.Get("userId")
+		doctorID = userID.(string)
+	}
+
+	records, err := storage.GetPhysiologicalDataStorage().ListPending(doctorID, c.Query("patientId"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取待确认数据失败"})
+		return
+	}
+
+	patientIDs := make([]string, 0, len(records))
+	messageIDs := make([]string, 0, len(records))
+	for _, record := range records {
+		patientIDs = append(patientIDs, record.PatientID)
+		messageIDs = append(messageIDs, record.MessageID)
+	}
+	var patients []models.Patient
+	var messages []models.Message
+	if len(records) > 0 {
+		config.DB.Select("id, name").Where("id IN ?", patientIDs).Find(&patients)
+		config.DB.Select("id, content").Where("id IN ?", messageIDs).Find(&messages)
+	}
+	patientNames := map[string]string{}
+	for _, patient := range patients {
+		patientNames[patient.ID] = patient.Name
+	}
+	messageContents := map[string]string{}
+	for _, message := range messages {
+		messageContents[message.ID] = message.Content
+	}
+
+	items := make([]PendingPhysiologicalData, 0, len(records))
+	for _, record := range records {
+		items = append(items, PendingPhysiologicalData{
+			PhysiologicalData: record,
+			PatientName:       patientNames[record.PatientID],
+			MessageContent:    messageContents[record.MessageID],
+		})
+	}
+	c.JSON(http.StatusOK, items)
+}
+
+// ReviewPhysiologicalDataRequest 确认或驳回AI提取数据的请求
+type ReviewPhysiologicalDataRequest struct {
+	Value      string     `json:"value"`      // 修正后的数据值，为空表示按AI提取的值确认
+	Context    *string    `json:"context"`    // 修正后的测量场景，不传时保留原场景，空字符串表示清除
+	MeasuredAt *time.Time `json:"measuredAt"` // 修正后的测量时间
+	Note       string     `json:"note"`       // 确认说明或驳回原因
+}
+
+// ConfirmPhysiologicalData 医生确认AI提取的数据，可以同时修正数值、测量场景和测量时间
+func ConfirmPhysiologicalData(c *gin.Context) {
+	record, req, ok := loadPendingPhysiologicalData(c)
+	if !ok {
+		return
+	}
+
+	// 只修正数值时保留原来的测量场景，除非修正的数据值中带有场景（如 7.2-餐后）
+	context := record.Context
+	if value := strings.TrimSpace(req.Value); value != "" && value != record.Value {
+		record.Value = value
+		record.Components = nil
+		record.Context = ""
+		if err := services.NormalizePhysiologicalData(record); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if record.Context != "" {
+			context = record.Context
+		}
+	}
+	if req.Context != nil {
+		context = strings.TrimSpace(*req.Context)
+	}
+	if context != record.Context {
+		record.Context = context
+		if err := services.NormalizePhysiologicalData(record); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.MeasuredAt != nil {
+		if req.MeasuredAt.After(time.Now()) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "测量时间不能晚于当前时间"})
+			return
+		}
+		record.MeasuredAt = *req.MeasuredAt
+	}
+
+	savePhysiologicalReview(c, record, models.PhysiologicalStatusConfirmed, req.Note)
+}
+
+// RejectPhysiologicalData 医生驳回AI提取错误的数据，驳回的数据保留用于核查但不再展示
+func RejectPhysiologicalData(c *gin.Context) {
+	record, req, ok := loadPendingPhysiologicalData(c)
+	if !ok {
+		return
+	}
+	savePhysiologicalReview(c, record, models.PhysiologicalStatusRejected, req.Note)
+}
+
+// loadPendingPhysiologicalData 读取请求和待确认的数据，并检查医生是否有权处理
+func loadPendingPhysiologicalData(c *gin.Context) (*models.PhysiologicalData, ReviewPhysiologicalDataRequest, bool) {
+	var req ReviewPhysiologicalDataRequest
+	// 请求体可以为空，直接确认时不需要修正
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return nil, req, false
+	}
+
+	record, err := storage.GetPhysiologicalDataStorage().GetByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "生理数据不存在"})
+		return nil, req, false
+	}
+	if _, ok := authorizePatient(c, record.PatientID); !ok {
+		return nil, req, false
+	}
+	if record.Status != models.PhysiologicalStatusPending {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该数据已处理"})
+		return nil, req, false
+	}
+	return record, req, true
+}
+
+// savePhysiologicalReview 保存确认结果
+func savePhysiologicalReview(c *gin.Context, record *models.PhysiologicalData, status string, note string) {
+	userID, _ := c.Get("userId")
+	now := time.Now()
+	record.Status = status
+	record.ReviewedBy = userID.(string)
+	record.ReviewedAt = now
+	record.ReviewNote = strings.TrimSpace(note)
+	record.UpdatedAt = now
+
+	if err := storage.GetPhysiologicalDataStorage().Update(record); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存确认结果失败"})
+		return
+	}
+
+	// 待确认的数据不产生提醒：确认（包括修正后确认）时才评估，驳回时作废可能存在的旧提醒
+	var err error
+	if status == models.PhysiologicalStatusRejected {
+		err = storage.GetVitalAlertStorage().DismissAlertsForData(record.ID)
+	} else {
+		_, err = services.ReevaluateVitalAlerts(record)
+	}
+	if err != nil {
+		log.Printf("更新生理数据提醒失败 (DataID: %s): %v", record.ID, err)
+	}
+	c.JSON(http.StatusOK, record)
+}
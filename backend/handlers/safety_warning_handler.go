@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AcknowledgeSafetyWarningRequest 确认用药安全警告的请求
+type AcknowledgeSafetyWarningRequest struct {
+	Note string `json:"note"` // 确认说明，阻止级别的警告必填
+}
+
+// AcknowledgeSafetyWarning 医生确认AI建议的用药安全警告
+func AcknowledgeSafetyWarning(c *gin.Context) {
+	suggestionID := c.Param("id")
+	warningID := c.Param("warningId")
+
+	var req AcknowledgeSafetyWarningRequest
+	// 请求体可以为空，慎用级别的警告不需要说明
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var suggestion models.AISuggestion
+	if err := config.DB.First(&suggestion, "id = ?", suggestionID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "AI建议不存在"})
+		return
+	}
+	if _, ok := authorizePatient(c, suggestion.PatientID); !ok {
+		return
+	}
+
+	var warning models.SuggestionSafetyWarning
+	if err := config.DB.First(&warning, "id = ? AND suggestion_id = ?", warningID, suggestionID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用药安全警告不存在"})
+		return
+	}
+	acknowledgeSafetyWarning(c, &warning, req)
+}
+
+// AcknowledgePatientSafetyWarning 医生确认自己撰写的消息产生的用药安全警告（发送消息时返回的没有 suggestionId 的警告）
+func AcknowledgePatientSafetyWarning(c *gin.Context) {
+	patientID := c.Param("id")
+	warningID := c.Param("warningId")
+
+	var req AcknowledgeSafetyWarningRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if _, ok := authorizePatient(c, patientID); !ok {
+		return
+	}
+
+	warning, err := storage.GetSafetyWarningStorage().GetByID(warningID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用药安全警告失败"})
+		return
+	}
+	if warning == nil || warning.PatientID != patientID || warning.SuggestionID != "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用药安全警告不存在"})
+		return
+	}
+	acknowledgeSafetyWarning(c, warning, req)
+}
+
+// acknowledgeSafetyWarning 记录确认人和说明，已确认的警告直接返回
+func acknowledgeSafetyWarning(c *gin.Context, warning *models.SuggestionSafetyWarning, req AcknowledgeSafetyWarningRequest) {
+	if warning.AcknowledgedBy != "" {
+		c.JSON(http.StatusOK, warning)
+		return
+	}
+
+	note := strings.TrimSpace(req.Note)
+	if warning.Severity == models.SafetySeverityBlock && note == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "禁用级别的警告需要填写确认说明"})
+		return
+	}
+
+	userID, _ := c.Get("userId")
+	now := time.Now()
+	warning.AcknowledgedBy = userID.(string)
+	warning.AcknowledgedAt = now
+	warning.AcknowledgeNote = note
+	warning.UpdatedAt = now
+	if err := storage.GetSafetyWarningStorage().Save(warning); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "确认警告失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, warning)
+}
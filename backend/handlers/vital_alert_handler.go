@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"we-dear/models"
+	"we-dear/services"
+	"we-dear/storage"
+	"we-dear/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetVitalAlerts 获取生理指标提醒，默认只返回未处理的提醒，非管理员只返回自己患者的提醒
+func GetVitalAlerts(c *gin.Context) {
+	doctorID := ""
+	role, _ := c.Get("role")
+	if role != "admin" {
+		userID, _ := c.Get("userId")
+		doctorID = userID.(string)
+	}
+
+	alerts, err := storage.GetVitalAlertStorage().ListAlerts(doctorID, c.Query("patientId"), c.Query("status"), c.Query("severity"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取提醒失败"})
+		return
+	}
+	c.JSON(http.StatusOK, alerts)
+}
+
+// AcknowledgeVitalAlert 医生确认已处理生理指标提醒
+func AcknowledgeVitalAlert(c *gin.Context) {
+	alertStorage := storage.GetVitalAlertStorage()
+	alert, err := alertStorage.GetAlertByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "提醒不存在"})
+		return
+	}
+	if _, ok := authorizePatient(c, alert.PatientID); !ok {
+		return
+	}
+	if alert.Status != models.VitalAlertStatusOpen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "提醒已处理"})
+		return
+	}
+
+	userID, _ := c.Get("userId")
+	now := time.Now()
+	alert.Status = models.VitalAlertStatusAcknowledged
+	alert.AcknowledgedBy = userID.(string)
+	alert.AcknowledgedAt = now
+	alert.UpdatedAt = now
+	if err := alertStorage.SaveAlert(alert); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新提醒失败"})
+		return
+	}
+	c.JSON(http.StatusOK, alert)
+}
+
+// GetVitalTargets 获取患者各项指标生效的目标范围及来源
+func GetVitalTargets(c *gin.Context) {
+	patient, ok := authorizePatient(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	targets, err := services.PatientVitalTargets(patient)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取目标范围失败"})
+		return
+	}
+	c.JSON(http.StatusOK, targets)
+}
+
+// SaveVitalTargetRequest 设置患者目标范围的请求
+type SaveVitalTargetRequest struct {
+	Type         string   `json:"type" binding:"required"`
+	Context      string   `json:"context"`
+	Field        string   `json:"field" binding:"required"`
+	Low          float64  `json:"low"`
+	High         float64  `json:"high"`
+	CriticalLow  *float64 `json:"criticalLow"`
+	CriticalHigh *float64 `json:"criticalHigh"`
+}
+
+// SaveVitalTarget 为患者设置某项指标的目标范围，已设置时更新；只影响之后的评估
+func SaveVitalTarget(c *gin.Context) {
+	patient, ok := authorizePatient(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var req SaveVitalTargetRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	definition, known := services.VitalSignTypeByName(req.Type)
+	if !known {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的数据类型"})
+		return
+	}
+	validField := false
+	for _, field := range definition.Fields {
+		validField = validField || field.Name == req.Field
+	}
+	validContext := req.Context == ""
+	for _, context := range definition.Contexts {
+		validContext = validContext || context == req.Context
+	}
+	if !validField || !validContext {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的数值字段或测量场景"})
+		return
+	}
+	if req.Low > req.High ||
+		(req.CriticalLow != nil && *req.CriticalLow > req.Low) ||
+		(req.CriticalHigh != nil && *req.CriticalHigh < req.High) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "目标范围无效，危急范围应包含目标范围"})
+		return
+	}
+
+	alertStorage := storage.GetVitalAlertStorage()
+	target, err := alertStorage.GetTarget(patient.ID, req.Type, req.Context, req.Field)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取目标范围失败"})
+		return
+	}
+	now := time.Now()
+	if target == nil {
+		target = &models.VitalTarget{
+			BaseModel: models.BaseModel{
+				ID:        utils.GenerateID(),
+				CreatedAt: now,
+			},
+			PatientID: patient.ID,
+			Type:      req.Type,
+			Context:   req.Context,
+			Field:     req.Field,
+		}
+	}
+	userID, _ := c.Get("userId")
+	target.Low = req.Low
+	target.High = req.High
+	target.CriticalLow = req.CriticalLow
+	target.CriticalHigh = req.CriticalHigh
+	target.UpdatedBy = userID.(string)
+	target.UpdatedAt = now
+
+	if err := alertStorage.SaveTarget(target); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存目标范围失败"})
+		return
+	}
+	c.JSON(http.StatusOK, target)
+}
+
+// DeleteVitalTarget 删除为患者设置的目标范围，恢复使用慢病或默认范围
+func DeleteVitalTarget(c *gin.Context) {
+	patient, ok := authorizePatient(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	if err := storage.GetVitalAlertStorage().DeleteTarget(patient.ID, c.Param("targetId")); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "目标范围不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
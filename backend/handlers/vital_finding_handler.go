@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"we-dear/models"
+	"we-dear/services"
+	"we-dear/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetVitalFindings 获取生理指标趋势异常，默认只返回待处理的记录，非管理员只返回自己患者的记录
+func GetVitalFindings(c *gin.Context) {
+	doctorID := ""
+	role, _ := c.Get("role")
+	if role != "admin" {
+		userID, _ := c.Get("userId")
+		doctorID = userID.(string)
+	}
+
+	findings, err := storage.GetVitalFindingStorage().List(doctorID, c.Query("patientId"), c.Query("status"), c.Query("kind"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取趋势异常失败"})
+		return
+	}
+	c.JSON(http.StatusOK, findings)
+}
+
+// AcknowledgeVitalFinding 医生确认已知晓趋势异常，异常消失后仍会自动关闭
+func AcknowledgeVitalFinding(c *gin.Context) {
+	findingStorage := storage.GetVitalFindingStorage()
+	finding, err := findingStorage.GetByID(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "趋势异常不存在"})
+		return
+	}
+	if _, ok := authorizePatient(c, finding.PatientID); !ok {
+		return
+	}
+	if finding.Status != models.VitalFindingStatusOpen {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "趋势异常已处理"})
+		return
+	}
+
+	userID, _ := c.Get("userId")
+	now := time.Now()
+	finding.Status = models.VitalFindingStatusAcknowledged
+	finding.AcknowledgedBy = userID.(string)
+	finding.AcknowledgedAt = now
+	finding.UpdatedAt = now
+	if err := findingStorage.Save(finding); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新趋势异常失败"})
+		return
+	}
+	c.JSON(http.StatusOK, finding)
+}
+
+// AnalyzePatientVitals 立即检测患者的生理指标趋势，不等待后台定期检测，返回当前未关闭的异常
+func AnalyzePatientVitals(c *gin.Context) {
+	patient, ok := authorizePatient(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	findings, err := services.AnalyzePatientVitals(patient, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "检测生理指标趋势失败"})
+		return
+	}
+	c.JSON(http.StatusOK, findings)
+}
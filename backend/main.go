@@ -1,11 +1,18 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 	"we-dear/config"
 	"we-dear/handlers"
 	"we-dear/middleware"
+	"we-dear/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -20,6 +27,13 @@ func main() {
 	// 等待一下确保数据库连接完全建立
 	time.Sleep(time.Second)
 
+	// 初始化AI服务并启动AI任务队列
+	handlers.InitHandlers()
+
+	// 后台定期检测生理指标趋势异常
+	vitalAnalyzer := services.NewVitalAnomalyAnalyzer(time.Duration(config.GlobalConfig.Vital.Interval) * time.Minute)
+	vitalAnalyzer.Start()
+
 	router := gin.Default()
 
 	// 中间件
@@ -36,6 +50,21 @@ func main() {
 		// api.POST("/register", handlers.Register)
 	}
 
+	// 设备上传路由（设备凭据认证）
+	device := api.Group("/device")
+	device.Use(middleware.DeviceAuthRequired())
+	{
+		device.POST("/readings", handlers.IngestDeviceReadings)
+	}
+
+	// 浏览器无法设置请求头的流式接口，允许通过 token 查询参数认证
+	streaming := api.Group("")
+	streaming.Use(middleware.AuthRequiredAllowQueryToken())
+	{
+		streaming.GET("/chat/:patientId/suggestions/stream", handlers.StreamAISuggestions) // 流式获取 AI 建议（SSE）
+		streaming.GET("/chat/:patientId/ws", handlers.ChatSocket)                          // 实时聊天（WebSocket）
+	}
+
 	// 需要认证的路由
 	authorized := api.Group("")
 	authorized.Use(middleware.AuthRequired())
@@ -44,6 +73,9 @@ func main() {
 		authorized.GET("/patients", handlers.GetAllPatients)
 		authorized.GET("/patients/:id", handlers.GetPatientById)
 		authorized.GET("/patients/:id/followup", handlers.GetFollowUpRecords)
+		authorized.GET("/patients/:id/conversation-summary", handlers.GetConversationSummary)
+		authorized.PUT("/patients/:id/conversation-summary", handlers.UpdateConversationSummary)
+		authorized.POST("/patients/:id/conversation-summary/refresh", handlers.RefreshConversationSummary)
 		authorized.POST("/patients", handlers.CreatePatient)
 
 		// 医生相关
@@ -64,6 +96,8 @@ func main() {
 		authorized.POST("/chat/:patientId/doctor", handlers.SendDoctorMessage)    // 医生发送消息
 		authorized.POST("/chat/:patientId/patient", handlers.SendPatientMessage)  // 患者发送消息
 		authorized.GET("/chat/:patientId/suggestions", handlers.GetAISuggestions) // 获取 AI 建议
+		authorized.POST("/chat/:patientId/read", handlers.MarkChatRead)           // 标记已读
+		authorized.GET("/chat/:patientId/unread", handlers.GetChatUnread)         // 获取双方未读数量
 
 		// 用户认证相关
 		authorized.POST("/change-password", handlers.ChangePassword)
@@ -91,14 +125,42 @@ func main() {
 		authorized.DELETE("/ai-templates/:id", middleware.AdminRequired(), handlers.DeleteAITemplate)
 		authorized.POST("/ai-templates/:id/audit", middleware.AdminRequired(), handlers.AuditAITemplate)
 		authorized.GET("/ai-templates/category", handlers.GetAITemplatesByCategory)
+		authorized.GET("/ai-templates/variables", handlers.GetAITemplateVariables)
 
 		// AI建议评价相关路由
 		authorized.POST("/ai-suggestions/:id/feedback", handlers.CreateAISuggestionFeedback)
+		authorized.POST("/ai-suggestions/:id/safety-warnings/:warningId/acknowledge", handlers.AcknowledgeSafetyWarning)  // 确认用药安全警告
+		authorized.POST("/patients/:id/safety-warnings/:warningId/acknowledge", handlers.AcknowledgePatientSafetyWarning) // 确认医生自己撰写的消息的用药安全警告
 		authorized.PUT("/ai-suggestions/feedback/:id", handlers.UpdateAISuggestionFeedback)
 		authorized.GET("/ai-suggestions/feedback", handlers.GetAISuggestionFeedbacks)
 		authorized.POST("/ai-suggestions/feedback/:id/review", middleware.AdminRequired(), handlers.ReviewAISuggestionFeedback)
 		authorized.GET("/ai-suggestions/feedback/stats", handlers.GetFeedbackStats)
 
+		// AI任务相关路由
+		authorized.GET("/ai-jobs", handlers.GetAIJobs)
+		authorized.GET("/ai-jobs/:id", handlers.GetAIJobByID)
+		authorized.POST("/ai-jobs/:id/retry", handlers.RetryAIJob)
+
+		// AI供应商状态（故障转移链和熔断状态，仅管理员）
+		authorized.GET("/ai-providers/status", middleware.AdminRequired(), handlers.GetAIProviderStatus)
+
+		// AI用量、费用和月度预算（仅管理员）
+		authorized.GET("/ai-usage/report", middleware.AdminRequired(), handlers.GetAIUsageReport)
+		authorized.GET("/ai-usage/prices", middleware.AdminRequired(), handlers.GetAIModelPrices)
+		authorized.GET("/ai-usage/budgets", middleware.AdminRequired(), handlers.GetAIBudgets)
+		authorized.PUT("/ai-usage/budgets", middleware.AdminRequired(), handlers.SaveAIBudget)
+		authorized.DELETE("/ai-usage/budgets/:id", middleware.AdminRequired(), handlers.DeleteAIBudget)
+
+		// AI调用日志（仅管理员）
+		authorized.GET("/ai-call-logs", middleware.AdminRequired(), handlers.GetAICallLogs)
+		authorized.GET("/ai-call-logs/:id", middleware.AdminRequired(), handlers.GetAICallLogByID)
+
+		// 分诊与升级事件
+		authorized.GET("/escalations", handlers.GetEscalations)
+		authorized.POST("/escalations/:id/acknowledge", handlers.AcknowledgeEscalation)
+		authorized.POST("/escalations/:id/resolve", handlers.ResolveEscalation)
+		authorized.GET("/messages/:id/triage", handlers.GetMessageTriage)
+
 		// 医疗记录相关路由
 		authorized.GET("/patients/:id/medical", handlers.GetMedicalRecords)
 		authorized.POST("/medical", handlers.CreateMedicalRecord)
@@ -107,13 +169,49 @@ func main() {
 
 		// 生理数据相关路由
 		authorized.GET("/patients/:id/physiological", handlers.GetPhysiologicalData)
+		authorized.GET("/patients/:id/physiological/series", handlers.GetPhysiologicalSeries)
+		authorized.POST("/patients/:id/physiological/import", handlers.ImportPhysiologicalData)
+		authorized.GET("/patients/:id/vital-targets", handlers.GetVitalTargets)
+		authorized.PUT("/patients/:id/vital-targets", handlers.SaveVitalTarget)
+		authorized.DELETE("/patients/:id/vital-targets/:targetId", handlers.DeleteVitalTarget)
+		authorized.GET("/vital-alerts", handlers.GetVitalAlerts)
+		authorized.POST("/vital-alerts/:id/acknowledge", handlers.AcknowledgeVitalAlert)
+		authorized.POST("/patients/:id/vital-findings/analyze", handlers.AnalyzePatientVitals)
+		authorized.GET("/vital-findings", handlers.GetVitalFindings)
+		authorized.POST("/vital-findings/:id/acknowledge", handlers.AcknowledgeVitalFinding)
 		authorized.POST("/physiological", handlers.CreatePhysiologicalData)
 		authorized.PUT("/physiological/:id", handlers.UpdatePhysiologicalData)
 		authorized.DELETE("/physiological/:id", handlers.DeletePhysiologicalData)
+		authorized.GET("/physiological/pending", handlers.GetPendingPhysiologicalData)
+		authorized.POST("/physiological/:id/confirm", handlers.ConfirmPhysiologicalData)
+		authorized.POST("/physiological/:id/reject", handlers.RejectPhysiologicalData)
+
+		// 设备相关路由
+		authorized.GET("/patients/:id/devices", handlers.GetPatientDevices)
+		authorized.POST("/patients/:id/devices", handlers.RegisterDevice)
+		authorized.PUT("/devices/:id", handlers.UpdateDevice)
+		authorized.POST("/devices/:id/rotate-key", handlers.RotateDeviceKey)
 	}
 
-	log.Printf("Server starting on http://localhost:8080")
-	if err := router.Run(":8080"); err != nil {
-		log.Fatalf("Failed to start server: %v", err)
+	server := &http.Server{Addr: ":8080", Handler: router}
+	go func() {
+		log.Printf("Server starting on http://localhost:8080")
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Failed to start server: %v", err)
+		}
+	}()
+
+	// 收到退出信号后停止接收请求，再等待后台检测和AI任务完成
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	<-quit
+	log.Printf("Server shutting down")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
 	}
+	vitalAnalyzer.Stop()
+	handlers.ShutdownHandlers()
 }
@@ -9,8 +9,21 @@ import (
 )
 
 func AuthRequired() gin.HandlerFunc {
+	return authRequired(false)
+}
+
+// AuthRequiredAllowQueryToken 与 AuthRequired 相同，但允许通过 token 查询参数传递 token。
+// 只用于 EventSource、WebSocket 等无法设置请求头的浏览器接口，查询参数会出现在访问日志中，其他路由不要使用
+func AuthRequiredAllowQueryToken() gin.HandlerFunc {
+	return authRequired(true)
+}
+
+func authRequired(allowQueryToken bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		if allowQueryToken && authHeader == "" && c.Query("token") != "" {
+			authHeader = "Bearer " + c.Query("token")
+		}
 		if authHeader == "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "未登录"})
 			c.Abort()
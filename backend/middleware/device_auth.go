@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 签名请求的时间戳与服务器时间允许的最大偏差，超出时拒绝，防止重放
+const deviceSignatureWindow = 5 * time.Minute
+
+// MaxDeviceRequestSize 设备上传请求体的大小上限，一批 500 条读数远小于该值；
+// 校验签名前就要读取请求体，必须先限制大小
+const MaxDeviceRequestSize = 1 << 20
+
+// DeviceAuthRequired 设备认证：请求头 X-Device-ID 为登记的设备ID，
+// api_key 方式携带 X-API-Key，hmac 方式携带 X-Timestamp（Unix 秒）和 X-Signature
+func DeviceAuthRequired() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, MaxDeviceRequestSize)
+
+		deviceID := c.GetHeader("X-Device-ID")
+		if deviceID == "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "缺少设备ID"})
+			c.Abort()
+			return
+		}
+		device, err := storage.GetDeviceStorage().GetByID(deviceID)
+		if err != nil || device.Status != models.DeviceStatusActive {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "设备未登记或已停用"})
+			c.Abort()
+			return
+		}
+
+		switch device.AuthType {
+		case models.DeviceAuthAPIKey:
+			if !utils.VerifyDeviceKey(c.GetHeader("X-API-Key"), device.KeyHash) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "无效的设备凭据"})
+				c.Abort()
+				return
+			}
+		case models.DeviceAuthHMAC:
+			timestamp := c.GetHeader("X-Timestamp")
+			seconds, err := strconv.ParseInt(timestamp, 10, 64)
+			if err != nil || time.Since(time.Unix(seconds, 0)).Abs() > deviceSignatureWindow {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "请求时间戳无效或已过期"})
+				c.Abort()
+				return
+			}
+			// 读取请求体校验签名后放回，供处理函数解析
+			body, err := io.ReadAll(c.Request.Body)
+			if err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "请求数据过大"})
+					c.Abort()
+					return
+				}
+				c.JSON(http.StatusBadRequest, gin.H{"error": "读取请求失败"})
+				c.Abort()
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+			if !utils.VerifyDeviceSignature(device.Secret, timestamp, body, c.GetHeader("X-Signature")) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "签名无效"})
+				c.Abort()
+				return
+			}
+		default:
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "不支持的认证方式"})
+			c.Abort()
+			return
+		}
+
+		c.Set("deviceId", device.ID)
+		c.Set("device", device)
+		c.Next()
+	}
+}
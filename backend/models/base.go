@@ -1,6 +1,9 @@
 package models
 
 import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
 	"time"
 
 	"github.com/lib/pq"
@@ -85,33 +88,213 @@ type MedicalRecord struct {
 // Message 消息
 type Message struct {
 	BaseModel
-	PatientID string `json:"patientId"` // 患者ID
-	DoctorID  string `json:"doctorId"`  // 医生ID
-	RecordID  string `json:"recordId"`  // 关联的病历ID
-	Content   string `json:"content"`   // 消息内容
-	Type      string `json:"type"`      // 消息类型（文本/图片/语音等）
-	Role      string `json:"role"`      // 发送者角色（医生/患者）
-	Read      bool   `json:"read"`      // 是否已读
-	ReplyTo   string `json:"replyTo"`   // 回复的消息ID
+	PatientID string     `json:"patientId"`                     // 患者ID
+	DoctorID  string     `json:"doctorId"`                      // 医生ID
+	RecordID  string     `json:"recordId"`                      // 关联的病历ID
+	Content   string     `json:"content"`                       // 消息内容
+	Type      string     `json:"type"`                          // 消息类型（文本/图片/语音等）
+	Role      string     `json:"role"`                          // 发送者角色（医生/患者）
+	Read      bool       `json:"read"`                          // 接收方是否已读（医生消息由患者读，患者消息由医生读）
+	ReadAt    *time.Time `json:"readAt,omitempty"`              // 接收方已读时间
+	ReplyTo   string     `json:"replyTo"`                       // 回复的消息ID
+	Urgency   string     `json:"urgency" gorm:"default:normal"` // 分诊紧急程度（normal/urgent/critical）
 }
 
 // AISuggestion AI 建议
 type AISuggestion struct {
 	BaseModel
-	MessageID   string    `json:"messageId"`   // 关联的消息ID
-	PatientID   string    `json:"patientId"`   // 患者ID
-	Content     string    `json:"content"`     // 建议内容
-	PromptUsed  string    `json:"-"`           // 使用的提示词
-	ContextUsed string    `json:"-"`           // 使用的上下文
-	ModelUsed   string    `json:"-"`           // 使用的模型
-	Confidence  float64   `json:"confidence"`  // 置信度
-	Category    string    `json:"category"`    // 建议类别（用药/就医/生活等）
-	Priority    int       `json:"priority"`    // 优先级（1-5）
-	Status      string    `json:"status"`      // 状态（待审核/已采纳/已拒绝等）
-	ReviewedBy  string    `json:"reviewedBy"`  // 审核医生ID
-	ReviewedAt  time.Time `json:"reviewedAt"`  // 审核时间
-	ReviewNotes string    `json:"reviewNotes"` // 审核备注
+	MessageID       string    `json:"messageId"`       // 关联的消息ID
+	PatientID       string    `json:"patientId"`       // 患者ID
+	Content         string    `json:"content"`         // 建议内容
+	PromptUsed      string    `json:"-"`               // 使用的提示词
+	ContextUsed     string    `json:"-"`               // 使用的上下文
+	ModelUsed       string    `json:"-"`               // 使用的模型
+	TemplateID      string    `json:"templateId"`      // 使用的AI代理模板ID（内置模板为空）
+	TemplateVersion string    `json:"templateVersion"` // 使用的AI代理模板版本
+	CallLogID       string    `json:"callLogId"`       // 生成建议的调用日志ID，实际发送的提示见调用日志
+	Confidence      float64   `json:"confidence"`      // 置信度
+	Category        string    `json:"category"`        // 建议类别（用药/就医/生活等）
+	Priority        int       `json:"priority"`        // 优先级（1-5）
+	Rationale       string    `json:"rationale"`       // 模型给出的分类和优先级依据
+	Status          string    `json:"status"`          // 状态（待审核/已采纳/已拒绝等）
+	ReviewedBy      string    `json:"reviewedBy"`      // 审核医生ID
+	ReviewedAt      time.Time `json:"reviewedAt"`      // 审核时间
+	ReviewNotes     string    `json:"reviewNotes"`     // 审核备注
+	SafetyStatus    string    `json:"safetyStatus"`    // 用药安全检查结果（clear/warning/blocked）
 	// Embedding   []float32 `json:"-" gorm:"type:vector(1536)"`
+
+	Citations      []SuggestionCitation      `json:"citations,omitempty" gorm:"foreignKey:SuggestionID"`      // 引用的诊疗规范片段
+	SafetyWarnings []SuggestionSafetyWarning `json:"safetyWarnings,omitempty" gorm:"foreignKey:SuggestionID"` // 用药安全警告
+}
+
+// SuggestionSafetyWarning 用药安全警告，医生确认后才能发送包含该药物的消息；
+// 医生不采用AI建议、自己撰写的消息产生的警告没有 SuggestionID，发送后记录 MessageID
+type SuggestionSafetyWarning struct {
+	BaseModel
+	SuggestionID    string    `json:"suggestionId" gorm:"index"` // AI建议ID
+	PatientID       string    `json:"patientId" gorm:"index"`    // 患者ID
+	MessageID       string    `json:"messageId,omitempty"`       // 医生自己撰写时，确认后发送的消息ID
+	Type            string    `json:"type"`                      // 警告类型（allergy/contraindication）
+	Severity        string    `json:"severity"`                  // 严重程度（warning/block）
+	Drug            string    `json:"drug"`                      // 建议中提到的药物
+	Matched         string    `json:"matched"`                   // 匹配到的过敏史或病史
+	Message         string    `json:"message"`                   // 警告说明
+	AcknowledgedBy  string    `json:"acknowledgedBy"`            // 确认医生ID
+	AcknowledgedAt  time.Time `json:"acknowledgedAt"`            // 确认时间
+	AcknowledgeNote string    `json:"acknowledgeNote"`           // 确认说明（阻止级别的警告必填）
+}
+
+// SuggestionCitation AI建议引用的诊疗规范片段
+type SuggestionCitation struct {
+	BaseModel
+	SuggestionID  string  `json:"suggestionId" gorm:"index"` // AI建议ID
+	Index         int     `json:"index"`                     // 在提示中的编号（回复中以 [编号] 引用）
+	DocumentID    string  `json:"documentId"`                // 规范文档ID
+	DocumentTitle string  `json:"documentTitle"`             // 规范文档标题
+	ChunkID       string  `json:"chunkId"`                   // 片段ID
+	Heading       string  `json:"heading"`                   // 片段所在章节
+	Excerpt       string  `json:"excerpt" gorm:"type:text"`  // 片段内容
+	Score         float64 `json:"score"`                     // 检索相似度
+}
+
+// GuidelineDocument 导入的诊疗规范文档
+type GuidelineDocument struct {
+	BaseModel
+	Title      string `json:"title"`                     // 标题
+	Source     string `json:"source" gorm:"uniqueIndex"` // 来源文件路径
+	Checksum   string `json:"checksum"`                  // 文件内容的SHA-256，内容未变化时不重复导入
+	Embedder   string `json:"embedder"`                  // 生成向量使用的嵌入模型
+	ChunkCount int    `json:"chunkCount"`                // 片段数量
+}
+
+// GuidelineChunk 诊疗规范文档切分后的片段及其向量
+type GuidelineChunk struct {
+	BaseModel
+	DocumentID string          `json:"documentId" gorm:"index"`          // 文档ID
+	Seq        int             `json:"seq"`                              // 在文档中的顺序
+	Heading    string          `json:"heading"`                          // 所在章节标题
+	Content    string          `json:"content" gorm:"type:text"`         // 片段内容
+	Embedder   string          `json:"embedder" gorm:"index"`            // 嵌入模型
+	Embedding  pq.Float64Array `json:"-" gorm:"type:double precision[]"` // 向量（pgvector 可用时另存一份到 embedding_vec 列）
+}
+
+// TriageDecision 患者消息的分诊记录，每次规则或模型判断都会保存一条，便于审计
+type TriageDecision struct {
+	BaseModel
+	MessageID    string         `json:"messageId" gorm:"index"`          // 消息ID
+	PatientID    string         `json:"patientId" gorm:"index"`          // 患者ID
+	Source       string         `json:"source"`                          // 判断来源（rule/model）
+	Level        string         `json:"level"`                           // 判断结果（normal/urgent/critical）
+	MatchedRules pq.StringArray `json:"matchedRules" gorm:"type:text[]"` // 命中的红旗症状规则
+	Rationale    string         `json:"rationale"`                       // 判断依据
+	ModelUsed    string         `json:"modelUsed"`                       // 使用的模型（模型判断时）
+	Error        string         `json:"error"`                           // 判断失败时的错误信息
+}
+
+// Escalation 紧急消息升级事件，需要医生确认处理
+type Escalation struct {
+	BaseModel
+	PatientID      string    `json:"patientId" gorm:"index"` // 患者ID
+	DoctorID       string    `json:"doctorId" gorm:"index"`  // 主治医生ID
+	MessageID      string    `json:"messageId" gorm:"index"` // 触发升级的消息ID
+	Level          string    `json:"level"`                  // 紧急程度（urgent/critical）
+	Reason         string    `json:"reason"`                 // 升级原因
+	Status         string    `json:"status" gorm:"index"`    // 状态（open/acknowledged/resolved）
+	AcknowledgedBy string    `json:"acknowledgedBy"`         // 确认医生ID
+	AcknowledgedAt time.Time `json:"acknowledgedAt"`         // 确认时间
+	ResolvedBy     string    `json:"resolvedBy"`             // 处理完成的医生ID
+	ResolvedAt     time.Time `json:"resolvedAt"`             // 处理完成时间
+}
+
+// ConversationSummary 患者对话摘要，每个患者一条，新消息累计到一定数量后由AI增量更新，医生可以修正
+type ConversationSummary struct {
+	BaseModel
+	PatientID     string    `json:"patientId" gorm:"uniqueIndex"` // 患者ID
+	Content       string    `json:"content" gorm:"type:text"`     // 摘要内容
+	LastMessageID string    `json:"lastMessageId"`                // 已纳入摘要的最后一条消息ID
+	LastMessageAt time.Time `json:"lastMessageAt"`                // 已纳入摘要的最后一条消息时间
+	MessageCount  int       `json:"messageCount"`                 // 已纳入摘要的消息数量
+	Version       int       `json:"version"`                      // 版本号，每次AI更新或医生修正加1
+	ModelUsed     string    `json:"modelUsed"`                    // 最近一次更新使用的模型
+	EditedBy      string    `json:"editedBy"`                     // 最近一次修正的医生ID
+	EditedAt      time.Time `json:"editedAt"`                     // 最近一次修正时间
+}
+
+// AICallLog 大模型调用日志，记录每次调用实际发送的提示和收到的回复；
+// 发往 RedactExemptProviders 中供应商的内容未经脱敏，记录的是含患者隐私的原文
+type AICallLog struct {
+	BaseModel
+	Purpose          string  `json:"purpose" gorm:"index"`      // 调用用途（suggestion/stream/classify/triage/extract）
+	PatientID        string  `json:"patientId" gorm:"index"`    // 患者ID
+	MessageID        string  `json:"messageId" gorm:"index"`    // 消息ID
+	Provider         string  `json:"provider"`                  // 供应商
+	Model            string  `json:"model"`                     // 模型
+	Attempt          int     `json:"attempt"`                   // 该供应商的第几次尝试（从1开始）
+	TemplateID       string  `json:"templateId"`                // AI代理模板ID
+	TemplateVersion  string  `json:"templateVersion"`           // AI代理模板版本
+	Prompt           string  `json:"prompt" gorm:"type:text"`   // 发送的消息列表（JSON）
+	Response         string  `json:"response" gorm:"type:text"` // 模型返回的原始内容
+	Redacted         bool    `json:"redacted"`                  // 是否经过隐私脱敏
+	LatencyMs        int64   `json:"latencyMs"`                 // 耗时（毫秒）
+	PromptTokens     int     `json:"promptTokens"`              // 输入token数
+	CompletionTokens int     `json:"completionTokens"`          // 输出token数
+	Cost             float64 `json:"cost"`                      // 按价格表计算的费用（元）
+	DoctorID         string  `json:"doctorId" gorm:"index"`     // 患者的主治医生ID
+	DepartmentID     string  `json:"departmentId"`              // 主治医生所属科室ID
+	Error            string  `json:"error"`                     // 调用失败时的错误信息
+}
+
+// TableName 调用日志表名
+func (AICallLog) TableName() string {
+	return "ai_call_log"
+}
+
+// AIUsageDaily 每日AI用量汇总，按医生、科室、患者、模板、用途和模型分别累计
+type AIUsageDaily struct {
+	BaseModel
+	Day              string  `json:"day" gorm:"uniqueIndex:idx_ai_usage_daily_key;index"`    // 日期（2006-01-02）
+	DoctorID         string  `json:"doctorId" gorm:"uniqueIndex:idx_ai_usage_daily_key"`     // 主治医生ID
+	DepartmentID     string  `json:"departmentId" gorm:"uniqueIndex:idx_ai_usage_daily_key"` // 科室ID
+	PatientID        string  `json:"patientId" gorm:"uniqueIndex:idx_ai_usage_daily_key"`    // 患者ID
+	TemplateID       string  `json:"templateId" gorm:"uniqueIndex:idx_ai_usage_daily_key"`   // AI代理模板ID（内置模板为空）
+	Purpose          string  `json:"purpose" gorm:"uniqueIndex:idx_ai_usage_daily_key"`      // 调用用途
+	Provider         string  `json:"provider" gorm:"uniqueIndex:idx_ai_usage_daily_key"`     // 供应商
+	Model            string  `json:"model" gorm:"uniqueIndex:idx_ai_usage_daily_key"`        // 模型
+	Calls            int     `json:"calls"`                                                  // 调用次数
+	FailedCalls      int     `json:"failedCalls"`                                            // 失败次数
+	PromptTokens     int64   `json:"promptTokens"`                                           // 输入token数
+	CompletionTokens int64   `json:"completionTokens"`                                       // 输出token数
+	Cost             float64 `json:"cost"`                                                   // 费用（元）
+}
+
+// TableName 每日用量表名
+func (AIUsageDaily) TableName() string {
+	return "ai_usage_daily"
+}
+
+// AIBudget AI费用的月度预算，超出后暂停非必要的AI任务（如对话摘要）
+type AIBudget struct {
+	BaseModel
+	Scope        string  `json:"scope" gorm:"uniqueIndex:idx_ai_budget_scope"`   // 范围（global/department/doctor）
+	ScopeID      string  `json:"scopeId" gorm:"uniqueIndex:idx_ai_budget_scope"` // 科室或医生ID，全局预算为空
+	MonthlyLimit float64 `json:"monthlyLimit"`                                   // 每月费用上限（元）
+	UpdatedBy    string  `json:"updatedBy"`                                      // 最后修改人ID
+}
+
+// AIJob AI处理任务（持久化的任务队列）
+type AIJob struct {
+	BaseModel
+	Type        string    `json:"type" gorm:"index"`      // 任务类型
+	MessageID   string    `json:"messageId" gorm:"index"` // 关联的消息ID
+	PatientID   string    `json:"patientId" gorm:"index"` // 患者ID
+	Status      string    `json:"status" gorm:"index"`    // 状态（queued/running/paused/succeeded/failed）
+	Attempts    int       `json:"attempts"`               // 已执行次数
+	MaxAttempts int       `json:"maxAttempts"`            // 最大执行次数
+	NextRunAt   time.Time `json:"nextRunAt" gorm:"index"` // 下次可执行时间
+	StartedAt   time.Time `json:"startedAt"`              // 最近一次开始时间
+	FinishedAt  time.Time `json:"finishedAt"`             // 完成时间
+	LastError   string    `json:"lastError"`              // 最近一次错误信息
+	ResultID    string    `json:"resultId"`               // 执行结果ID（如生成的AI建议ID）
 }
 
 // Attachment 附件（检查报告、图片等）
@@ -187,14 +370,138 @@ type AISuggestionFeedback struct {
 	Status       string    `json:"status"`                    // 状态（待审核/已通过/已拒绝）
 }
 
+// VitalTarget 患者某项生理指标的目标范围，覆盖按慢性病和测量类型设定的默认范围
+type VitalTarget struct {
+	BaseModel
+	PatientID    string   `json:"patientId" gorm:"uniqueIndex:idx_vital_target_key"` // 患者ID
+	Type         string   `json:"type" gorm:"uniqueIndex:idx_vital_target_key"`      // 数据类型
+	Context      string   `json:"context" gorm:"uniqueIndex:idx_vital_target_key"`   // 测量场景，为空表示不区分
+	Field        string   `json:"field" gorm:"uniqueIndex:idx_vital_target_key"`     // 数值字段（如 systolic）
+	Low          float64  `json:"low"`                                               // 目标范围下限
+	High         float64  `json:"high"`                                              // 目标范围上限
+	CriticalLow  *float64 `json:"criticalLow"`                                       // 低于该值为危急，为空表示不设
+	CriticalHigh *float64 `json:"criticalHigh"`                                      // 高于该值为危急，为空表示不设
+	UpdatedBy    string   `json:"updatedBy"`                                         // 最后修改的医生ID
+}
+
+// VitalAlert 生理数据超出目标范围的提醒，每个超出范围的数值字段一条
+type VitalAlert struct {
+	BaseModel
+	PatientID      string    `json:"patientId" gorm:"index"` // 患者ID
+	DoctorID       string    `json:"doctorId" gorm:"index"`  // 主治医生ID
+	DataID         string    `json:"dataId" gorm:"index"`    // 触发提醒的生理数据ID
+	Type           string    `json:"type"`                   // 数据类型
+	Context        string    `json:"context"`                // 测量场景
+	Field          string    `json:"field"`                  // 数值字段
+	Value          float64   `json:"value"`                  // 读数
+	Low            float64   `json:"low"`                    // 评估时的目标范围下限
+	High           float64   `json:"high"`                   // 评估时的目标范围上限
+	Direction      string    `json:"direction"`              // 偏低或偏高（low/high）
+	Severity       string    `json:"severity" gorm:"index"`  // 严重程度（warning/critical）
+	TargetSource   string    `json:"targetSource"`           // 目标范围来源（patient/protocol/default）
+	Message        string    `json:"message"`                // 提醒内容
+	MeasuredAt     time.Time `json:"measuredAt"`             // 测量时间
+	Status         string    `json:"status" gorm:"index"`    // 状态（open/acknowledged/dismissed）
+	AcknowledgedBy string    `json:"acknowledgedBy"`         // 确认医生ID
+	AcknowledgedAt time.Time `json:"acknowledgedAt"`         // 确认时间
+}
+
+// VitalFinding 生理指标趋势异常：持续漂移、单次突变或测量中断，由后台检测产生，
+// 同一指标的同类异常只保留一条，异常消失后自动关闭
+type VitalFinding struct {
+	BaseModel
+	PatientID      string    `json:"patientId" gorm:"index"` // 患者ID
+	DoctorID       string    `json:"doctorId" gorm:"index"`  // 主治医生ID
+	Type           string    `json:"type"`                   // 数据类型
+	Context        string    `json:"context"`                // 测量场景
+	Field          string    `json:"field"`                  // 数值字段，测量中断时为空
+	Kind           string    `json:"kind" gorm:"index"`      // 异常类型（drift/jump/gap）
+	Baseline       float64   `json:"baseline"`               // 基线均值；测量中断时为平时的测量间隔（天）
+	Current        float64   `json:"current"`                // 近期均值或突变读数；测量中断时为距上次测量的天数
+	ChangePercent  float64   `json:"changePercent"`          // 相对基线的变化百分比，上升为正
+	DataID         string    `json:"dataId"`                 // 突变读数的生理数据ID
+	WindowStart    time.Time `json:"windowStart"`            // 统计窗口开始时间；测量中断时为上次测量时间
+	WindowEnd      time.Time `json:"windowEnd"`              // 统计窗口结束时间
+	SampleCount    int       `json:"sampleCount"`            // 参与统计的读数数量
+	Message        string    `json:"message"`                // 异常说明
+	Status         string    `json:"status" gorm:"index"`    // 状态（open/acknowledged/resolved）
+	AcknowledgedBy string    `json:"acknowledgedBy"`         // 确认医生ID
+	AcknowledgedAt time.Time `json:"acknowledgedAt"`         // 确认时间
+	ResolvedAt     time.Time `json:"resolvedAt"`             // 异常消失时间
+}
+
+// VitalComponents 生理数据的数值分量（如血压的 systolic、diastolic），以 JSONB 保存，
+// 可在SQL中按分量查询，如 (components->>'systolic')::numeric >= 140
+type VitalComponents map[string]float64
+
+// Value 实现 driver.Valuer
+func (c VitalComponents) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
+// Scan 实现 sql.Scanner
+func (c *VitalComponents) Scan(value interface{}) error {
+	var data []byte
+	switch v := value.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case []byte:
+		data = v
+	case string:
+		data = []byte(v)
+	default:
+		return fmt.Errorf("无法将 %T 转换为 VitalComponents", value)
+	}
+	return json.Unmarshal(data, c)
+}
+
 // PhysiologicalData 生理数据记录
 type PhysiologicalData struct {
 	BaseModel
-	PatientID  string    `json:"patientId" gorm:"index"`  // 患者ID
-	Type       string    `json:"type" gorm:"index"`       // 数据类型(blood_pressure/blood_sugar等)
-	Value      string    `json:"value"`                   // 数据值
-	MeasuredAt time.Time `json:"measuredAt"`              // 测量时间
-	Notes      string    `json:"notes"`                   // 备注
-	Source     string    `json:"source"`                  // 数据来源(手动录入/设备上传/AI提取)
-	DeviceInfo string    `json:"deviceInfo"`              // 设备信息(如果是设备上传)
+	PatientID  string          `json:"patientId" gorm:"index;index:idx_physiological_series,priority:1"` // 患者ID
+	Type       string          `json:"type" gorm:"index;index:idx_physiological_series,priority:2"`      // 数据类型(blood_pressure/blood_sugar等)
+	Value      string          `json:"value"`                                                            // 数据值（文本形式，如 120/80、6.5-空腹，由数值分量生成）
+	Components VitalComponents `json:"components" gorm:"type:jsonb"`                                     // 数值分量，字段见测量类型定义
+	Unit       string          `json:"unit"`                                                             // 单位
+	Context    string          `json:"context"`                                                          // 测量场景（如空腹/餐后）
+	MeasuredAt time.Time       `json:"measuredAt" gorm:"index:idx_physiological_series,priority:3"`      // 测量时间
+	Notes      string          `json:"notes"`                                                            // 备注
+	Source     string          `json:"source"`                                                           // 数据来源(手动录入/设备上传/AI提取)
+	DeviceInfo string          `json:"deviceInfo"`                                                       // 设备信息(如果是设备上传)
+
+	// 旧数据迁移（tools/migrate_vital_components.go）时无法解析为数值分量的原因，记录后不再重试
+	ComponentsError string `json:"componentsError,omitempty"`
+
+	// AI提取的数据需要医生确认后才计入趋势分析
+	Status         string    `json:"status" gorm:"index;default:confirmed"` // 状态（pending/confirmed/rejected）
+	MessageID      string    `json:"messageId" gorm:"index"`                // AI提取的来源消息ID
+	ExtractedValue string    `json:"extractedValue"`                        // AI提取的原始值，医生修正后用于对比
+	ReviewedBy     string    `json:"reviewedBy"`                            // 确认或驳回的医生ID
+	ReviewedAt     time.Time `json:"reviewedAt"`                            // 确认或驳回时间
+	ReviewNote     string    `json:"reviewNote"`                            // 确认说明或驳回原因
+
+	// 设备上传的数据按设备和幂等键去重，设备重发同一批数据不会重复保存
+	DeviceID       string `json:"deviceId" gorm:"index;uniqueIndex:idx_physiological_idempotency,where:idempotency_key <> ''"` // 上传设备ID
+	IdempotencyKey string `json:"idempotencyKey" gorm:"uniqueIndex:idx_physiological_idempotency,where:idempotency_key <> ''"` // 设备生成的幂等键
+}
+
+// Device 患者的家用测量设备（血压计、血糖仪等），凭 API Key 或 HMAC 签名直接上传测量数据
+type Device struct {
+	BaseModel
+	SerialNumber string    `json:"serialNumber" gorm:"uniqueIndex"` // 设备序列号
+	Manufacturer string    `json:"manufacturer"`                    // 厂商
+	Model        string    `json:"model"`                           // 型号
+	PatientID    string    `json:"patientId" gorm:"index"`          // 所属患者ID
+	AuthType     string    `json:"authType"`                        // 认证方式（api_key/hmac）
+	KeyPrefix    string    `json:"keyPrefix"`                       // 凭据前几位，用于核对设备
+	KeyHash      string    `json:"-"`                               // API Key 的哈希
+	Secret       string    `json:"-"`                               // HMAC 密钥，校验签名需要原文
+	Status       string    `json:"status" gorm:"index"`             // 状态（active/disabled）
+	RegisteredBy string    `json:"registeredBy"`                    // 登记的医生ID
+	LastSeenAt   time.Time `json:"lastSeenAt"`                      // 最近一次上传时间
 }
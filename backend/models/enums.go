@@ -36,6 +36,87 @@ const (
 	MessageRoleSystem  = "system"
 )
 
+// 消息紧急程度（分诊结果）
+const (
+	MessageUrgencyNormal   = "normal"   // 普通
+	MessageUrgencyUrgent   = "urgent"   // 紧急
+	MessageUrgencyCritical = "critical" // 危急
+)
+
+// 分诊判断来源
+const (
+	TriageSourceRule  = "rule"  // 红旗症状规则
+	TriageSourceModel = "model" // 大模型判断
+)
+
+// 升级事件状态
+const (
+	EscalationStatusOpen         = "open"         // 待处理
+	EscalationStatusAcknowledged = "acknowledged" // 已确认
+	EscalationStatusResolved     = "resolved"     // 已处理
+)
+
+// 生理数据状态
+const (
+	PhysiologicalStatusPending   = "pending"   // AI提取，待医生确认
+	PhysiologicalStatusConfirmed = "confirmed" // 已确认（手动录入和设备上传的数据直接为已确认）
+	PhysiologicalStatusRejected  = "rejected"  // 已驳回
+)
+
+// 生理数据来源
+const (
+	PhysiologicalSourceManual    = "manual"     // 手动录入
+	PhysiologicalSourceDevice    = "device"     // 设备上传
+	PhysiologicalSourceAIExtract = "ai_extract" // AI从聊天记录中提取
+	PhysiologicalSourceImport    = "import"     // 从 Open mHealth、FHIR 文件导入
+)
+
+// 设备认证方式
+const (
+	DeviceAuthAPIKey = "api_key" // 请求头携带 API Key
+	DeviceAuthHMAC   = "hmac"    // 用密钥对请求签名
+)
+
+// 设备状态
+const (
+	DeviceStatusActive   = "active"   // 可上传数据
+	DeviceStatusDisabled = "disabled" // 已停用，拒绝上传
+)
+
+// 生理指标提醒严重程度
+const (
+	VitalAlertSeverityWarning  = "warning"  // 超出目标范围
+	VitalAlertSeverityCritical = "critical" // 超出危急范围
+)
+
+// 生理指标提醒状态
+const (
+	VitalAlertStatusOpen         = "open"         // 待处理
+	VitalAlertStatusAcknowledged = "acknowledged" // 医生已确认
+	VitalAlertStatusDismissed    = "dismissed"    // 数据被驳回或修正，提醒作废
+)
+
+// 生理指标趋势异常类型
+const (
+	VitalFindingKindDrift = "drift" // 近期均值持续偏离基线
+	VitalFindingKindJump  = "jump"  // 单次读数明显偏离基线
+	VitalFindingKindGap   = "gap"   // 测量中断
+)
+
+// 生理指标趋势异常状态
+const (
+	VitalFindingStatusOpen         = "open"         // 待处理
+	VitalFindingStatusAcknowledged = "acknowledged" // 医生已确认，异常仍存在
+	VitalFindingStatusResolved     = "resolved"     // 异常已消失
+)
+
+// 目标范围来源
+const (
+	VitalTargetSourcePatient  = "patient"  // 医生为患者设置
+	VitalTargetSourceProtocol = "protocol" // 按慢性病设定
+	VitalTargetSourceDefault  = "default"  // 测量类型的默认范围
+)
+
 // AI建议类别
 const (
 	AISuggestionCategoryMedication = "medication" // 用药建议
@@ -51,6 +132,32 @@ const (
 	AISuggestionStatusRejected = "rejected" // 已拒绝
 )
 
+// AI预算范围
+const (
+	AIBudgetScopeGlobal     = "global"     // 全院
+	AIBudgetScopeDepartment = "department" // 科室
+	AIBudgetScopeDoctor     = "doctor"     // 医生
+)
+
+// AI建议用药安全检查结果
+const (
+	AISuggestionSafetyClear   = "clear"   // 未发现问题
+	AISuggestionSafetyWarning = "warning" // 有需要确认的警告
+	AISuggestionSafetyBlocked = "blocked" // 有阻止级别的警告
+)
+
+// 用药安全警告类型
+const (
+	SafetyWarningTypeAllergy          = "allergy"          // 药物过敏
+	SafetyWarningTypeContraindication = "contraindication" // 禁忌或慎用
+)
+
+// 用药安全警告严重程度
+const (
+	SafetySeverityWarning = "warning" // 慎用，确认后可发送
+	SafetySeverityBlock   = "block"   // 禁用，需填写说明确认后才能发送
+)
+
 // AI建议优先级
 const (
 	AISuggestionPriorityLow      = 1 // 低优先级
@@ -60,6 +167,32 @@ const (
 	AISuggestionPriorityCritical = 5 // 危急
 )
 
+// AI任务类型
+const (
+	AIJobTypeSuggestion = "suggestion" // 生成AI建议
+	AIJobTypeSummary    = "summary"    // 更新患者对话摘要
+)
+
+// AI任务状态
+const (
+	AIJobStatusQueued    = "queued"    // 排队中
+	AIJobStatusRunning   = "running"   // 执行中
+	AIJobStatusPaused    = "paused"    // 月度预算用完，暂停到下次检查
+	AIJobStatusSucceeded = "succeeded" // 成功
+	AIJobStatusFailed    = "failed"    // 失败（已用完重试次数）
+)
+
+// AI调用用途
+const (
+	AICallPurposeSuggestion = "suggestion" // 生成AI建议
+	AICallPurposeStream     = "stream"     // 流式生成AI建议
+	AICallPurposeClassify   = "classify"   // 流式回复的分类
+	AICallPurposeTriage     = "triage"     // 模型分诊
+	AICallPurposeExtract    = "extract"    // 提取生理数据
+	AICallPurposeSummary    = "summary"    // 更新对话摘要
+	AICallPurposeEmbedding  = "embedding"  // 诊疗规范导入和检索的文本向量化
+)
+
 // 病历状态
 const (
 	MedicalRecordStatusInProgress = "in_progress" // 进行中
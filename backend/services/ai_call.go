@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+)
+
+// aiCall 一次模型调用的用途和关联对象，用于隐私脱敏和调用日志
+type aiCall struct {
+	Purpose   string
+	Patient   *models.Patient
+	MessageID string
+	Template  *PromptTemplate
+}
+
+// chat 调用供应商生成回复，失败时按重试策略重试并切换备用供应商；
+// 按配置对患者隐私信息脱敏并在回复中还原，每次请求都会记录调用日志
+func (s *AIService) chat(ctx context.Context, call aiCall, req ChatRequest) (*ChatResponse, error) {
+	return s.withFailover(ctx, func(ctx context.Context, provider ChatProvider, attempt int) (*ChatResponse, error) {
+		sent, redactor := prepareRequest(provider, call, req)
+
+		start := time.Now()
+		resp, err := provider.CreateChatCompletion(ctx, sent)
+		s.recordCall(provider, call, attempt, sent, redactor != nil, resp, err, time.Since(start))
+		if err != nil {
+			return nil, err
+		}
+
+		if redactor != nil {
+			if req.JSONMode {
+				resp.Content = redactor.RestoreJSON(resp.Content)
+			} else {
+				resp.Content = redactor.Restore(resp.Content)
+			}
+		}
+		return resp, nil
+	}, nil)
+}
+
+// chatStream 流式调用供应商，脱敏和日志规则与 chat 相同，推送给调用方的内容已还原。
+// 单次请求的超时按两段内容之间的间隔计算，输出较慢但持续有内容时不会被中断；
+// 只有在还没有输出任何内容时才会重试或切换供应商，避免调用方收到重复内容
+func (s *AIService) chatStream(ctx context.Context, call aiCall, req ChatRequest, onDelta func(delta string)) (*ChatResponse, error) {
+	started := false
+	emit := func(delta string) {
+		started = true
+		onDelta(delta)
+	}
+
+	return s.withFailover(ctx, func(ctx context.Context, provider ChatProvider, attempt int) (*ChatResponse, error) {
+		sent, redactor := prepareRequest(provider, call, req)
+
+		deltaFn, flush := emit, func() {}
+		if redactor != nil {
+			deltaFn, flush = redactor.restoreStream(emit)
+		}
+
+		var streamed strings.Builder
+		start := time.Now()
+		resp, err := streamWithIdleTimeout(ctx, provider, sent, s.attemptTimeout, func(delta string) {
+			streamed.WriteString(delta)
+			deltaFn(delta)
+		})
+		logged := resp
+		if err != nil && streamed.Len() > 0 {
+			logged = partialStreamResponse(sent, streamed.String())
+		}
+		s.recordCall(provider, call, attempt, sent, redactor != nil, logged, err, time.Since(start))
+		if err != nil {
+			return nil, err
+		}
+
+		if redactor != nil {
+			flush()
+			resp.Content = redactor.Restore(resp.Content)
+		}
+		return resp, nil
+	}, func() bool { return started })
+}
+
+// streamWithIdleTimeout 流式调用供应商，超过 idle 没有收到新内容时中断并返回 ErrStreamIdle
+func streamWithIdleTimeout(ctx context.Context, provider ChatProvider, req ChatRequest, idle time.Duration, onDelta func(delta string)) (*ChatResponse, error) {
+	streamCtx, touch, stop := withIdleTimeout(ctx, idle)
+	defer stop()
+
+	resp, err := StreamChatCompletion(streamCtx, provider, req, func(delta string) {
+		touch()
+		onDelta(delta)
+	})
+	if err != nil && ctx.Err() == nil && errors.Is(context.Cause(streamCtx), ErrStreamIdle) {
+		return nil, fmt.Errorf("%w（%v）", ErrStreamIdle, err)
+	}
+	return resp, err
+}
+
+// partialStreamResponse 中途失败的流式调用已经输出的内容，供应商同样会计费，
+// 按已发送的消息和已输出的内容估算token数，不记为0
+func partialStreamResponse(sent ChatRequest, content string) *ChatResponse {
+	promptTokens := 0
+	for _, msg := range sent.Messages {
+		promptTokens += EstimateTokens(msg.Content)
+	}
+	return &ChatResponse{
+		Content:          content,
+		PromptTokens:     promptTokens,
+		CompletionTokens: EstimateTokens(content),
+	}
+}
+
+// prepareRequest 返回实际发送给供应商的请求，不需要脱敏时 Redactor 为 nil
+func prepareRequest(provider ChatProvider, call aiCall, req ChatRequest) (ChatRequest, *Redactor) {
+	if !shouldRedact(provider) {
+		return req, nil
+	}
+	redactor := NewPatientRedactor(call.Patient)
+	return redactor.RedactRequest(req), redactor
+}
+
+// recordCall 保存调用日志并累加每日用量，记录的是实际发送和收到的内容；保存失败只打印错误
+func (s *AIService) recordCall(provider ChatProvider, call aiCall, attempt int, sent ChatRequest, redacted bool, resp *ChatResponse, callErr error, latency time.Duration) {
+	prompt, _ := json.Marshal(sent.Messages)
+	now := time.Now()
+	entry := &models.AICallLog{
+		BaseModel: models.BaseModel{
+			ID:        utils.GenerateID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Purpose:   call.Purpose,
+		MessageID: call.MessageID,
+		Provider:  provider.Name(),
+		Model:     modelName(resp, provider),
+		Attempt:   attempt,
+		Prompt:    string(prompt),
+		Redacted:  redacted,
+		LatencyMs: latency.Milliseconds(),
+	}
+	if call.Patient != nil {
+		entry.PatientID = call.Patient.ID
+		entry.DoctorID, entry.DepartmentID = usageOwner(call.Patient)
+	}
+	if call.Template != nil {
+		entry.TemplateID = call.Template.ID
+		entry.TemplateVersion = call.Template.Version
+	}
+	if resp != nil {
+		entry.Response = resp.Content
+		entry.PromptTokens = resp.PromptTokens
+		entry.CompletionTokens = resp.CompletionTokens
+		entry.Cost = CallCost(ModelPrices(), entry.Model, resp.PromptTokens, resp.CompletionTokens)
+	}
+	if callErr != nil {
+		entry.Error = callErr.Error()
+	}
+
+	if err := storage.GetAICallLogStorage().Create(entry); err != nil {
+		log.Printf("保存AI调用日志失败 (用途: %s, MessageID: %s): %v", call.Purpose, call.MessageID, err)
+	} else if resp != nil {
+		resp.CallLogID = entry.ID
+	}
+	recordUsage(entry)
+}
@@ -0,0 +1,339 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+)
+
+const (
+	aiJobPollInterval = 2 * time.Second  // 没有新任务通知时的轮询间隔
+	aiJobWaitInterval = time.Second      // 流式接口等待 worker 执行结果时的轮询间隔
+	aiJobBaseBackoff  = 5 * time.Second  // 首次重试等待时间，之后每次翻倍
+	aiJobMaxBackoff   = 10 * time.Minute // 重试等待时间上限
+)
+
+// AIJobHandler 执行一种类型的任务，返回结果ID（如生成的AI建议ID）
+type AIJobHandler func(job *models.AIJob) (resultID string, err error)
+
+// AIJobQueue 基于数据库的AI任务队列：任务先持久化再由固定数量的 worker 执行，
+// 失败按指数退避重试，超过次数后标记为失败，进程重启后未完成的任务会继续执行；
+// 月度预算用完时非必要任务暂停，预算恢复后继续执行
+type AIJobQueue struct {
+	aiService   *AIService
+	workers     int
+	maxAttempts int
+	handlers    map[string]AIJobHandler
+	notify      chan struct{}
+	stop        chan struct{}
+	wg          sync.WaitGroup
+}
+
+// NewAIJobQueue 创建任务队列，并注册生成AI建议的任务处理器
+func NewAIJobQueue(aiService *AIService, workers int, maxAttempts int) *AIJobQueue {
+	if workers <= 0 {
+		workers = 1
+	}
+	if maxAttempts <= 0 {
+		maxAttempts = 1
+	}
+	q := &AIJobQueue{
+		aiService:   aiService,
+		workers:     workers,
+		maxAttempts: maxAttempts,
+		handlers:    map[string]AIJobHandler{},
+		notify:      make(chan struct{}, 1),
+		stop:        make(chan struct{}),
+	}
+	q.Handle(models.AIJobTypeSuggestion, func(job *models.AIJob) (string, error) {
+		suggestion, err := aiService.ProcessMessage(job.MessageID)
+		if err != nil {
+			return "", err
+		}
+		q.suggestionReady(suggestion)
+		return suggestion.ID, nil
+	})
+	q.Handle(models.AIJobTypeSummary, func(job *models.AIJob) (string, error) {
+		summary, err := aiService.UpdateConversationSummary(job.PatientID)
+		if err != nil {
+			return "", err
+		}
+		if summary == nil {
+			return "", nil
+		}
+		return summary.ID, nil
+	})
+	return q
+}
+
+// Handle 注册某种任务类型的处理器，需在 Start 之前调用
+func (q *AIJobQueue) Handle(jobType string, handler AIJobHandler) {
+	q.handlers[jobType] = handler
+}
+
+// Start 恢复重启前未完成的任务并启动 worker
+func (q *AIJobQueue) Start() {
+	if n, err := storage.GetAIJobStorage().ResetRunning(); err != nil {
+		log.Printf("恢复AI任务失败: %v", err)
+	} else if n > 0 {
+		log.Printf("已重新排队 %d 个未完成的AI任务", n)
+	}
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	log.Printf("AI任务队列已启动: workers=%d maxAttempts=%d", q.workers, q.maxAttempts)
+}
+
+// Stop 停止领取新任务并等待执行中的任务完成
+func (q *AIJobQueue) Stop() {
+	close(q.stop)
+	q.wg.Wait()
+}
+
+// Enqueue 持久化一个新任务并唤醒 worker
+func (q *AIJobQueue) Enqueue(jobType string, patientID string, messageID string) (*models.AIJob, error) {
+	now := time.Now()
+	job := &models.AIJob{
+		BaseModel: models.BaseModel{
+			ID:        utils.GenerateID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Type:        jobType,
+		MessageID:   messageID,
+		PatientID:   patientID,
+		Status:      models.AIJobStatusQueued,
+		MaxAttempts: q.maxAttempts,
+		NextRunAt:   now,
+	}
+	if err := storage.GetAIJobStorage().Create(job); err != nil {
+		return nil, err
+	}
+	q.wake()
+	return job, nil
+}
+
+// EnqueueSummaryIfDue 新消息累计达到 AI_SUMMARY_EVERY 条且没有待执行的摘要任务时，创建摘要更新任务
+func (q *AIJobQueue) EnqueueSummaryIfDue(patientID string) {
+	due, err := ConversationSummaryDue(patientID)
+	if err != nil {
+		log.Printf("检查对话摘要状态失败 (PatientID: %s): %v", patientID, err)
+		return
+	}
+	if !due {
+		return
+	}
+	if _, err := q.EnqueueSummary(patientID); err != nil {
+		log.Printf("创建对话摘要任务失败 (PatientID: %s): %v", patientID, err)
+	}
+}
+
+// EnqueueSummary 创建摘要更新任务，已有待执行的任务时直接返回 nil
+func (q *AIJobQueue) EnqueueSummary(patientID string) (*models.AIJob, error) {
+	pending, err := storage.GetAIJobStorage().HasPending(models.AIJobTypeSummary, patientID)
+	if err != nil {
+		return nil, err
+	}
+	if pending {
+		return nil, nil
+	}
+	return q.Enqueue(models.AIJobTypeSummary, patientID, "")
+}
+
+// Retry 将任务重新排队执行
+func (q *AIJobQueue) Retry(id string) (*models.AIJob, error) {
+	jobStorage := storage.GetAIJobStorage()
+	job, err := jobStorage.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if job.Status == models.AIJobStatusRunning {
+		return nil, fmt.Errorf("任务正在执行中")
+	}
+	if err := jobStorage.Requeue(id); err != nil {
+		return nil, err
+	}
+	q.wake()
+	return jobStorage.GetByID(id)
+}
+
+func (q *AIJobQueue) wake() {
+	select {
+	case q.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (q *AIJobQueue) work() {
+	defer q.wg.Done()
+	ticker := time.NewTicker(aiJobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		// 连续处理直到没有到期任务
+		for q.runNext() {
+			select {
+			case <-q.stop:
+				return
+			default:
+			}
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-q.notify:
+		case <-ticker.C:
+		}
+	}
+}
+
+// runNext 领取并执行一个任务，没有可执行任务时返回 false
+func (q *AIJobQueue) runNext() bool {
+	jobStorage := storage.GetAIJobStorage()
+	job, err := jobStorage.ClaimNext(time.Now())
+	if err != nil {
+		log.Printf("领取AI任务失败: %v", err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+
+	if reason, nextRunAt, paused := budgetPause(job, time.Now()); paused {
+		log.Printf("AI任务暂停至 %s (JobID: %s): %s", nextRunAt.Format("2006-01-02 15:04"), job.ID, reason)
+		if err := jobStorage.MarkPaused(job.ID, reason, nextRunAt); err != nil {
+			log.Printf("更新AI任务状态失败 (JobID: %s): %v", job.ID, err)
+		}
+		return true
+	}
+
+	resultID, err := q.execute(job)
+	q.complete(job, resultID, err)
+	return true
+}
+
+// complete 根据执行结果更新任务状态：成功、按退避时间重新排队或最终失败
+func (q *AIJobQueue) complete(job *models.AIJob, resultID string, err error) {
+	jobStorage := storage.GetAIJobStorage()
+	if err == nil {
+		if err := jobStorage.MarkSucceeded(job.ID, resultID); err != nil {
+			log.Printf("更新AI任务状态失败 (JobID: %s): %v", job.ID, err)
+		}
+		log.Printf("AI任务执行成功 (JobID: %s, MessageID: %s)", job.ID, job.MessageID)
+		return
+	}
+
+	if job.Attempts < job.MaxAttempts {
+		nextRunAt := time.Now().Add(aiJobBackoff(job.Attempts))
+		log.Printf("AI任务执行失败，将于 %s 重试 (JobID: %s, 第%d次): %v",
+			nextRunAt.Format("15:04:05"), job.ID, job.Attempts, err)
+		if err := jobStorage.MarkRetry(job.ID, err.Error(), nextRunAt); err != nil {
+			log.Printf("更新AI任务状态失败 (JobID: %s): %v", job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("AI任务最终失败 (JobID: %s, MessageID: %s): %v", job.ID, job.MessageID, err)
+	if err := jobStorage.MarkFailed(job.ID, err.Error()); err != nil {
+		log.Printf("更新AI任务状态失败 (JobID: %s): %v", job.ID, err)
+	}
+}
+
+// suggestionReady AI建议保存后通知医生端，并按需更新对话摘要
+func (q *AIJobQueue) suggestionReady(suggestion *models.AISuggestion) {
+	PublishChatSuggestion(suggestion)
+	q.EnqueueSummaryIfDue(suggestion.PatientID)
+}
+
+// StreamSuggestion 供流式接口为消息生成AI建议，与队列中同一消息的建议任务协调，避免重复生成和计费：
+// 任务排队或暂停中时领取该任务，在当前请求中流式执行并更新任务状态；任务正在由 worker 执行时等待其结果；
+// 没有任务或任务已失败时直接流式生成。ctx 只控制等待，客户端断开后已开始的生成会继续并保存
+func (q *AIJobQueue) StreamSuggestion(ctx context.Context, messageID string, onDelta func(delta string)) (*models.AISuggestion, error) {
+	jobStorage := storage.GetAIJobStorage()
+	for {
+		job, err := jobStorage.GetLatestByMessage(models.AIJobTypeSuggestion, messageID)
+		if err != nil {
+			return nil, err
+		}
+		if job != nil && job.Status == models.AIJobStatusSucceeded {
+			suggestion, err := storage.GetPatientStorage().GetAISuggestionByID(job.ResultID)
+			if err != nil || suggestion != nil {
+				return suggestion, err
+			}
+			job = nil // 建议已被删除，重新生成
+		}
+		if job == nil || job.Status == models.AIJobStatusFailed {
+			suggestion, err := q.aiService.ProcessMessageStream(messageID, onDelta)
+			if err != nil {
+				return nil, err
+			}
+			q.suggestionReady(suggestion)
+			return suggestion, nil
+		}
+
+		switch job.Status {
+		case models.AIJobStatusQueued, models.AIJobStatusPaused:
+			claimed, err := jobStorage.Claim(job.ID, time.Now())
+			if err != nil {
+				return nil, err
+			}
+			if claimed == nil {
+				continue // 已被 worker 领取，重新检查状态
+			}
+			suggestion, err := q.aiService.ProcessMessageStream(messageID, onDelta)
+			if err != nil {
+				q.complete(claimed, "", err)
+				return nil, err
+			}
+			q.complete(claimed, suggestion.ID, nil)
+			q.suggestionReady(suggestion)
+			return suggestion, nil
+		}
+
+		// worker 正在执行
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(aiJobWaitInterval):
+		}
+	}
+}
+
+// execute 执行任务，处理器 panic 时转换为错误
+func (q *AIJobQueue) execute(job *models.AIJob) (resultID string, err error) {
+	handler, ok := q.handlers[job.Type]
+	if !ok {
+		return "", fmt.Errorf("未知的任务类型: %s", job.Type)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("AI任务发生panic (JobID: %s): %v\n%s", job.ID, r, debug.Stack())
+			err = fmt.Errorf("任务执行panic: %v", r)
+		}
+	}()
+
+	return handler(job)
+}
+
+// aiJobBackoff 第 attempt 次失败后的等待时间
+func aiJobBackoff(attempt int) time.Duration {
+	backoff := aiJobBaseBackoff
+	for i := 1; i < attempt; i++ {
+		backoff *= 2
+		if backoff >= aiJobMaxBackoff {
+			return aiJobMaxBackoff
+		}
+	}
+	return backoff
+}
@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"we-dear/config"
+)
+
+// 对话角色
+const (
+	ChatRoleSystem    = "system"
+	ChatRoleUser      = "user"
+	ChatRoleAssistant = "assistant"
+)
+
+// ChatMessage 与供应商无关的对话消息
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// ChatRequest 一次对话补全请求
+type ChatRequest struct {
+	Messages    []ChatMessage
+	Temperature float32
+	MaxTokens   int
+	TopP        float32
+	JSONMode    bool // 要求模型只输出JSON对象
+}
+
+// ChatResponse 一次对话补全的结果
+type ChatResponse struct {
+	Content          string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	CallLogID        string // 调用日志ID，由 AIService 保存调用日志后填写
+}
+
+// ChatProvider 大模型供应商接口，所有AI调用都通过它完成
+type ChatProvider interface {
+	// Name 供应商名称（与 AI_PROVIDER 配置一致）
+	Name() string
+	// Model 实际使用的模型名称
+	Model() string
+	// CreateChatCompletion 生成一次完整回复
+	CreateChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+}
+
+// StreamingChatProvider 支持流式输出的供应商
+type StreamingChatProvider interface {
+	ChatProvider
+	// CreateChatCompletionStream 逐段回调生成的内容，结束后返回完整结果
+	CreateChatCompletionStream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (*ChatResponse, error)
+}
+
+// StreamChatCompletion 以流式方式调用供应商，不支持流式的供应商会一次性回调完整内容
+func StreamChatCompletion(ctx context.Context, provider ChatProvider, req ChatRequest, onDelta func(delta string)) (*ChatResponse, error) {
+	if streaming, ok := provider.(StreamingChatProvider); ok {
+		return streaming.CreateChatCompletionStream(ctx, req, onDelta)
+	}
+	resp, err := provider.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	onDelta(resp.Content)
+	return resp, nil
+}
+
+// ProviderFactory 根据配置创建供应商实例
+type ProviderFactory func(cfg config.AIConfig) (ChatProvider, error)
+
+var (
+	providerMu        sync.RWMutex
+	providerFactories = map[string]ProviderFactory{}
+)
+
+// RegisterProvider 注册一个供应商实现，重复注册会覆盖之前的实现
+func RegisterProvider(name string, factory ProviderFactory) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	providerFactories[strings.ToLower(name)] = factory
+}
+
+// RegisteredProviders 返回已注册的供应商名称
+func RegisteredProviders() []string {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+	names := make([]string, 0, len(providerFactories))
+	for name := range providerFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewChatProvider 根据配置中的 Provider 创建对应的供应商
+func NewChatProvider(cfg config.AIConfig) (ChatProvider, error) {
+	providerMu.RLock()
+	factory, ok := providerFactories[strings.ToLower(cfg.Provider)]
+	providerMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("未知的AI提供商: %s (可选: %s)", cfg.Provider, strings.Join(RegisteredProviders(), ", "))
+	}
+	return factory(cfg)
+}
@@ -4,336 +4,411 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
 	"time"
 	"we-dear/config"
 	"we-dear/models"
 	"we-dear/storage"
 	"we-dear/utils"
-	"encoding/json"
-
-	openai "github.com/sashabaranov/go-openai"
-	deepseek "github.com/cohesion-org/deepseek-go"
 )
 
 type AIService struct {
-	openaiClient   *openai.Client
-	deepseekClient *deepseek.Client
-	provider       string
+	provider ChatProvider
+	embedder Embedder
+
+	// providers 故障转移链，第一个为主供应商
+	providers      []*providerHandle
+	retry          RetryPolicy
+	attemptTimeout time.Duration
+	callTimeout    time.Duration
 }
 
 func NewAIService() *AIService {
-	provider := config.GlobalConfig.AI.Provider
-	var openaiClient *openai.Client
-	var deepseekClient *deepseek.Client
-
-	// 添加更详细的日志
 	log.Printf("初始化 AIService:")
-	log.Printf("GlobalConfig: %+v", config.GlobalConfig)
-	log.Printf("AI提供商: %s", provider)
-	log.Printf("Deepseek Key长度: %d", len(config.GlobalConfig.AI.DeepseekKey))
-
-	if provider == "openai" {
-		openaiClient = openai.NewClient(config.GlobalConfig.AI.OpenAIKey)
-		log.Printf("已初始化 OpenAI 客户端")
-	} else if provider == "deepseek" {
-		if config.GlobalConfig.AI.DeepseekKey == "" {
-			log.Fatal("Deepseek API key未设置")
-		}
-		deepseekClient = deepseek.NewClient(config.GlobalConfig.AI.DeepseekKey)
-		log.Printf("已初始化 Deepseek 客户端")
-	} else {
-		log.Printf("警告：未知的 AI 提供商: %s", provider)
+	log.Printf("AI提供商: %s", config.GlobalConfig.AI.Provider)
+
+	provider, err := NewChatProvider(config.GlobalConfig.AI)
+	if err != nil {
+		log.Fatalf("初始化AI提供商失败: %v", err)
 	}
+	fallbacks := newFallbackProviders(config.GlobalConfig.AI)
 
-	service := &AIService{
-		openaiClient:   openaiClient,
-		deepseekClient: deepseekClient,
-		provider:       provider,
+	embedder, err := NewEmbedder(config.GlobalConfig.AI)
+	if err != nil {
+		log.Printf("初始化嵌入器失败，使用本地哈希嵌入: %v", err)
+		embedder = NewHashingEmbedder(hashingDimensions)
 	}
-	
-	// 添加服务初始化完成的日志
-	log.Printf("AIService初始化完成: %+v", service)
-	
-	return service
+
+	log.Printf("AIService初始化完成: provider=%s model=%s fallbacks=%d embedder=%s",
+		provider.Name(), provider.Model(), len(fallbacks), embedder.Name())
+
+	s := NewAIServiceWithProvider(provider, fallbacks...)
+	s.embedder = embedder
+	return s
 }
 
-func (s *AIService) ParseFollowUpRecords(patientID string, maxRecords int) (string, error) {
-	// 通过medical_storage获取随访记录
-	medicalStorage := storage.GetMedicalStorage()
-	followUpRecords, err := medicalStorage.GetFollowUpRecords(patientID)
-	if err != nil {
-		return "", err
+// NewAIServiceWithProvider 使用指定的供应商创建服务，fallbacks 为按顺序尝试的备用供应商；
+// 规范检索使用本地哈希嵌入
+func NewAIServiceWithProvider(provider ChatProvider, fallbacks ...ChatProvider) *AIService {
+	cfg := config.GlobalConfig.AI
+	// 未加载配置（如测试中）时使用默认超时
+	if cfg.AttemptTimeout <= 0 {
+		cfg.AttemptTimeout = config.DefaultAIConfig.AttemptTimeout
+	}
+	if cfg.CallTimeout <= 0 {
+		cfg.CallTimeout = config.DefaultAIConfig.CallTimeout
 	}
-	// 提取最多maxRecords条随访记录，如果数量不足，只返回真实的数量
-	if len(followUpRecords) < maxRecords {
-		maxRecords = len(followUpRecords)
+
+	s := &AIService{
+		provider:       provider,
+		embedder:       NewHashingEmbedder(hashingDimensions),
+		retry:          retryPolicy(cfg),
+		attemptTimeout: time.Duration(cfg.AttemptTimeout) * time.Second,
+		callTimeout:    time.Duration(cfg.CallTimeout) * time.Second,
 	}
-	followUpRecords = followUpRecords[:maxRecords]
-	followUpRecordsStr := ""
-	for _, record := range followUpRecords {
-		followUpRecordsStr += fmt.Sprintf("```随访记录: %s\n随访日期: %s\n", record.Title, record.FollowUpDate.Format("2006-01-02 15:04:05"))
-		followUpRecordsStr += fmt.Sprintf("随访内容: %s\n", record.Content)
-		followUpRecordsStr += "```\n"
+	for _, p := range append([]ChatProvider{provider}, fallbacks...) {
+		s.providers = append(s.providers, newProviderHandle(p, cfg))
 	}
-	return followUpRecordsStr, nil
+	return s
 }
 
-func (s *AIService) ParseMedicalRecords(patientID string, maxRecords int) (string, error) {
-	// 通过medical_storage获取诊疗记录和随访记录
-	medicalStorage := storage.GetMedicalStorage()
-	medicalRecords, err := medicalStorage.GetMedicalRecords(patientID)
-	if err != nil {
-		return "", err
-	}
-	// 提取最多maxRecords条诊疗记录，如果数量不足，只返回真实的数量
-	if len(medicalRecords) < maxRecords {
-		maxRecords = len(medicalRecords)
-	}
-	medicalRecords = medicalRecords[:maxRecords]
-	medicalRecordsStr := ""
-	for _, record := range medicalRecords {
-		medicalRecordsStr += fmt.Sprintf("```诊疗记录\n诊断日期: %s\n", record.DiagnosisDate.Format("2006-01-02 15:04:05"))
-		medicalRecordsStr += fmt.Sprintf("诊断结果: %s\n", record.Diagnosis)
-		medicalRecordsStr += fmt.Sprintf("治疗方案: %s\n", record.Treatment)
-		medicalRecordsStr += fmt.Sprintf("处方: %s\n", record.Prescription)
-		medicalRecordsStr += fmt.Sprintf("备注: %s\n", record.Notes)
-		medicalRecordsStr += "```\n"
-	}
-	return medicalRecordsStr, nil
+// Provider 返回当前使用的供应商
+func (s *AIService) Provider() ChatProvider {
+	return s.provider
 }
 
 // GenerateResponse 生成回复建议
 func (s *AIService) GenerateResponse(patient *models.Patient, messageID string, currentMessage string, messageHistory []models.Message) (*models.AISuggestion, error) {
-	medicalRecordsStr, err := s.ParseMedicalRecords(patient.ID, 5)
+	prompt, err := s.buildChatRequest(patient, messageID, currentMessage, messageHistory)
 	if err != nil {
 		return nil, err
 	}
-	followUpRecordsStr, err := s.ParseFollowUpRecords(patient.ID, 5)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.callTimeout)
+	defer cancel()
+
+	call := aiCall{Purpose: models.AICallPurposeSuggestion, Patient: patient, MessageID: messageID, Template: prompt.Template}
+	resp, err := s.chat(ctx, call, withStructuredOutput(prompt.Request))
 	if err != nil {
 		return nil, err
 	}
-	// 构建系统提示信息
-	systemPrompt := fmt.Sprintf(config.MedicalAssistantSystemPrompt,
-		patient.Name,
-		patient.Gender,
-		patient.Age,
-		patient.BloodType,
-		strings.Join(patient.Allergies, "、"),
-		strings.Join(patient.ChronicDiseases, "、"),
-		// 诊疗记录
-		medicalRecordsStr,
-		// 随访记录
-		followUpRecordsStr,
-	)
-
-	// 构建对话历史上下文
-	contextStr := buildContext(messageHistory)
-
-	// 记录完整的提示信息
-	log.Printf("\n=== AI 请求信息 ===\n")
-	log.Printf("患者ID: %s\n", patient.ID)
-	log.Printf("消息ID: %s\n", messageID)
-	log.Printf("系统提示:\n%s\n", systemPrompt)
-	log.Printf("历史对话:\n%s\n", contextStr)
-	log.Printf("当前问题: %s\n", currentMessage)
-	log.Printf("================\n")
-
-	// 构建消息历史
-	messages := []openai.ChatCompletionMessage{
-		{
-			Role:    openai.ChatMessageRoleSystem,
-			Content: systemPrompt,
-		},
-	}
 
-	// 添加历史对话
-	recentMessages := messageHistory
-	if len(messageHistory) > 5 {
-		recentMessages = messageHistory[len(messageHistory)-5:]
+	structured, err := parseStructuredSuggestion(resp.Content, true)
+	if err != nil {
+		log.Printf("AI响应不符合结构化格式，尽量取出回复后保存 (MessageID: %s): %v", messageID, err)
+		structured = partialStructuredSuggestion(resp.Content)
 	}
 
-	for _, msg := range recentMessages {
-		role := openai.ChatMessageRoleUser
-		if msg.Role == models.MessageRoleDoctor {
-			role = openai.ChatMessageRoleAssistant
-		}
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    role,
-			Content: msg.Content,
-		})
+	return s.newSuggestion(patient, messageID, prompt, resp, structured), nil
+}
+
+// ProcessMessage 为一条患者消息生成并保存 AI 建议，同时尝试提取其中的生理数据
+func (s *AIService) ProcessMessage(messageID string) (*models.AISuggestion, error) {
+	return s.processMessage(messageID, nil)
+}
+
+// ProcessMessageStream 与 ProcessMessage 相同，但以流式方式生成建议，每收到一段内容就调用 onDelta
+func (s *AIService) ProcessMessageStream(messageID string, onDelta func(delta string)) (*models.AISuggestion, error) {
+	return s.processMessage(messageID, onDelta)
+}
+
+// processMessage onDelta 不为空时流式生成建议
+func (s *AIService) processMessage(messageID string, onDelta func(delta string)) (*models.AISuggestion, error) {
+	db := config.DB
+
+	var message models.Message
+	if err := db.First(&message, "id = ?", messageID).Error; err != nil {
+		return nil, fmt.Errorf("获取消息失败: %w", err)
 	}
 
-	// 添加当前问题
-	messages = append(messages, openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleUser,
-		Content: currentMessage,
-	})
+	patient, err := storage.GetPatientStorage().GetPatientByID(message.PatientID)
+	if err != nil {
+		return nil, fmt.Errorf("获取患者信息失败: %w", err)
+	}
 
-	// 根据不同的供应商调用不同的 API
-	var aiContent string
-	var genErr error
+	// 模型分诊，补充规则无法识别的情况；分诊失败不影响生成建议
+	if s.needsModelTriage(messageID) {
+		if _, err := s.TriageMessageByModel(patient, &message); err != nil {
+			log.Printf("模型分诊失败 (MessageID: %s): %v", messageID, err)
+		}
+	}
 
-	if s.provider == "openai" {
-		aiContent, genErr = s.generateOpenAIResponse(messages)
-	} else if s.provider == "deepseek" {
-		aiContent, genErr = s.generateDeepseekResponse(messages)
+	// 获取该消息及之前的历史消息
+	var history []models.Message
+	if err := db.Where("patient_id = ? AND created_at <= ?", message.PatientID, message.CreatedAt).
+		Order("created_at asc").
+		Find(&history).Error; err != nil {
+		return nil, fmt.Errorf("获取聊天历史失败: %w", err)
 	}
-	log.Printf("s.provider: %s", s.provider)
 
-	if genErr != nil {
-		return nil, genErr
+	// 生成AI建议
+	var suggestion *models.AISuggestion
+	if onDelta != nil {
+		suggestion, err = s.GenerateResponseStream(patient, messageID, message.Content, history, onDelta)
+	} else {
+		suggestion, err = s.GenerateResponse(patient, messageID, message.Content, history)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("生成AI建议失败: %w", err)
 	}
+	EscalateSuggestion(suggestion, message.Urgency)
 
-	log.Printf("\n=== AI 响应 ===\n%s\n=============\n", aiContent)
+	if err := storage.GetPatientStorage().SaveAISuggestion(suggestion); err != nil {
+		return nil, fmt.Errorf("保存AI建议失败: %w", err)
+	}
 
-	now := time.Now()
-	// 创建 AI 建议记录
-	suggestion := &models.AISuggestion{
-		BaseModel: models.BaseModel{
-			ID:        fmt.Sprintf("ai_%d", now.UnixNano()),
-			CreatedAt: now,
-			UpdatedAt: now,
-		},
-		MessageID:  messageID,
-		PatientID:  patient.ID,
-		Content:    aiContent,
-		ModelUsed:  config.DefaultAIConfig.Model,
-		Confidence: 0.95, // 默认置信度
-		Category:   models.AISuggestionCategoryMedication,
-		Priority:   3, // 默认优先级
-		Status:     models.AISuggestionStatusPending,
+	// 建议保存成功后再提取生理数据（血压、血糖、体重等），避免任务重试时重复写入；
+	// 提取失败不影响任务结果
+	if err := s.ExtractPhysiologicalData(patient, messageID, message.Content); err != nil {
+		log.Printf("提取生理数据失败: %v", err)
 	}
 
 	return suggestion, nil
 }
 
-// 添加 OpenAI 响应生成方法
-func (s *AIService) generateOpenAIResponse(messages []openai.ChatCompletionMessage) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+// GenerateResponseStream 以流式方式生成回复建议，每收到一段内容就调用 onDelta，
+// 生成结束后返回完整的建议记录（未保存）
+func (s *AIService) GenerateResponseStream(patient *models.Patient, messageID string, currentMessage string, messageHistory []models.Message, onDelta func(delta string)) (*models.AISuggestion, error) {
+	prompt, err := s.buildChatRequest(patient, messageID, currentMessage, messageHistory)
+	if err != nil {
+		return nil, err
+	}
+
+	// 总时长不超过 callTimeout，单次请求只要持续输出内容就不会超时
+	ctx, cancel := context.WithTimeout(context.Background(), s.callTimeout)
 	defer cancel()
 
-	resp, err := s.openaiClient.CreateChatCompletion(
-		ctx,
-		openai.ChatCompletionRequest{
-			Model:       config.GlobalConfig.AI.Model,
-			Messages:    messages,
-			Temperature: config.DefaultAIConfig.Temperature,
-			MaxTokens:   config.DefaultAIConfig.MaxTokens,
-			TopP:        config.DefaultAIConfig.TopP,
+	call := aiCall{Purpose: models.AICallPurposeStream, Patient: patient, MessageID: messageID, Template: prompt.Template}
+	resp, err := s.chatStream(ctx, call, prompt.Request, onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	// 流式输出的是纯文本回复，类别和紧急程度通过一次额外的分类请求获得
+	structured := s.classifySuggestion(ctx, patient, messageID, currentMessage, resp.Content)
+
+	return s.newSuggestion(patient, messageID, prompt, resp, structured), nil
+}
+
+// classifySuggestion 对已生成的回复判断类别和紧急程度，失败时使用兜底结果
+func (s *AIService) classifySuggestion(ctx context.Context, patient *models.Patient, messageID string, patientMessage string, reply string) *StructuredSuggestion {
+	call := aiCall{Purpose: models.AICallPurposeClassify, Patient: patient, MessageID: messageID}
+	resp, err := s.chat(ctx, call, ChatRequest{
+		Messages: []ChatMessage{
+			{
+				Role:    ChatRoleSystem,
+				Content: fmt.Sprintf(config.SuggestionClassifyPrompt, suggestionSchema(false)),
+			},
+			{
+				Role:    ChatRoleUser,
+				Content: fmt.Sprintf("患者消息：%s\n\n回复：%s", patientMessage, reply),
+			},
 		},
-	)
+		Temperature: 0.1,
+		JSONMode:    true,
+	})
+	if err != nil {
+		log.Printf("AI建议分类失败: %v", err)
+		return unstructuredSuggestion(reply)
+	}
 
+	structured, err := parseStructuredSuggestion(resp.Content, false)
 	if err != nil {
-		return "", err
+		log.Printf("AI建议分类结果无效: %v", err)
+		return unstructuredSuggestion(reply)
 	}
+	structured.Reply = reply
+	return structured
+}
 
-	return resp.Choices[0].Message.Content, nil
+// preparedPrompt 构建好的请求及其使用的模板和上下文
+type preparedPrompt struct {
+	Request  ChatRequest
+	Template *PromptTemplate
+	Context  *PatientContext
+	// Guidelines 提示中使用的诊疗规范片段，保存为建议的引用
+	Guidelines []GuidelinePassage
 }
 
-// 添加 Deepseek 响应生成方法
-func (s *AIService) generateDeepseekResponse(messages []openai.ChatCompletionMessage) (string, error) {
-	// 添加日志，查看转换后的消息
-	log.Printf("Deepseek请求消息: %+v", messages)
-	
-	deepseekMessages := make([]deepseek.ChatCompletionMessage, len(messages))
-	for i, msg := range messages {
-		role := deepseek.ChatMessageRoleUser
-		switch msg.Role {
-		case openai.ChatMessageRoleSystem:
-			role = "system"
-		case openai.ChatMessageRoleAssistant:
-			role = "assistant"
-		case openai.ChatMessageRoleUser:
-			role = "user"
-		}
-		
-		deepseekMessages[i] = deepseek.ChatCompletionMessage{
-			Role:    role,
-			Content: msg.Content,
+// buildChatRequest 选择患者适用的提示模板，在token预算内构建包含患者信息、诊疗记录和历史对话的请求
+func (s *AIService) buildChatRequest(patient *models.Patient, messageID string, currentMessage string, messageHistory []models.Message) (*preparedPrompt, error) {
+	medicalStorage := storage.GetMedicalStorage()
+	medicalRecords, err := medicalStorage.GetMedicalRecords(patient.ID)
+	if err != nil {
+		return nil, err
+	}
+	followUpRecords, err := medicalStorage.GetFollowUpRecords(patient.ID)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := storage.GetConversationSummaryStorage().GetByPatientID(patient.ID)
+	if err != nil {
+		return nil, err
+	}
+	findings, err := storage.GetVitalFindingStorage().ListActive(patient.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 当前消息单独放在最后，不重复出现在历史中
+	history := make([]models.Message, 0, len(messageHistory))
+	for _, msg := range messageHistory {
+		if msg.ID != messageID {
+			history = append(history, msg)
 		}
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	tpl := SelectPromptTemplate(patient)
+	vars := map[string]string{
+		"patient_name":     patient.Name,
+		"patient_gender":   patient.Gender,
+		"patient_age":      strconv.Itoa(patient.Age),
+		"blood_type":       patient.BloodType,
+		"allergies":        strings.Join(patient.Allergies, "、"),
+		"chronic_diseases": strings.Join(patient.ChronicDiseases, "、"),
+		"current_time":     time.Now().Format("2006-01-02 15:04:05"),
+	}
+	summaryUntil := time.Time{}
+	if summary != nil && summary.Content != "" {
+		vars["conversation_summary"] = summary.Content
+		summaryUntil = summary.LastMessageAt
+	} else {
+		vars["conversation_summary"] = "无"
+	}
+	// 模板没有引用对话摘要时追加在系统提示末尾
+	systemTemplate := tpl.Content.SystemPrompt
+	if summary != nil && summary.Content != "" && !promptUsesVariable(systemTemplate, "conversation_summary") {
+		systemTemplate += "\n---\n既往对话摘要：\n{{conversation_summary}}"
+	}
 
-	// 添加更详细的错误处理
-	resp, err := s.deepseekClient.CreateChatCompletion(
-		ctx,
-		&deepseek.ChatCompletionRequest{
-			Model:    deepseek.DeepSeekChat,
-				Messages: deepseekMessages,
-				Temperature: 0.7,  // 添加温度参数
-				MaxTokens: 2000,   // 添加最大token限制
-		},
-	)
+	// 后台检测到的生理指标趋势异常，模板没有引用时追加在系统提示末尾
+	vars["vital_findings"] = "无"
+	if text := formatVitalFindings(findings); text != "" {
+		vars["vital_findings"] = text
+		if !promptUsesVariable(systemTemplate, "vital_findings") {
+			systemTemplate += fmt.Sprintf(config.VitalFindingsInstruction, "{{vital_findings}}")
+		}
+	}
+
+	// 检索相关的诊疗规范片段，最多占上下文预算的四分之一
+	query := currentMessage
+	if len(patient.ChronicDiseases) > 0 {
+		query += "\n" + strings.Join(patient.ChronicDiseases, "、")
+	}
+	guidelines, passages := formatGuidelines(
+		s.retrieveGuidelines(context.Background(), patient, query),
+		config.GlobalConfig.AI.ContextTokens/4)
+	vars["guidelines"] = "无"
+	if guidelines != "" {
+		vars["guidelines"] = guidelines
+		if !promptUsesVariable(systemTemplate, "guidelines") {
+			systemTemplate += fmt.Sprintf(config.GuidelinesInstruction, "{{guidelines}}")
+		}
+	}
 
+	// 模板本身、当前问题和结构化输出要求的token数从预算中扣除，剩余的分给上下文
+	basePrompt, err := RenderPrompt(systemTemplate, vars)
 	if err != nil {
-		log.Printf("Deepseek API错误: %v", err)
-		return "", fmt.Errorf("deepseek API调用失败: %w", err)
+		return nil, fmt.Errorf("渲染提示模板失败: %w", err)
+	}
+	budget := config.GlobalConfig.AI.ContextTokens -
+		EstimateTokens(basePrompt) -
+		EstimateTokens(currentMessage) -
+		EstimateTokens(config.StructuredReplyInstruction+suggestionSchema(true))
+	builder := NewContextBuilder(budget)
+	builder.SummarizedUntil = summaryUntil
+	patientContext := builder.Build(patient, currentMessage, medicalRecords, followUpRecords, history)
+
+	vars["medical_records"] = patientContext.MedicalRecords
+	vars["follow_up_records"] = patientContext.FollowUpRecords
+	systemPrompt, err := RenderPrompt(systemTemplate, vars)
+	if err != nil {
+		return nil, fmt.Errorf("渲染提示模板失败: %w", err)
 	}
 
-	if resp == nil || len(resp.Choices) == 0 {
-		return "", fmt.Errorf("deepseek返回了空响应")
+	messages := []ChatMessage{
+		{
+			Role:    ChatRoleSystem,
+			Content: systemPrompt,
+		},
+	}
+	if patientContext.HistorySummary != "" {
+		messages = append(messages, ChatMessage{
+			Role:    ChatRoleSystem,
+			Content: patientContext.HistorySummary,
+		})
 	}
+	messages = append(messages, patientContext.History...)
+	messages = append(messages, ChatMessage{
+		Role:    ChatRoleUser,
+		Content: currentMessage,
+	})
 
-	return resp.Choices[0].Message.Content, nil
+	req := ChatRequest{
+		Messages:    messages,
+		Temperature: config.GlobalConfig.AI.Temperature,
+		MaxTokens:   config.GlobalConfig.AI.MaxTokens,
+		TopP:        config.GlobalConfig.AI.TopP,
+	}
+	if tpl.Content.Temperature != nil {
+		req.Temperature = *tpl.Content.Temperature
+	}
+	if tpl.Content.MaxTokens != nil {
+		req.MaxTokens = *tpl.Content.MaxTokens
+	}
+	return &preparedPrompt{Request: req, Template: tpl, Context: patientContext, Guidelines: passages}, nil
 }
 
-// buildContext 构建上下文信息
-func buildContext(history []models.Message) string {
-	var contextBuilder strings.Builder
-
-	// 只取最近的5条消息作为上下文
-	recentMessages := history
-	if len(history) > 5 {
-		recentMessages = history[len(history)-5:]
+// newSuggestion 根据模型回复和结构化结果创建 AI 建议记录，并做用药安全检查
+func (s *AIService) newSuggestion(patient *models.Patient, messageID string, prompt *preparedPrompt, resp *ChatResponse, structured *StructuredSuggestion) *models.AISuggestion {
+	now := time.Now()
+	id := fmt.Sprintf("ai_%d", now.UnixNano())
+	suggestion := &models.AISuggestion{
+		BaseModel: models.BaseModel{
+			ID:        id,
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		MessageID:       messageID,
+		PatientID:       patient.ID,
+		Content:         structured.Reply,
+		ModelUsed:       modelName(resp, s.provider),
+		TemplateID:      prompt.Template.ID,
+		TemplateVersion: prompt.Template.Version,
+		CallLogID:       resp.CallLogID,
+		Confidence:      structured.Confidence,
+		Category:        structured.Category,
+		Priority:        structured.Priority,
+		Rationale:       structured.Rationale,
+		Status:          models.AISuggestionStatusPending,
+		Citations:       newCitations(id, prompt.Guidelines),
 	}
+	ApplyMedicationSafety(patient, suggestion)
+	return suggestion
+}
 
-	for _, msg := range recentMessages {
-		contextBuilder.WriteString(fmt.Sprintf("[%s] %s: %s\n",
-			msg.CreatedAt.Format("2006-01-02 15:04:05"),
-			msg.Role,
-			msg.Content,
-		))
+// modelName 优先使用供应商返回的模型名称
+func modelName(resp *ChatResponse, provider ChatProvider) string {
+	if resp != nil && resp.Model != "" {
+		return resp.Model
 	}
-
-	return contextBuilder.String()
+	return provider.Model()
 }
 
-// 从聊天记录中提取生理数据（血压，血糖）
-// ExtractPhysiologicalData 从聊天记录中提取生理数据
-func (s *AIService) ExtractPhysiologicalData(patientID string, messageContent string) error {
-	// 获取当前时间
-	currentTime := time.Now().Format("2006-01-02 15:04:05")
-
-	// 构建提示信息
-	systemPrompt := fmt.Sprintf(`你是一个医疗数据分析助手。请从患者的消息中提取血压、血糖数据和测量时间
-（请注意患者聊天记录中说明的时间，如果是相对时间需要和当前时间进行比较）。
-如果存在多个数据，请提取最新的一组。请按以下JSON格式返回:
-{
-    "bloodPressure": {
-        "systolic": 收缩压数值(int),
-        "diastolic": 舒张压数值(int),
-        "measuredAt": "测量时间(YYYY-MM-DD HH:mm:ss格式)",
-        "hasData": true/false
-    },
-    "bloodSugar": {
-        "value": 血糖值(float),
-        "type": "空腹/餐后/随机",
-        "measuredAt": "测量时间(YYYY-MM-DD HH:mm:ss格式)", 
-        "hasData": true/false
-    }
-}
-如果消息中未明确提到测量时间，则使用当前时间: %s。`, currentTime)
+// ExtractPhysiologicalData 从聊天记录中提取生理数据，可提取的测量类型见 VitalSignTypes；
+// 一条消息中的多次测量逐条保存为待确认数据，超出合理范围的读数丢弃
+func (s *AIService) ExtractPhysiologicalData(patient *models.Patient, messageID string, messageContent string) error {
+	types := VitalSignTypes()
+	now := time.Now()
 
-	messages := []deepseek.ChatCompletionMessage{
+	messages := []ChatMessage{
 		{
-			Role:    "system",
-			Content: systemPrompt,
+			Role:    ChatRoleSystem,
+			Content: vitalExtractionPrompt(types, now),
 		},
 		{
-			Role:    "user",
+			Role:    ChatRoleUser,
 			Content: messageContent,
 		},
 	}
@@ -342,90 +417,44 @@ func (s *AIService) ExtractPhysiologicalData(patientID string, messageContent st
 	defer cancel()
 
 	// 调用AI提取数据
-	resp, err := s.deepseekClient.CreateChatCompletion(
-		ctx,
-		&deepseek.ChatCompletionRequest{
-			Model:       deepseek.DeepSeekChat,
-			Messages:    messages,
-			Temperature: 0.1, // 降低温度以获得更确定的结果
-		},
-	)
-
+	resp, err := s.chat(ctx, aiCall{Purpose: models.AICallPurposeExtract, Patient: patient, MessageID: messageID}, ChatRequest{
+		Messages:    messages,
+		Temperature: 0.1, // 降低温度以获得更确定的结果
+		JSONMode:    true,
+	})
 	if err != nil {
 		return fmt.Errorf("AI提取生理数据失败: %w", err)
 	}
 
-	if len(resp.Choices) == 0 {
-		return fmt.Errorf("AI返回空响应")
+	readings, rejected, err := parseVitalReadings(resp.Content, types, now)
+	if err != nil {
+		return err
 	}
-
-	// 解析AI返回的JSON
-	var result struct {
-		BloodPressure struct {
-			Systolic   int     `json:"systolic"`
-			Diastolic  int     `json:"diastolic"`
-			MeasuredAt string  `json:"measuredAt"`
-			HasData    bool    `json:"hasData"`
-		} `json:"bloodPressure"`
-		BloodSugar struct {
-			Value      float64 `json:"value"`
-			Type       string  `json:"type"`
-			MeasuredAt string  `json:"measuredAt"`
-			HasData    bool    `json:"hasData"`
-		} `json:"bloodSugar"`
+	for _, reason := range rejected {
+		log.Printf("丢弃AI提取的生理数据 (MessageID: %s): %s", messageID, reason)
 	}
 
-	if err := json.Unmarshal([]byte(resp.Choices[0].Message.Content), &result); err != nil {
-		return fmt.Errorf("解析AI响应失败: %w", err)
-	}
-
-	// 保存有效的血压数据
-	if result.BloodPressure.HasData {
-		measuredAt, err := time.Parse("2006-01-02 15:04:05", result.BloodPressure.MeasuredAt)
-		if err != nil {
-			measuredAt = time.Now() // 如果解析失败，使用当前时间
-		}
-
-		bloodPressure := &models.PhysiologicalData{
-			BaseModel: models.BaseModel{
-				ID:        utils.GenerateID(),
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
-			},
-			PatientID:  patientID,
-			Type:      "blood_pressure",
-			Value:     fmt.Sprintf("%d/%d", result.BloodPressure.Systolic, result.BloodPressure.Diastolic),
-			MeasuredAt: measuredAt,
-			Source:    "ai_extract",
-			Notes:     "从聊天记录中AI提取的血压数据",
-		}
-		if err := storage.GetPhysiologicalDataStorage().Create(bloodPressure); err != nil {
-			return fmt.Errorf("保存血压数据失败: %w", err)
-		}
-	}
-
-	// 保存有效的血糖数据
-	if result.BloodSugar.HasData {
-		measuredAt, err := time.Parse("2006-01-02 15:04:05", result.BloodSugar.MeasuredAt)
-		if err != nil {
-			measuredAt = time.Now() // 如果解析失败，使用当前时间
-		}
-
-		bloodSugar := &models.PhysiologicalData{
+	for _, reading := range readings {
+		definition, _ := findVitalSignType(types, reading.Type)
+		data := &models.PhysiologicalData{
 			BaseModel: models.BaseModel{
 				ID:        utils.GenerateID(),
-				CreatedAt: time.Now(),
-				UpdatedAt: time.Now(),
+				CreatedAt: now,
+				UpdatedAt: now,
 			},
-			PatientID:  patientID,
-			Type:      "blood_sugar",
-			Value:     fmt.Sprintf("%.1f-%s", result.BloodSugar.Value, result.BloodSugar.Type),
-			MeasuredAt: measuredAt,
-			Source:    "ai_extract",
-			Notes:     "从聊天记录中AI提取的血糖数据",
+			PatientID:  patient.ID,
+			Type:       reading.Type,
+			MeasuredAt: reading.MeasuredAt,
+			Source:     models.PhysiologicalSourceAIExtract,
+			Notes:      fmt.Sprintf("从聊天记录中AI提取的%s数据", definition.Name),
+			// 医生确认前不计入趋势分析
+			Status:         models.PhysiologicalStatusPending,
+			MessageID:      messageID,
+			ExtractedValue: FormatVitalValue(definition, reading),
 		}
-		if err := storage.GetPhysiologicalDataStorage().Create(bloodSugar); err != nil {
-			return fmt.Errorf("保存血糖数据失败: %w", err)
+		applyVitalReading(data, definition, reading)
+		if err := RecordPhysiologicalData(data); err != nil {
+			return fmt.Errorf("保存%s数据失败: %w", definition.Name, err)
 		}
 	}
 
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"we-dear/models"
+)
+
+// 实时聊天事件类型
+const (
+	ChatEventMessage    = "message"    // 新消息
+	ChatEventSuggestion = "suggestion" // AI建议已生成（只推送给医生端）
+	ChatEventTyping     = "typing"     // 正在输入
+	ChatEventRead       = "read"       // 已读回执
+)
+
+// chatSubscriberBuffer 每个订阅者缓冲的事件数量，连接处理不过来时丢弃新事件，不阻塞发布方
+const chatSubscriberBuffer = 64
+
+// ChatEvent 推送给患者会话参与者的实时事件
+type ChatEvent struct {
+	Type      string      `json:"type"`           // 事件类型
+	PatientID string      `json:"patientId"`      // 患者会话
+	Role      string      `json:"role,omitempty"` // 触发事件的一方（doctor/patient）
+	Audience  string      `json:"-"`              // 只推送给该角色的连接，为空时推送给所有连接
+	SenderID  string      `json:"-"`              // 发起事件的连接，不再推送回该连接
+	Data      interface{} `json:"data,omitempty"` // 事件内容，如消息、AI建议
+	At        time.Time   `json:"at"`             // 事件时间
+}
+
+// ChatSubscriber 一个连接对某个患者会话的订阅
+type ChatSubscriber struct {
+	ID        string         // 连接ID
+	PatientID string         // 订阅的患者会话
+	Role      string         // 连接的角色（doctor/patient）
+	Events    chan ChatEvent // 待推送的事件，取消订阅后关闭
+}
+
+// accepts 判断事件是否需要推送给该订阅者
+func (s *ChatSubscriber) accepts(event ChatEvent) bool {
+	if event.SenderID != "" && event.SenderID == s.ID {
+		return false
+	}
+	return event.Audience == "" || event.Audience == s.Role
+}
+
+// ChatHub 按患者会话分发实时事件。单机部署使用内存实现；
+// 多实例部署时可实现为 Publish 写入 Redis 频道、各实例订阅频道后分发给本机连接
+type ChatHub interface {
+	// Subscribe 订阅患者会话的事件，连接断开时须调用 Unsubscribe
+	Subscribe(patientID string, subscriberID string, role string) *ChatSubscriber
+	// Unsubscribe 取消订阅并关闭事件通道
+	Unsubscribe(subscriber *ChatSubscriber)
+	// Publish 将事件推送给患者会话的订阅者
+	Publish(event ChatEvent)
+}
+
+// MemoryChatHub 单进程内的 ChatHub 实现
+type MemoryChatHub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[*ChatSubscriber]struct{}
+}
+
+// NewMemoryChatHub 创建内存 ChatHub
+func NewMemoryChatHub() *MemoryChatHub {
+	return &MemoryChatHub{subscribers: map[string]map[*ChatSubscriber]struct{}{}}
+}
+
+// Subscribe 订阅患者会话的事件
+func (h *MemoryChatHub) Subscribe(patientID string, subscriberID string, role string) *ChatSubscriber {
+	subscriber := &ChatSubscriber{
+		ID:        subscriberID,
+		PatientID: patientID,
+		Role:      role,
+		Events:    make(chan ChatEvent, chatSubscriberBuffer),
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subscribers[patientID] == nil {
+		h.subscribers[patientID] = map[*ChatSubscriber]struct{}{}
+	}
+	h.subscribers[patientID][subscriber] = struct{}{}
+	return subscriber
+}
+
+// Unsubscribe 取消订阅，重复调用不会出错
+func (h *MemoryChatHub) Unsubscribe(subscriber *ChatSubscriber) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	subscribers := h.subscribers[subscriber.PatientID]
+	if _, ok := subscribers[subscriber]; !ok {
+		return
+	}
+	delete(subscribers, subscriber)
+	if len(subscribers) == 0 {
+		delete(h.subscribers, subscriber.PatientID)
+	}
+	close(subscriber.Events)
+}
+
+// Publish 将事件推送给患者会话的订阅者，缓冲已满的订阅者丢弃该事件
+func (h *MemoryChatHub) Publish(event ChatEvent) {
+	if event.At.IsZero() {
+		event.At = time.Now()
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for subscriber := range h.subscribers[event.PatientID] {
+		if !subscriber.accepts(event) {
+			continue
+		}
+		select {
+		case subscriber.Events <- event:
+		default:
+			log.Printf("实时聊天连接处理过慢，丢弃事件 (PatientID: %s, Type: %s, Subscriber: %s)", event.PatientID, event.Type, subscriber.ID)
+		}
+	}
+}
+
+var (
+	chatHub     ChatHub
+	chatHubOnce sync.Once
+)
+
+// GetChatHub 获取全局 ChatHub，未通过 SetChatHub 替换时使用内存实现
+func GetChatHub() ChatHub {
+	chatHubOnce.Do(func() {
+		if chatHub == nil {
+			chatHub = NewMemoryChatHub()
+		}
+	})
+	return chatHub
+}
+
+// SetChatHub 替换全局 ChatHub（如 Redis 实现），需在服务启动前调用
+func SetChatHub(hub ChatHub) {
+	chatHub = hub
+}
+
+// PublishChatMessage 推送新消息给会话双方
+func PublishChatMessage(message *models.Message) {
+	GetChatHub().Publish(ChatEvent{
+		Type:      ChatEventMessage,
+		PatientID: message.PatientID,
+		Role:      message.Role,
+		Data:      message,
+		At:        message.CreatedAt,
+	})
+}
+
+// PublishChatSuggestion 通知医生端AI建议已生成
+func PublishChatSuggestion(suggestion *models.AISuggestion) {
+	GetChatHub().Publish(ChatEvent{
+		Type:      ChatEventSuggestion,
+		PatientID: suggestion.PatientID,
+		Audience:  models.MessageRoleDoctor,
+		Data:      suggestion,
+	})
+}
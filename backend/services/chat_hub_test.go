@@ -0,0 +1,48 @@
+package services
+
+import (
+	"testing"
+
+	"we-dear/models"
+)
+
+func TestMemoryChatHub(t *testing.T) {
+	hub := NewMemoryChatHub()
+	doctor := hub.Subscribe("p1", "c1", models.MessageRoleDoctor)
+	patient := hub.Subscribe("p1", "c2", models.MessageRolePatient)
+	other := hub.Subscribe("p2", "c3", models.MessageRoleDoctor)
+
+	hub.Publish(ChatEvent{Type: ChatEventMessage, PatientID: "p1"})
+	hub.Publish(ChatEvent{Type: ChatEventSuggestion, PatientID: "p1", Audience: models.MessageRoleDoctor})
+	hub.Publish(ChatEvent{Type: ChatEventTyping, PatientID: "p1", SenderID: "c2"})
+
+	expectEvents := func(name string, subscriber *ChatSubscriber, types ...string) {
+		t.Helper()
+		if len(subscriber.Events) != len(types) {
+			t.Fatalf("%s: expected %d events, got %d", name, len(types), len(subscriber.Events))
+		}
+		for _, eventType := range types {
+			if event := <-subscriber.Events; event.Type != eventType || event.At.IsZero() {
+				t.Errorf("%s: expected %s event, got %+v", name, eventType, event)
+			}
+		}
+	}
+	expectEvents("doctor", doctor, ChatEventMessage, ChatEventSuggestion, ChatEventTyping)
+	expectEvents("patient", patient, ChatEventMessage)
+	expectEvents("other conversation", other)
+
+	hub.Unsubscribe(patient)
+	hub.Unsubscribe(patient)
+	if _, ok := <-patient.Events; ok {
+		t.Error("expected events channel to be closed after unsubscribe")
+	}
+	hub.Publish(ChatEvent{Type: ChatEventMessage, PatientID: "p1"})
+	expectEvents("doctor after unsubscribe", doctor, ChatEventMessage)
+
+	for i := 0; i < chatSubscriberBuffer+5; i++ {
+		hub.Publish(ChatEvent{Type: ChatEventTyping, PatientID: "p2"})
+	}
+	if len(other.Events) != chatSubscriberBuffer {
+		t.Errorf("expected slow subscriber to keep %d buffered events, got %d", chatSubscriberBuffer, len(other.Events))
+	}
+}
@@ -0,0 +1,96 @@
+package services
+
+import (
+	"errors"
+	"time"
+
+	"we-dear/models"
+	"we-dear/storage"
+)
+
+var (
+	ErrInvalidReader       = errors.New("阅读方只能为doctor或patient")
+	ErrChatMessageNotFound = errors.New("消息不存在")
+)
+
+// ChatReadReceipt 一次标记已读的结果，同时作为已读回执推送给会话另一方
+type ChatReadReceipt struct {
+	PatientID string    `json:"patientId"`
+	Reader    string    `json:"reader"`    // 阅读方（doctor/patient）
+	MessageID string    `json:"messageId"` // 已读到的消息
+	ReadAt    time.Time `json:"readAt"`    // 已读时间
+	Marked    int64     `json:"marked"`    // 本次新标记为已读的消息数量
+}
+
+// ChatUnreadCounts 会话双方的未读消息数量
+type ChatUnreadCounts struct {
+	Doctor  int `json:"doctor"`  // 医生未读的患者消息
+	Patient int `json:"patient"` // 患者未读的医生消息
+}
+
+// chatSenderRole 返回阅读方需要阅读的消息的发送方角色
+func chatSenderRole(reader string) (string, error) {
+	switch reader {
+	case models.MessageRoleDoctor:
+		return models.MessageRolePatient, nil
+	case models.MessageRolePatient:
+		return models.MessageRoleDoctor, nil
+	}
+	return "", ErrInvalidReader
+}
+
+// MarkMessagesRead 将会话中另一方在 messageID 及之前发送的消息标记为 reader 已读，
+// messageID 可以是任一方的消息；已读过的消息保留原来的已读时间
+func MarkMessagesRead(patientID string, reader string, messageID string, now time.Time) (*ChatReadReceipt, error) {
+	senderRole, err := chatSenderRole(reader)
+	if err != nil {
+		return nil, err
+	}
+
+	message, err := storage.GetMessageStorage().GetByID(patientID, messageID)
+	if err != nil {
+		return nil, err
+	}
+	if message == nil {
+		return nil, ErrChatMessageNotFound
+	}
+
+	marked, err := storage.GetMessageStorage().MarkRead(patientID, senderRole, message.CreatedAt, now)
+	if err != nil {
+		return nil, err
+	}
+	return &ChatReadReceipt{
+		PatientID: patientID,
+		Reader:    reader,
+		MessageID: messageID,
+		ReadAt:    now,
+		Marked:    marked,
+	}, nil
+}
+
+// GetChatUnreadCounts 统计会话双方的未读消息数量
+func GetChatUnreadCounts(patientID string) (ChatUnreadCounts, error) {
+	counts, err := storage.GetMessageStorage().UnreadCounts(patientID)
+	if err != nil {
+		return ChatUnreadCounts{}, err
+	}
+	return ChatUnreadCounts{
+		Doctor:  counts[models.MessageRolePatient],
+		Patient: counts[models.MessageRoleDoctor],
+	}, nil
+}
+
+// PublishChatRead 推送已读回执，没有新标记的消息时不推送；senderID 为发起的实时连接，不再推送回该连接
+func PublishChatRead(receipt *ChatReadReceipt, senderID string) {
+	if receipt.Marked == 0 {
+		return
+	}
+	GetChatHub().Publish(ChatEvent{
+		Type:      ChatEventRead,
+		PatientID: receipt.PatientID,
+		Role:      receipt.Reader,
+		SenderID:  senderID,
+		Data:      receipt,
+		At:        receipt.ReadAt,
+	})
+}
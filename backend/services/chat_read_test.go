@@ -0,0 +1,36 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"we-dear/models"
+)
+
+func TestChatSenderRole(t *testing.T) {
+	if role, err := chatSenderRole(models.MessageRoleDoctor); err != nil || role != models.MessageRolePatient {
+		t.Errorf("doctor should read patient messages, got %q %v", role, err)
+	}
+	if role, err := chatSenderRole(models.MessageRolePatient); err != nil || role != models.MessageRoleDoctor {
+		t.Errorf("patient should read doctor messages, got %q %v", role, err)
+	}
+	if _, err := chatSenderRole(models.MessageRoleSystem); !errors.Is(err, ErrInvalidReader) {
+		t.Errorf("expected ErrInvalidReader, got %v", err)
+	}
+}
+
+func TestPublishChatReadSkipsEmptyReceipt(t *testing.T) {
+	hub := NewMemoryChatHub()
+	SetChatHub(hub)
+	defer SetChatHub(NewMemoryChatHub())
+	subscriber := hub.Subscribe("p1", "c1", models.MessageRolePatient)
+
+	PublishChatRead(&ChatReadReceipt{PatientID: "p1", Reader: models.MessageRoleDoctor}, "")
+	PublishChatRead(&ChatReadReceipt{PatientID: "p1", Reader: models.MessageRoleDoctor, Marked: 2}, "")
+	if len(subscriber.Events) != 1 {
+		t.Fatalf("expected one read event, got %d", len(subscriber.Events))
+	}
+	if event := <-subscriber.Events; event.Type != ChatEventRead || event.Role != models.MessageRoleDoctor {
+		t.Errorf("unexpected event %+v", event)
+	}
+}
@@ -0,0 +1,337 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"we-dear/models"
+)
+
+// 上下文各部分占剩余预算的比例，某部分用不完的预算会让给后面的部分
+const (
+	medicalRecordsShare  = 0.4
+	followUpRecordsShare = 0.2
+)
+
+// 单条内容压缩后的最大长度（字符）
+const (
+	compactRecordRunes  = 60
+	summaryMessageRunes = 40
+)
+
+// EstimateTokens 粗略估算文本的token数：中文等宽字符按每字1个token，
+// 其余字符按每4个1个token计算，结果偏保守
+func EstimateTokens(text string) int {
+	wide, narrow := 0, 0
+	for _, r := range text {
+		if r > unicode.MaxASCII {
+			wide++
+		} else {
+			narrow++
+		}
+	}
+	return wide + (narrow+3)/4
+}
+
+// PatientContext 按预算裁剪后的患者上下文
+type PatientContext struct {
+	MedicalRecords  string        // 诊疗记录
+	FollowUpRecords string        // 随访记录
+	HistorySummary  string        // 超出预算的早期对话摘要
+	History         []ChatMessage // 保留原文的近期对话
+	Tokens          map[string]int
+}
+
+// ContextBuilder 在token预算内组装诊疗记录、随访记录和历史对话：
+// 近期和与当前问题相关的内容优先保留原文，放不下的压缩为一行摘要，
+// 诊断结果至少以摘要形式保留，避免长期随访的慢病患者丢失早年的重要诊断
+type ContextBuilder struct {
+	Budget int
+	// SummarizedUntil 已纳入患者对话摘要的最后一条消息时间，更早的消息不再重复压缩
+	SummarizedUntil time.Time
+}
+
+// NewContextBuilder 创建上下文构建器，budget 为上下文部分可用的token数
+func NewContextBuilder(budget int) *ContextBuilder {
+	return &ContextBuilder{Budget: budget}
+}
+
+// Build 组装上下文，currentMessage 用于判断记录的相关性
+func (b *ContextBuilder) Build(patient *models.Patient, currentMessage string, medicalRecords []models.MedicalRecord, followUpRecords []models.FollowUpRecord, history []models.Message) *PatientContext {
+	result := &PatientContext{Tokens: map[string]int{}}
+	remaining := b.Budget
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	keywords := relevanceKeywords(patient, currentMessage)
+
+	medicalBudget := int(float64(remaining) * medicalRecordsShare)
+	result.MedicalRecords = fitMedicalRecords(medicalRecords, keywords, medicalBudget)
+	result.Tokens["medical_records"] = EstimateTokens(result.MedicalRecords)
+	remaining -= result.Tokens["medical_records"]
+
+	followUpBudget := int(float64(b.Budget) * followUpRecordsShare)
+	if followUpBudget > remaining {
+		followUpBudget = remaining
+	}
+	result.FollowUpRecords = fitFollowUpRecords(followUpRecords, followUpBudget)
+	result.Tokens["follow_up_records"] = EstimateTokens(result.FollowUpRecords)
+	remaining -= result.Tokens["follow_up_records"]
+
+	result.History, result.HistorySummary = fitHistory(history, remaining, b.SummarizedUntil)
+	for _, msg := range result.History {
+		result.Tokens["history"] += EstimateTokens(msg.Content)
+	}
+	result.Tokens["history_summary"] = EstimateTokens(result.HistorySummary)
+
+	return result
+}
+
+// relevanceKeywords 当前问题和慢性病史中的关键词，用于判断诊疗记录是否相关
+func relevanceKeywords(patient *models.Patient, currentMessage string) []string {
+	var keywords []string
+	for _, disease := range patient.ChronicDiseases {
+		if disease = strings.TrimSpace(disease); disease != "" {
+			keywords = append(keywords, disease)
+		}
+	}
+	for _, item := range diseaseCategoryKeywords {
+		for _, keyword := range item.Keywords {
+			if strings.Contains(currentMessage, keyword) {
+				keywords = append(keywords, item.Keywords...)
+				break
+			}
+		}
+	}
+	return keywords
+}
+
+func isRelevantRecord(record models.MedicalRecord, keywords []string) bool {
+	text := record.Diagnosis + record.Treatment + record.Prescription + strings.Join(record.Symptoms, "")
+	for _, keyword := range keywords {
+		if strings.Contains(text, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+func formatMedicalRecord(record models.MedicalRecord) string {
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("```诊疗记录\n诊断日期: %s\n", record.DiagnosisDate.Format("2006-01-02")))
+	builder.WriteString(fmt.Sprintf("诊断结果: %s\n", record.Diagnosis))
+	if record.Treatment != "" {
+		builder.WriteString(fmt.Sprintf("治疗方案: %s\n", record.Treatment))
+	}
+	if record.Prescription != "" {
+		builder.WriteString(fmt.Sprintf("处方: %s\n", record.Prescription))
+	}
+	if record.Notes != "" {
+		builder.WriteString(fmt.Sprintf("备注: %s\n", record.Notes))
+	}
+	builder.WriteString("```\n")
+	return builder.String()
+}
+
+func compactMedicalRecord(record models.MedicalRecord) string {
+	line := record.Diagnosis
+	if record.Prescription != "" {
+		line += "；处方: " + record.Prescription
+	}
+	return fmt.Sprintf("- %s %s\n", record.DiagnosisDate.Format("2006-01-02"), truncateRunes(line, compactRecordRunes))
+}
+
+// fitMedicalRecords 记录已按诊断日期倒序排列：相关记录优先，其次按时间由近到远保留原文，
+// 放不下的记录压缩为“日期 诊断”一行，仍放不下时只保留数量
+func fitMedicalRecords(records []models.MedicalRecord, keywords []string, budget int) string {
+	if len(records) == 0 {
+		return ""
+	}
+
+	order := make([]int, len(records))
+	for i := range records {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return isRelevantRecord(records[order[a]], keywords) && !isRelevantRecord(records[order[b]], keywords)
+	})
+
+	// 为一行摘要预留最多三分之一的预算，保证早年的诊断不会整体丢失
+	reserve := 0
+	for _, record := range records {
+		reserve += EstimateTokens(compactMedicalRecord(record))
+	}
+	if reserve > budget/3 {
+		reserve = budget / 3
+	}
+
+	full := map[int]bool{}
+	used := 0
+	for _, index := range order {
+		cost := EstimateTokens(formatMedicalRecord(records[index]))
+		if used+cost > budget-reserve {
+			continue
+		}
+		full[index] = true
+		used += cost
+	}
+
+	var detail, compact strings.Builder
+	omitted := 0
+	for i, record := range records {
+		if full[i] {
+			detail.WriteString(formatMedicalRecord(record))
+			continue
+		}
+		line := compactMedicalRecord(record)
+		if used+EstimateTokens(line) > budget {
+			omitted++
+			continue
+		}
+		compact.WriteString(line)
+		used += EstimateTokens(line)
+	}
+
+	text := detail.String()
+	if compact.Len() > 0 {
+		text += "更早或次要的诊疗记录（摘要）:\n" + compact.String()
+	}
+	if omitted > 0 {
+		text += fmt.Sprintf("另有%d条诊疗记录因篇幅省略\n", omitted)
+	}
+	return text
+}
+
+// formatFollowUpContent 将随访记录中按模板填写的JSON展开为“字段: 值”，无法解析时按原文输出
+func formatFollowUpContent(content string) string {
+	var data map[string]interface{}
+	if err := json.Unmarshal([]byte(content), &data); err != nil {
+		return content
+	}
+	var lines []string
+	flattenFollowUpField("", data, &lines)
+	sort.Strings(lines)
+	return strings.Join(lines, "\n")
+}
+
+func flattenFollowUpField(prefix string, value interface{}, lines *[]string) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			name := key
+			if prefix != "" {
+				name = prefix + "." + key
+			}
+			flattenFollowUpField(name, item, lines)
+		}
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, fmt.Sprint(item))
+		}
+		*lines = append(*lines, fmt.Sprintf("%s: %s", prefix, strings.Join(parts, "、")))
+	case nil, string:
+		if v == nil || v == "" {
+			return
+		}
+		*lines = append(*lines, fmt.Sprintf("%s: %s", prefix, v))
+	default:
+		*lines = append(*lines, fmt.Sprintf("%s: %v", prefix, v))
+	}
+}
+
+// fitFollowUpRecords 记录已按随访日期倒序排列，从最近的开始保留直到用完预算
+func fitFollowUpRecords(records []models.FollowUpRecord, budget int) string {
+	var builder strings.Builder
+	used := 0
+	for i, record := range records {
+		text := fmt.Sprintf("```随访记录: %s\n随访日期: %s\n%s\n```\n",
+			record.Title, record.FollowUpDate.Format("2006-01-02"), formatFollowUpContent(record.Content))
+		cost := EstimateTokens(text)
+		if used+cost > budget {
+			if remaining := len(records) - i; remaining > 0 {
+				builder.WriteString(fmt.Sprintf("另有%d条更早的随访记录因篇幅省略\n", remaining))
+			}
+			break
+		}
+		builder.WriteString(text)
+		used += cost
+	}
+	return builder.String()
+}
+
+// fitHistory 历史消息按时间正序排列，从最近的开始保留原文；
+// 放不下且不在对话摘要中的早期消息压缩为摘要，摘要最多占历史预算的四分之一
+func fitHistory(history []models.Message, budget int, summarizedUntil time.Time) ([]ChatMessage, string) {
+	summaryBudget := budget / 4
+	used := 0
+	start := len(history)
+	for start > 0 {
+		cost := EstimateTokens(history[start-1].Content)
+		if used+cost > budget-summaryBudget {
+			break
+		}
+		used += cost
+		start--
+	}
+
+	messages := make([]ChatMessage, 0, len(history)-start)
+	for _, msg := range history[start:] {
+		role := ChatRoleUser
+		if msg.Role == models.MessageRoleDoctor {
+			role = ChatRoleAssistant
+		}
+		messages = append(messages, ChatMessage{Role: role, Content: msg.Content})
+	}
+
+	// 已有对话摘要覆盖的消息不再压缩
+	older := history[:start]
+	for len(older) > 0 && !older[0].CreatedAt.After(summarizedUntil) {
+		older = older[1:]
+	}
+	if len(older) == 0 {
+		return messages, ""
+	}
+	return messages, summarizeHistory(older, summaryBudget)
+}
+
+// summarizeHistory 将早期对话压缩为每条一行的摘要，优先保留较近的消息
+func summarizeHistory(older []models.Message, budget int) string {
+	header := fmt.Sprintf("更早的%d条对话（%s 至 %s）摘要:\n",
+		len(older), older[0].CreatedAt.Format("2006-01-02"), older[len(older)-1].CreatedAt.Format("2006-01-02"))
+	used := EstimateTokens(header)
+	if used > budget {
+		return ""
+	}
+
+	var lines []string
+	for i := len(older) - 1; i >= 0; i-- {
+		msg := older[i]
+		speaker := "患者"
+		if msg.Role == models.MessageRoleDoctor {
+			speaker = "医生"
+		}
+		line := fmt.Sprintf("- %s %s: %s", msg.CreatedAt.Format("01-02"), speaker, truncateRunes(msg.Content, summaryMessageRunes))
+		cost := EstimateTokens(line)
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		lines = append([]string{line}, lines...)
+	}
+	return header + strings.Join(lines, "\n")
+}
+
+func truncateRunes(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	return string([]rune(text)[:max]) + "…"
+}
@@ -0,0 +1,61 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"we-dear/models"
+)
+
+func TestContextBuilderKeepsOldDiagnosesWithinBudget(t *testing.T) {
+	patient := &models.Patient{ChronicDiseases: []string{"2型糖尿病"}}
+	now := time.Now()
+
+	var records []models.MedicalRecord
+	for i := 0; i < 30; i++ {
+		records = append(records, models.MedicalRecord{
+			DiagnosisDate: now.AddDate(0, -i, 0),
+			Diagnosis:     fmt.Sprintf("上呼吸道感染%d", i),
+			Treatment:     strings.Repeat("对症治疗，多饮水休息。", 10),
+		})
+	}
+	// 最早的一条是与慢性病相关的关键诊断
+	records = append(records, models.MedicalRecord{
+		DiagnosisDate: now.AddDate(-10, 0, 0),
+		Diagnosis:     "2型糖尿病",
+		Prescription:  "二甲双胍 0.5g tid",
+	})
+
+	var history []models.Message
+	for i := 0; i < 50; i++ {
+		history = append(history, models.Message{
+			Content: strings.Repeat("今天血糖有点高，", 5),
+			Role:    models.MessageRolePatient,
+			BaseModel: models.BaseModel{
+				CreatedAt: now.Add(time.Duration(i-50) * time.Hour),
+			},
+		})
+	}
+
+	budget := 1500
+	ctx := NewContextBuilder(budget).Build(patient, "血糖偏高怎么办", records, nil, history)
+
+	total := 0
+	for _, tokens := range ctx.Tokens {
+		total += tokens
+	}
+	if total > budget {
+		t.Errorf("context uses %d tokens, budget %d", total, budget)
+	}
+	if !strings.Contains(ctx.MedicalRecords, "二甲双胍") {
+		t.Errorf("relevant old diagnosis was dropped:\n%s", ctx.MedicalRecords)
+	}
+	if len(ctx.History) == 0 || len(ctx.History) == len(history) {
+		t.Errorf("expected history to be trimmed, kept %d of %d", len(ctx.History), len(history))
+	}
+	if ctx.HistorySummary == "" {
+		t.Errorf("expected a summary of older messages")
+	}
+}
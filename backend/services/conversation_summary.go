@@ -0,0 +1,146 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+)
+
+// 单次摘要更新最多纳入的新消息数，积压更多时分多次更新
+const summaryBatchSize = 100
+
+// ConversationSummaryDue 判断患者未纳入摘要的消息是否已达到更新阈值
+func ConversationSummaryDue(patientID string) (bool, error) {
+	if config.GlobalConfig.AI.SummaryEvery <= 0 {
+		return false, nil
+	}
+	summaryStorage := storage.GetConversationSummaryStorage()
+	summary, err := summaryStorage.GetByPatientID(patientID)
+	if err != nil {
+		return false, err
+	}
+	var after time.Time
+	if summary != nil {
+		after = summary.LastMessageAt
+	}
+	count, err := summaryStorage.CountMessagesAfter(patientID, after)
+	if err != nil {
+		return false, err
+	}
+	return count >= int64(config.GlobalConfig.AI.SummaryEvery), nil
+}
+
+// UpdateConversationSummary 用上次摘要之后的新消息增量更新患者的对话摘要，没有新消息时返回原摘要。
+// 生成期间摘要被医生修正（版本号变化）时放弃本次结果并返回最新的摘要，未纳入的消息由下一次更新处理
+func (s *AIService) UpdateConversationSummary(patientID string) (*models.ConversationSummary, error) {
+	summaryStorage := storage.GetConversationSummaryStorage()
+	summary, err := summaryStorage.GetByPatientID(patientID)
+	if err != nil {
+		return nil, fmt.Errorf("获取对话摘要失败: %w", err)
+	}
+	if summary == nil {
+		now := time.Now()
+		summary = &models.ConversationSummary{
+			BaseModel: models.BaseModel{
+				ID:        utils.GenerateID(),
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			PatientID: patientID,
+		}
+	}
+
+	messages, err := summaryStorage.GetMessagesAfter(patientID, summary.LastMessageAt, summaryBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("获取聊天记录失败: %w", err)
+	}
+	if len(messages) == 0 {
+		return summary, nil
+	}
+
+	patient, err := storage.GetPatientStorage().GetPatientByID(patientID)
+	if err != nil {
+		return nil, fmt.Errorf("获取患者信息失败: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.callTimeout)
+	defer cancel()
+
+	resp, err := s.chat(ctx, aiCall{Purpose: models.AICallPurposeSummary, Patient: patient}, ChatRequest{
+		Messages: []ChatMessage{
+			{Role: ChatRoleSystem, Content: config.ConversationSummaryPrompt},
+			{Role: ChatRoleUser, Content: summaryInput(summary.Content, messages)},
+		},
+		Temperature: 0.3,
+		JSONMode:    true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("生成对话摘要失败: %w", err)
+	}
+
+	var result struct {
+		Summary string `json:"summary"`
+	}
+	if err := json.Unmarshal([]byte(stripJSONFence(resp.Content)), &result); err != nil {
+		return nil, fmt.Errorf("解析对话摘要失败: %w", err)
+	}
+	if strings.TrimSpace(result.Summary) == "" {
+		return nil, fmt.Errorf("模型返回的对话摘要为空")
+	}
+
+	version := summary.Version
+	applySummaryUpdate(summary, strings.TrimSpace(result.Summary), messages, modelName(resp, s.provider))
+	saved, err := summaryStorage.SaveIfVersion(summary, version)
+	if err != nil {
+		return nil, fmt.Errorf("保存对话摘要失败: %w", err)
+	}
+	if !saved {
+		log.Printf("对话摘要在生成期间已被修改，放弃本次更新 (PatientID: %s)", patientID)
+		latest, err := summaryStorage.GetByPatientID(patientID)
+		if err != nil {
+			return nil, fmt.Errorf("获取对话摘要失败: %w", err)
+		}
+		return latest, nil
+	}
+	return summary, nil
+}
+
+// applySummaryUpdate 用模型生成的内容更新摘要，已纳入的位置推进到本批最后一条消息
+func applySummaryUpdate(summary *models.ConversationSummary, content string, messages []models.Message, model string) {
+	last := messages[len(messages)-1]
+	summary.Content = content
+	summary.LastMessageID = last.ID
+	summary.LastMessageAt = last.CreatedAt
+	summary.MessageCount += len(messages)
+	summary.Version++
+	summary.ModelUsed = model
+}
+
+// summaryInput 组装摘要请求的输入：已有摘要和按时间排列的新增对话
+func summaryInput(previous string, messages []models.Message) string {
+	var builder strings.Builder
+	builder.WriteString("已有摘要：\n")
+	if previous == "" {
+		builder.WriteString("（暂无）\n")
+	} else {
+		builder.WriteString(previous)
+		builder.WriteString("\n")
+	}
+	builder.WriteString("\n新增对话：\n")
+	for _, msg := range messages {
+		speaker := "患者"
+		if msg.Role == models.MessageRoleDoctor {
+			speaker = "医生"
+		}
+		builder.WriteString(fmt.Sprintf("[%s] %s: %s\n", msg.CreatedAt.Format("2006-01-02 15:04"), speaker, msg.Content))
+	}
+	return builder.String()
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"we-dear/models"
+)
+
+func TestSummaryInput(t *testing.T) {
+	at := time.Date(2024, 12, 18, 8, 30, 0, 0, time.Local)
+	messages := []models.Message{
+		{Content: "今天空腹血糖7.8", Role: models.MessageRolePatient, BaseModel: models.BaseModel{CreatedAt: at}},
+		{Content: "二甲双胍继续按时服用", Role: models.MessageRoleDoctor, BaseModel: models.BaseModel{CreatedAt: at.Add(time.Hour)}},
+	}
+
+	input := summaryInput("", messages)
+	for _, want := range []string{"（暂无）", "[2024-12-18 08:30] 患者: 今天空腹血糖7.8", "[2024-12-18 09:30] 医生: 二甲双胍继续按时服用"} {
+		if !strings.Contains(input, want) {
+			t.Errorf("summary input missing %q:\n%s", want, input)
+		}
+	}
+	if input := summaryInput("患者有2型糖尿病", messages); !strings.Contains(input, "已有摘要：\n患者有2型糖尿病\n") || strings.Contains(input, "（暂无）") {
+		t.Errorf("summary input should start from the previous summary:\n%s", input)
+	}
+}
+
+func TestApplySummaryUpdateAdvancesToBatchEnd(t *testing.T) {
+	start := time.Date(2024, 12, 18, 8, 0, 0, 0, time.UTC)
+	summary := &models.ConversationSummary{Content: "旧摘要", MessageCount: 10, Version: 3}
+
+	// 积压的消息按批次纳入，每次只推进到本批最后一条
+	batch := make([]models.Message, summaryBatchSize)
+	for i := range batch {
+		batch[i] = models.Message{BaseModel: models.BaseModel{ID: fmt.Sprintf("m%d", i), CreatedAt: start.Add(time.Duration(i) * time.Minute)}}
+	}
+	applySummaryUpdate(summary, "新摘要", batch, "mock-model")
+
+	last := batch[len(batch)-1]
+	if summary.LastMessageID != last.ID || !summary.LastMessageAt.Equal(last.CreatedAt) {
+		t.Errorf("expected summary to cover up to %s at %v, got %s at %v", last.ID, last.CreatedAt, summary.LastMessageID, summary.LastMessageAt)
+	}
+	if summary.MessageCount != 10+summaryBatchSize || summary.Version != 4 || summary.Content != "新摘要" || summary.ModelUsed != "mock-model" {
+		t.Errorf("unexpected summary after update: %+v", summary)
+	}
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+)
+
+// MaxDeviceBatch 设备单次最多上传的读数数量
+const MaxDeviceBatch = 500
+
+// IssueDeviceCredential 为设备生成新的凭据并替换旧凭据，返回凭据原文（只在登记和重置时返回一次）；
+// api_key 方式只保存哈希，hmac 方式需要保存密钥原文用于校验签名
+func IssueDeviceCredential(device *models.Device) (string, error) {
+	key, err := utils.GenerateDeviceKey()
+	if err != nil {
+		return "", err
+	}
+	device.KeyPrefix = key[:12]
+	switch device.AuthType {
+	case models.DeviceAuthAPIKey:
+		device.KeyHash = utils.HashDeviceKey(key)
+		device.Secret = ""
+	case models.DeviceAuthHMAC:
+		device.Secret = key
+		device.KeyHash = ""
+	default:
+		return "", fmt.Errorf("不支持的认证方式: %s", device.AuthType)
+	}
+	return key, nil
+}
+
+// IngestDeviceReadings 保存设备上传的一批读数：无效的读数单独返回原因，不影响其他读数；
+// 幂等键已使用过或与已有数据重复的读数不再保存。数据库错误时返回 error，设备可整批重发
+func IngestDeviceReadings(device *models.Device, readings []IngestReading, now time.Time) ([]IngestResult, error) {
+	ingester := newReadingIngester(deviceReadingSource(device), now)
+	results := make([]IngestResult, 0, len(readings))
+	for i, reading := range readings {
+		result, err := ingester.ingest(i, reading)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	if err := storage.GetDeviceStorage().TouchLastSeen(device.ID, now); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func deviceReadingSource(device *models.Device) readingSource {
+	return readingSource{
+		PatientID:  device.PatientID,
+		Source:     models.PhysiologicalSourceDevice,
+		DeviceID:   device.ID,
+		DeviceInfo: deviceInfo(device),
+	}
+}
+
+// deviceInfo 生成保存在生理数据上的设备说明，如"欧姆龙 HEM-7136 (SN: A1234)"
+func deviceInfo(device *models.Device) string {
+	name := strings.TrimSpace(device.Manufacturer + " " + device.Model)
+	if name == "" {
+		return "SN: " + device.SerialNumber
+	}
+	return fmt.Sprintf("%s (SN: %s)", name, device.SerialNumber)
+}
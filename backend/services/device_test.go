@@ -0,0 +1,46 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"we-dear/models"
+)
+
+func TestDeviceReadingData(t *testing.T) {
+	now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.Local)
+	device := &models.Device{BaseModel: models.BaseModel{ID: "device1"}, PatientID: "patient1", SerialNumber: "A1234", Manufacturer: "欧姆龙", Model: "HEM-7136"}
+
+	data, err := newReadingIngester(deviceReadingSource(device), now).readingData(IngestReading{
+		IdempotencyKey: "A1234-0001",
+		Type:           "blood_pressure",
+		Values:         map[string]float64{"systolic": 138, "diastolic": 88},
+		MeasuredAt:     now.Add(-time.Hour),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if data.PatientID != "patient1" || data.Value != "138/88" || data.Source != models.PhysiologicalSourceDevice ||
+		data.Status != models.PhysiologicalStatusConfirmed || data.DeviceID != "device1" || data.IdempotencyKey != "A1234-0001" {
+		t.Errorf("unexpected data: %+v", data)
+	}
+	if data.DeviceInfo != "欧姆龙 HEM-7136 (SN: A1234)" {
+		t.Errorf("unexpected device info %q", data.DeviceInfo)
+	}
+
+	if data, err := newReadingIngester(deviceReadingSource(device), now).readingData(IngestReading{Type: "blood_sugar", Value: "6.5", Context: "空腹", MeasuredAt: now}); err != nil || data.Components["value"] != 6.5 {
+		t.Errorf("expected text value to be parsed, got %+v: %v", data, err)
+	}
+
+	invalid := []IngestReading{
+		{Type: "unknown", Value: "1", MeasuredAt: now},
+		{Type: "heart_rate", Value: "72"},
+		{Type: "heart_rate", Value: "72", MeasuredAt: now.Add(time.Hour)},
+		{Type: "heart_rate", Values: map[string]float64{"value": 400}, MeasuredAt: now},
+	}
+	for _, reading := range invalid {
+		if _, err := newReadingIngester(deviceReadingSource(device), now).readingData(reading); err == nil {
+			t.Errorf("expected %+v to be rejected", reading)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"we-dear/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Embedder 文本向量化接口，用于诊疗规范检索
+type Embedder interface {
+	// Name 嵌入方式及模型名称，保存在片段上，检索时只比较同一嵌入方式生成的向量
+	Name() string
+	// Embed 为每段文本生成向量，返回的向量已归一化
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// NewEmbedder 按配置创建嵌入器
+func NewEmbedder(cfg config.AIConfig) (Embedder, error) {
+	switch cfg.Embedder {
+	case "", "hashing":
+		return NewHashingEmbedder(hashingDimensions), nil
+	case "openai":
+		if cfg.OpenAIKey == "" {
+			return nil, fmt.Errorf("OpenAI API key未设置")
+		}
+		return newOpenAIEmbedder("openai", openai.DefaultConfig(cfg.OpenAIKey), cfg.EmbeddingModel), nil
+	case "openai_compatible":
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("OpenAI兼容接口地址未设置")
+		}
+		clientConfig := openai.DefaultConfig(cfg.APIKey)
+		clientConfig.BaseURL = cfg.BaseURL
+		return newOpenAIEmbedder("openai_compatible", clientConfig, cfg.EmbeddingModel), nil
+	}
+	return nil, fmt.Errorf("不支持的嵌入方式: %s", cfg.Embedder)
+}
+
+// 本地哈希嵌入的向量维度
+const hashingDimensions = 512
+
+// HashingEmbedder 本地哈希嵌入：中文按单字和相邻两字、英文和数字按单词切分，
+// 词频取对数后哈希到固定维度。不需要网络和模型，适合离线环境和测试
+type HashingEmbedder struct {
+	dimensions int
+}
+
+// NewHashingEmbedder 创建指定维度的哈希嵌入器
+func NewHashingEmbedder(dimensions int) *HashingEmbedder {
+	return &HashingEmbedder{dimensions: dimensions}
+}
+
+func (e *HashingEmbedder) Name() string {
+	return fmt.Sprintf("hashing-%d", e.dimensions)
+}
+
+func (e *HashingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		vectors[i] = e.embed(text)
+	}
+	return vectors, nil
+}
+
+func (e *HashingEmbedder) embed(text string) []float32 {
+	counts := map[string]int{}
+	for _, term := range hashingTerms(text) {
+		counts[term]++
+	}
+
+	vector := make([]float32, e.dimensions)
+	for term, count := range counts {
+		h := fnv.New64a()
+		h.Write([]byte(term))
+		sum := h.Sum64()
+		// 用哈希的最高位决定符号，减少冲突带来的偏差
+		sign := float32(1)
+		if sum>>63 == 1 {
+			sign = -1
+		}
+		vector[sum%uint64(e.dimensions)] += sign * float32(1+math.Log(float64(count)))
+	}
+	return normalizeVector(vector)
+}
+
+// hashingTerms 切分检索用的词项
+func hashingTerms(text string) []string {
+	var terms []string
+	var han []rune
+	var word []rune
+
+	flushHan := func() {
+		for i, r := range han {
+			terms = append(terms, string(r))
+			if i+1 < len(han) {
+				terms = append(terms, string(han[i:i+2]))
+			}
+		}
+		han = han[:0]
+	}
+	flushWord := func() {
+		if len(word) > 0 {
+			terms = append(terms, strings.ToLower(string(word)))
+			word = word[:0]
+		}
+	}
+
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushHan()
+			flushWord()
+		}
+	}
+	flushHan()
+	flushWord()
+	return terms
+}
+
+// openAIEmbedder 调用 OpenAI（或兼容）接口生成向量
+type openAIEmbedder struct {
+	name   string
+	model  string
+	client *openai.Client
+}
+
+func newOpenAIEmbedder(name string, clientConfig openai.ClientConfig, model string) *openAIEmbedder {
+	return &openAIEmbedder{
+		name:   name,
+		model:  model,
+		client: openai.NewClientWithConfig(clientConfig),
+	}
+}
+
+func (e *openAIEmbedder) Name() string {
+	return e.name + "-" + e.model
+}
+
+// Embed 调用嵌入接口，每次调用都计入AI用量（用途为 embedding）
+func (e *openAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	start := time.Now()
+	resp, err := e.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.EmbeddingModel(e.model),
+	})
+	recordEmbeddingUsage(ctx, e.name, e.model, resp.Usage.PromptTokens, err, time.Since(start))
+	if err != nil {
+		return nil, fmt.Errorf("%s 嵌入接口调用失败: %w", e.name, err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("%s 返回的向量数量不匹配: %d/%d", e.name, len(resp.Data), len(texts))
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range resp.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("%s 返回了无效的向量序号: %d", e.name, item.Index)
+		}
+		vectors[item.Index] = normalizeVector(item.Embedding)
+	}
+	return vectors, nil
+}
+
+func normalizeVector(vector []float32) []float32 {
+	var norm float64
+	for _, v := range vector {
+		norm += float64(v) * float64(v)
+	}
+	if norm == 0 {
+		return vector
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+	return vector
+}
@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+)
+
+// 规范片段的目标长度（字符），按段落累积到该长度后切分
+const guidelineChunkRunes = 500
+
+// 每批向量化的片段数
+const guidelineEmbedBatch = 32
+
+// 生成建议时检索诊疗规范的超时时间，超时后不引用规范，不影响建议生成
+const guidelineRetrievalTimeout = 5 * time.Second
+
+// GuidelineChunkText 切分后的规范片段
+type GuidelineChunkText struct {
+	Heading string
+	Content string
+}
+
+// Markdown 标题（# 标题）和规范文件常用的编号标题（4.1.2 报告卡修改功能）。编号标题的文字至少两个字，
+// 不含空白和句中标点，“2 片 每日三次”这类以数字开头的用法说明不会被当作标题
+var guidelineHeadingPattern = regexp.MustCompile(`^(#{1,6}\s+.+|\d+(\.\d+)*\s+[^\s\d，。；：！？,.;:!?][^\s，。；：！？,.;:!?]{1,39})$`)
+
+// ChunkGuideline 按章节和段落切分文档：遇到标题时开始新片段，
+// 同一章节内按行累积到 maxRunes 后切分，片段记录所在章节标题
+func ChunkGuideline(text string, maxRunes int) []GuidelineChunkText {
+	var chunks []GuidelineChunkText
+	heading := ""
+	var lines []string
+	size := 0
+
+	flush := func() {
+		content := strings.TrimSpace(strings.Join(lines, "\n"))
+		if content != "" {
+			chunks = append(chunks, GuidelineChunkText{Heading: heading, Content: content})
+		}
+		lines = nil
+		size = 0
+	}
+
+	for _, raw := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+		if guidelineHeadingPattern.MatchString(line) {
+			flush()
+			heading = strings.TrimSpace(strings.TrimLeft(line, "#"))
+			lines = append(lines, line)
+			size = utf8.RuneCountInString(line)
+			continue
+		}
+		lineRunes := utf8.RuneCountInString(line)
+		if size > 0 && size+lineRunes > maxRunes {
+			flush()
+		}
+		lines = append(lines, line)
+		size += lineRunes
+	}
+	flush()
+	return chunks
+}
+
+// ReadGuidelineFile 读取规范文档的纯文本。支持 Markdown 和文本文件；
+// PDF 需要系统中安装 pdftotext（poppler-utils）
+func ReadGuidelineFile(path string) (string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".md", ".markdown", ".txt":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return string(data), nil
+	case ".pdf":
+		if _, err := exec.LookPath("pdftotext"); err != nil {
+			return "", fmt.Errorf("导入PDF需要安装 pdftotext: %w", err)
+		}
+		out, err := exec.Command("pdftotext", "-layout", "-enc", "UTF-8", path, "-").Output()
+		if err != nil {
+			return "", fmt.Errorf("提取PDF文本失败: %w", err)
+		}
+		return string(out), nil
+	}
+	return "", fmt.Errorf("不支持的文件类型: %s", filepath.Ext(path))
+}
+
+// IngestGuideline 导入一个规范文档：切分、向量化并保存。内容和嵌入方式都没有变化时跳过，返回 false
+func IngestGuideline(ctx context.Context, embedder Embedder, path string) (bool, *models.GuidelineDocument, error) {
+	text, err := ReadGuidelineFile(path)
+	if err != nil {
+		return false, nil, err
+	}
+	sum := sha256.Sum256([]byte(text))
+	checksum := hex.EncodeToString(sum[:])
+
+	guidelineStorage := storage.GetGuidelineStorage()
+	source := filepath.ToSlash(path)
+	document, err := guidelineStorage.GetDocumentBySource(source)
+	if err != nil {
+		return false, nil, err
+	}
+	if document != nil && document.Checksum == checksum && document.Embedder == embedder.Name() {
+		return false, document, nil
+	}
+
+	now := time.Now()
+	if document == nil {
+		document = &models.GuidelineDocument{
+			BaseModel: models.BaseModel{
+				ID:        utils.GenerateID(),
+				CreatedAt: now,
+			},
+			Source: source,
+		}
+	}
+	document.UpdatedAt = now
+	document.Title = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	document.Checksum = checksum
+	document.Embedder = embedder.Name()
+
+	pieces := ChunkGuideline(text, guidelineChunkRunes)
+	chunks := make([]models.GuidelineChunk, 0, len(pieces))
+	for start := 0; start < len(pieces); start += guidelineEmbedBatch {
+		end := start + guidelineEmbedBatch
+		if end > len(pieces) {
+			end = len(pieces)
+		}
+		texts := make([]string, 0, end-start)
+		for _, piece := range pieces[start:end] {
+			// 标题一起参与向量化，提高章节级别问题的召回
+			texts = append(texts, piece.Heading+"\n"+piece.Content)
+		}
+		vectors, err := embedder.Embed(ctx, texts)
+		if err != nil {
+			return false, nil, err
+		}
+		for i, piece := range pieces[start:end] {
+			chunks = append(chunks, models.GuidelineChunk{
+				BaseModel: models.BaseModel{
+					ID:        utils.GenerateID(),
+					CreatedAt: now,
+					UpdatedAt: now,
+				},
+				DocumentID: document.ID,
+				Seq:        start + i,
+				Heading:    piece.Heading,
+				Content:    piece.Content,
+				Embedder:   embedder.Name(),
+				Embedding:  toFloat64s(vectors[i]),
+			})
+		}
+	}
+	document.ChunkCount = len(chunks)
+
+	if err := guidelineStorage.ReplaceDocument(document, chunks); err != nil {
+		return false, nil, fmt.Errorf("保存规范文档失败: %w", err)
+	}
+	return true, document, nil
+}
+
+// GuidelinePassage 检索到的规范片段
+type GuidelinePassage struct {
+	Index         int
+	DocumentID    string
+	DocumentTitle string
+	ChunkID       string
+	Heading       string
+	Content       string
+	Score         float64
+}
+
+// retrieveGuidelines 检索与患者问题相关的规范片段。查询文本先脱敏再向量化，
+// 检索失败不影响回复生成，只返回空结果
+func (s *AIService) retrieveGuidelines(ctx context.Context, patient *models.Patient, query string) []GuidelinePassage {
+	cfg := config.GlobalConfig.AI
+	if cfg.RAGTopK <= 0 || s.embedder == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(withUsagePatient(ctx, patient), guidelineRetrievalTimeout)
+	defer cancel()
+
+	query = NewPatientRedactor(patient).Redact(query)
+	vectors, err := s.embedder.Embed(ctx, []string{query})
+	if err != nil {
+		log.Printf("检索诊疗规范失败: %v", err)
+		return nil
+	}
+	matches, err := storage.GetGuidelineStorage().Search(s.embedder.Name(), toFloat64s(vectors[0]), cfg.RAGTopK)
+	if err != nil {
+		log.Printf("检索诊疗规范失败: %v", err)
+		return nil
+	}
+
+	var passages []GuidelinePassage
+	for _, match := range matches {
+		if match.Score < cfg.RAGMinScore {
+			continue
+		}
+		passages = append(passages, GuidelinePassage{
+			Index:         len(passages) + 1,
+			DocumentID:    match.Document.ID,
+			DocumentTitle: match.Document.Title,
+			ChunkID:       match.Chunk.ID,
+			Heading:       match.Chunk.Heading,
+			Content:       match.Chunk.Content,
+			Score:         match.Score,
+		})
+	}
+	return passages
+}
+
+// formatGuidelines 将片段格式化为带编号的摘录，超出预算的片段丢弃
+func formatGuidelines(passages []GuidelinePassage, budget int) (string, []GuidelinePassage) {
+	var builder strings.Builder
+	var used []GuidelinePassage
+	for _, passage := range passages {
+		text := fmt.Sprintf("[%d]《%s》%s\n%s\n", len(used)+1, passage.DocumentTitle, passage.Heading, passage.Content)
+		if EstimateTokens(builder.String()+text) > budget {
+			break
+		}
+		passage.Index = len(used) + 1
+		used = append(used, passage)
+		builder.WriteString(text)
+	}
+	return builder.String(), used
+}
+
+// newCitations 将提示中使用的片段转换为建议的引用记录
+func newCitations(suggestionID string, passages []GuidelinePassage) []models.SuggestionCitation {
+	now := time.Now()
+	citations := make([]models.SuggestionCitation, 0, len(passages))
+	for _, passage := range passages {
+		citations = append(citations, models.SuggestionCitation{
+			BaseModel: models.BaseModel{
+				ID:        utils.GenerateID(),
+				CreatedAt: now,
+				UpdatedAt: now,
+			},
+			SuggestionID:  suggestionID,
+			Index:         passage.Index,
+			DocumentID:    passage.DocumentID,
+			DocumentTitle: passage.DocumentTitle,
+			ChunkID:       passage.ChunkID,
+			Heading:       passage.Heading,
+			Excerpt:       passage.Content,
+			Score:         passage.Score,
+		})
+	}
+	return citations
+}
+
+func toFloat64s(vector []float32) []float64 {
+	result := make([]float64, len(vector))
+	for i, v := range vector {
+		result[i] = float64(v)
+	}
+	return result
+}
@@ -0,0 +1,51 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestChunkGuidelineKeepsHeadings(t *testing.T) {
+	text := "# 高血压防治指南\n前言内容。\n\n4.2 降压治疗的目标\n" +
+		strings.Repeat("一般高血压患者血压降至140/90mmHg以下。\n", 30) +
+		"5 糖尿病患者的血压管理\n糖尿病患者血压目标为130/80mmHg以下。\n用法：\n2 片 每日三次\n1 次/日，晨起服用。\n"
+
+	chunks := ChunkGuideline(text, 200)
+	if len(chunks) < 4 {
+		t.Fatalf("expected long section to be split, got %d chunks", len(chunks))
+	}
+	if chunks[0].Heading != "高血压防治指南" {
+		t.Errorf("first chunk heading = %q", chunks[0].Heading)
+	}
+	for _, chunk := range chunks[1 : len(chunks)-1] {
+		if chunk.Heading != "4.2 降压治疗的目标" {
+			t.Errorf("chunk in section 4.2 has heading %q", chunk.Heading)
+		}
+	}
+	if last := chunks[len(chunks)-1]; last.Heading != "5 糖尿病患者的血压管理" || !strings.Contains(last.Content, "2 片 每日三次") {
+		t.Errorf("dosage lines should stay in section 5, last chunk = %+v", last)
+	}
+}
+
+func TestHashingEmbedderRanksRelatedText(t *testing.T) {
+	embedder := NewHashingEmbedder(hashingDimensions)
+	vectors, err := embedder.Embed(context.Background(), []string{
+		"血压控制不好，降压药需要调整吗",
+		"高血压患者降压治疗的血压控制目标",
+		"糖尿病患者的饮食与运动指导",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dot := func(a, b []float32) float32 {
+		var sum float32
+		for i := range a {
+			sum += a[i] * b[i]
+		}
+		return sum
+	}
+	if related, unrelated := dot(vectors[0], vectors[1]), dot(vectors[0], vectors[2]); related <= unrelated {
+		t.Errorf("related score %.3f should exceed unrelated score %.3f", related, unrelated)
+	}
+}
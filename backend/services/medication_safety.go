@@ -0,0 +1,454 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+)
+
+// DrugContraindication 药物的禁忌或慎用情况
+type DrugContraindication struct {
+	Conditions []string // 病史关键字，与患者慢性病史和过敏史做包含匹配
+	Severity   string   // block 为禁用，warning 为慎用
+	Reason     string
+}
+
+// DrugRule 本地药物表中的一种药物
+type DrugRule struct {
+	Name    string   // 通用名
+	Aliases []string // 常见商品名或简称
+	Classes []string // 所属药物类别，患者对类别过敏时同样命中
+	// CrossReactive 可能交叉过敏的类别，患者对这些类别过敏时给出慎用警告
+	CrossReactive     []string
+	Contraindications []DrugContraindication
+}
+
+// 同类药物共用的禁忌
+var (
+	quinoloneContraindications = []DrugContraindication{
+		{Conditions: []string{"重症肌无力"}, Severity: models.SafetySeverityBlock, Reason: "喹诺酮类可加重重症肌无力"},
+		{Conditions: []string{"癫痫"}, Severity: models.SafetySeverityWarning, Reason: "喹诺酮类可降低癫痫发作阈值"},
+	}
+	nsaidContraindications = []DrugContraindication{
+		{Conditions: []string{"消化性溃疡", "胃溃疡", "十二指肠溃疡", "消化道出血"}, Severity: models.SafetySeverityBlock, Reason: "可诱发或加重消化道出血"},
+		{Conditions: []string{"肾功能不全", "慢性肾病", "肾衰竭"}, Severity: models.SafetySeverityWarning, Reason: "可进一步损害肾功能"},
+		{Conditions: []string{"心力衰竭", "心衰"}, Severity: models.SafetySeverityWarning, Reason: "可引起水钠潴留，加重心衰"},
+	}
+	sulfonylureaContraindications = []DrugContraindication{
+		{Conditions: []string{"1型糖尿病"}, Severity: models.SafetySeverityBlock, Reason: "1型糖尿病不宜使用磺脲类"},
+		{Conditions: []string{"肾功能不全", "肝功能不全"}, Severity: models.SafetySeverityWarning, Reason: "增加低血糖风险"},
+	}
+	aceiContraindications = []DrugContraindication{
+		{Conditions: []string{"妊娠", "怀孕"}, Severity: models.SafetySeverityBlock, Reason: "妊娠期禁用，有致畸风险"},
+		{Conditions: []string{"血管性水肿"}, Severity: models.SafetySeverityBlock, Reason: "可诱发血管性水肿"},
+		{Conditions: []string{"肾动脉狭窄", "高钾血症"}, Severity: models.SafetySeverityWarning, Reason: "可致肾功能恶化或血钾升高"},
+	}
+	arbContraindications = []DrugContraindication{
+		{Conditions: []string{"妊娠", "怀孕"}, Severity: models.SafetySeverityBlock, Reason: "妊娠期禁用，有致畸风险"},
+		{Conditions: []string{"肾动脉狭窄", "高钾血症"}, Severity: models.SafetySeverityWarning, Reason: "可致肾功能恶化或血钾升高"},
+	}
+	betaBlockerContraindications = []DrugContraindication{
+		{Conditions: []string{"哮喘"}, Severity: models.SafetySeverityBlock, Reason: "可诱发支气管痉挛"},
+		{Conditions: []string{"房室传导阻滞", "心动过缓", "病态窦房结"}, Severity: models.SafetySeverityBlock, Reason: "可加重传导阻滞或心动过缓"},
+		{Conditions: []string{"慢阻肺", "COPD"}, Severity: models.SafetySeverityWarning, Reason: "可能加重气道痉挛"},
+	}
+	diureticContraindications = []DrugContraindication{
+		{Conditions: []string{"痛风", "高尿酸"}, Severity: models.SafetySeverityWarning, Reason: "可升高血尿酸，诱发痛风"},
+	}
+	statinContraindications = []DrugContraindication{
+		{Conditions: []string{"活动性肝病", "肝功能不全", "肝硬化"}, Severity: models.SafetySeverityBlock, Reason: "活动性肝病禁用他汀类"},
+		{Conditions: []string{"妊娠", "怀孕"}, Severity: models.SafetySeverityBlock, Reason: "妊娠期禁用"},
+	}
+	nitrateContraindications = []DrugContraindication{
+		{Conditions: []string{"青光眼"}, Severity: models.SafetySeverityWarning, Reason: "可升高眼压"},
+		{Conditions: []string{"低血压"}, Severity: models.SafetySeverityWarning, Reason: "可进一步降低血压"},
+	}
+	glucocorticoidContraindications = []DrugContraindication{
+		{Conditions: []string{"糖尿病"}, Severity: models.SafetySeverityWarning, Reason: "可升高血糖"},
+		{Conditions: []string{"消化性溃疡", "胃溃疡"}, Severity: models.SafetySeverityWarning, Reason: "可诱发或加重溃疡"},
+	}
+	insulinContraindications = []DrugContraindication{
+		{Conditions: []string{"低血糖"}, Severity: models.SafetySeverityWarning, Reason: "低血糖发作期间不宜使用"},
+	}
+)
+
+// DrugRules 慢病管理中常见药物的过敏类别和禁忌，按需补充。每种药物单独一条，别名只放同一药物的商品名或简称；
+// 同类药物通过 Classes 关联，对同类其他药物过敏时给出慎用警告
+var DrugRules = []DrugRule{
+	{Name: "青霉素", Aliases: []string{"青霉素G", "苄星青霉素"}, Classes: []string{"青霉素类", "β-内酰胺类"}},
+	{Name: "阿莫西林", Aliases: []string{"阿莫仙", "阿莫西林克拉维酸钾"}, Classes: []string{"青霉素类", "β-内酰胺类"}},
+	// 未写明具体药物的“头孢”，提到具体头孢菌素时以具体药物为准
+	{Name: "头孢", Classes: []string{"头孢菌素类", "β-内酰胺类"}, CrossReactive: []string{"青霉素"}},
+	{Name: "头孢呋辛", Classes: []string{"头孢菌素类", "β-内酰胺类"}, CrossReactive: []string{"青霉素"}},
+	{Name: "头孢克肟", Classes: []string{"头孢菌素类", "β-内酰胺类"}, CrossReactive: []string{"青霉素"}},
+	{Name: "头孢曲松", Classes: []string{"头孢菌素类", "β-内酰胺类"}, CrossReactive: []string{"青霉素"}},
+	{Name: "头孢拉定", Classes: []string{"头孢菌素类", "β-内酰胺类"}, CrossReactive: []string{"青霉素"}},
+	{Name: "头孢氨苄", Classes: []string{"头孢菌素类", "β-内酰胺类"}, CrossReactive: []string{"青霉素"}},
+	{Name: "阿奇霉素", Aliases: []string{"希舒美"}, Classes: []string{"大环内酯类"}},
+	{Name: "左氧氟沙星", Aliases: []string{"可乐必妥"}, Classes: []string{"喹诺酮类", "沙星类"}, Contraindications: quinoloneContraindications},
+	{Name: "莫西沙星", Classes: []string{"喹诺酮类", "沙星类"}, Contraindications: quinoloneContraindications},
+	{Name: "环丙沙星", Classes: []string{"喹诺酮类", "沙星类"}, Contraindications: quinoloneContraindications},
+	{Name: "磺胺甲噁唑", Aliases: []string{"复方新诺明", "复方磺胺甲噁唑"}, Classes: []string{"磺胺类"}},
+	{Name: "阿司匹林", Aliases: []string{"拜阿司匹灵"}, Classes: []string{"非甾体抗炎药", "水杨酸类"},
+		Contraindications: []DrugContraindication{
+			{Conditions: []string{"消化性溃疡", "胃溃疡", "十二指肠溃疡", "消化道出血"}, Severity: models.SafetySeverityBlock, Reason: "可诱发或加重消化道出血"},
+			{Conditions: []string{"哮喘"}, Severity: models.SafetySeverityWarning, Reason: "可诱发阿司匹林哮喘"},
+			{Conditions: []string{"血友病", "出血倾向"}, Severity: models.SafetySeverityBlock, Reason: "抑制血小板功能，增加出血风险"},
+		}},
+	{Name: "布洛芬", Aliases: []string{"芬必得", "美林"}, Classes: []string{"非甾体抗炎药"}, Contraindications: nsaidContraindications},
+	{Name: "双氯芬酸", Classes: []string{"非甾体抗炎药"}, Contraindications: nsaidContraindications},
+	{Name: "塞来昔布", Classes: []string{"非甾体抗炎药"}, CrossReactive: []string{"磺胺"}, Contraindications: nsaidContraindications},
+	{Name: "二甲双胍", Aliases: []string{"格华止"}, Classes: []string{"双胍类"},
+		Contraindications: []DrugContraindication{
+			{Conditions: []string{"肾功能不全", "肾衰竭", "尿毒症"}, Severity: models.SafetySeverityBlock, Reason: "肾功能不全时有乳酸酸中毒风险"},
+			{Conditions: []string{"肝硬化", "肝功能不全"}, Severity: models.SafetySeverityWarning, Reason: "肝功能不全时有乳酸酸中毒风险"},
+		}},
+	{Name: "格列本脲", Aliases: []string{"优降糖"}, Classes: []string{"磺脲类"}, CrossReactive: []string{"磺胺"}, Contraindications: sulfonylureaContraindications},
+	{Name: "格列美脲", Classes: []string{"磺脲类"}, CrossReactive: []string{"磺胺"}, Contraindications: sulfonylureaContraindications},
+	{Name: "格列齐特", Classes: []string{"磺脲类"}, CrossReactive: []string{"磺胺"}, Contraindications: sulfonylureaContraindications},
+	{Name: "格列吡嗪", Classes: []string{"磺脲类"}, CrossReactive: []string{"磺胺"}, Contraindications: sulfonylureaContraindications},
+	{Name: "卡托普利", Classes: []string{"ACEI", "普利类"}, Contraindications: aceiContraindications},
+	{Name: "依那普利", Classes: []string{"ACEI", "普利类"}, Contraindications: aceiContraindications},
+	{Name: "贝那普利", Classes: []string{"ACEI", "普利类"}, Contraindications: aceiContraindications},
+	{Name: "培哚普利", Classes: []string{"ACEI", "普利类"}, Contraindications: aceiContraindications},
+	{Name: "福辛普利", Classes: []string{"ACEI", "普利类"}, Contraindications: aceiContraindications},
+	{Name: "氯沙坦", Classes: []string{"ARB", "沙坦类"}, Contraindications: arbContraindications},
+	{Name: "缬沙坦", Classes: []string{"ARB", "沙坦类"}, Contraindications: arbContraindications},
+	{Name: "厄贝沙坦", Classes: []string{"ARB", "沙坦类"}, Contraindications: arbContraindications},
+	{Name: "替米沙坦", Classes: []string{"ARB", "沙坦类"}, Contraindications: arbContraindications},
+	{Name: "坎地沙坦", Classes: []string{"ARB", "沙坦类"}, Contraindications: arbContraindications},
+	{Name: "美托洛尔", Aliases: []string{"倍他乐克"}, Classes: []string{"β受体阻滞剂", "洛尔类"}, Contraindications: betaBlockerContraindications},
+	{Name: "比索洛尔", Classes: []string{"β受体阻滞剂", "洛尔类"}, Contraindications: betaBlockerContraindications},
+	{Name: "普萘洛尔", Classes: []string{"β受体阻滞剂", "洛尔类"}, Contraindications: betaBlockerContraindications},
+	{Name: "阿替洛尔", Classes: []string{"β受体阻滞剂", "洛尔类"}, Contraindications: betaBlockerContraindications},
+	{Name: "氨氯地平", Aliases: []string{"络活喜"}, Classes: []string{"钙通道阻滞剂", "地平类"}},
+	{Name: "硝苯地平", Classes: []string{"钙通道阻滞剂", "地平类"}},
+	{Name: "非洛地平", Classes: []string{"钙通道阻滞剂", "地平类"}},
+	{Name: "氢氯噻嗪", Aliases: []string{"双氢克尿噻"}, Classes: []string{"噻嗪类利尿剂"}, CrossReactive: []string{"磺胺"}, Contraindications: diureticContraindications},
+	{Name: "吲达帕胺", Classes: []string{"噻嗪类利尿剂"}, CrossReactive: []string{"磺胺"}, Contraindications: diureticContraindications},
+	{Name: "呋塞米", Aliases: []string{"速尿"}, Classes: []string{"袢利尿剂"}, CrossReactive: []string{"磺胺"}, Contraindications: diureticContraindications},
+	{Name: "螺内酯", Aliases: []string{"安体舒通"}, Classes: []string{"保钾利尿剂"},
+		Contraindications: []DrugContraindication{
+			{Conditions: []string{"高钾血症"}, Severity: models.SafetySeverityBlock, Reason: "可进一步升高血钾"},
+			{Conditions: []string{"肾功能不全", "肾衰竭"}, Severity: models.SafetySeverityWarning, Reason: "易致高钾血症"},
+		}},
+	{Name: "华法林", Aliases: []string{"华法令"}, Classes: []string{"抗凝药"},
+		Contraindications: []DrugContraindication{
+			{Conditions: []string{"消化道出血", "脑出血", "出血倾向", "血友病"}, Severity: models.SafetySeverityBlock, Reason: "增加出血风险"},
+			{Conditions: []string{"妊娠", "怀孕"}, Severity: models.SafetySeverityBlock, Reason: "妊娠期禁用，有致畸风险"},
+		}},
+	{Name: "阿托伐他汀", Aliases: []string{"立普妥"}, Classes: []string{"他汀类"}, Contraindications: statinContraindications},
+	{Name: "瑞舒伐他汀", Classes: []string{"他汀类"}, Contraindications: statinContraindications},
+	{Name: "辛伐他汀", Classes: []string{"他汀类"}, Contraindications: statinContraindications},
+	{Name: "普伐他汀", Classes: []string{"他汀类"}, Contraindications: statinContraindications},
+	{Name: "硝酸甘油", Classes: []string{"硝酸酯类"}, Contraindications: nitrateContraindications},
+	{Name: "单硝酸异山梨酯", Classes: []string{"硝酸酯类"}, Contraindications: nitrateContraindications},
+	{Name: "硝酸异山梨酯", Classes: []string{"硝酸酯类"}, Contraindications: nitrateContraindications},
+	{Name: "泼尼松", Aliases: []string{"强的松"}, Classes: []string{"糖皮质激素", "激素"}, Contraindications: glucocorticoidContraindications},
+	{Name: "地塞米松", Classes: []string{"糖皮质激素", "激素"}, Contraindications: glucocorticoidContraindications},
+	{Name: "甲泼尼龙", Classes: []string{"糖皮质激素", "激素"}, Contraindications: glucocorticoidContraindications},
+	// 未写明具体制剂的“胰岛素”，提到具体胰岛素时以具体药物为准
+	{Name: "胰岛素", Classes: []string{"胰岛素类"}, Contraindications: insulinContraindications},
+	{Name: "门冬胰岛素", Classes: []string{"胰岛素类"}, Contraindications: insulinContraindications},
+	{Name: "甘精胰岛素", Classes: []string{"胰岛素类"}, Contraindications: insulinContraindications},
+	{Name: "赖脯胰岛素", Classes: []string{"胰岛素类"}, Contraindications: insulinContraindications},
+}
+
+// 药物前面出现这些词时视为建议不要使用，不做检查
+var drugNegations = []string{"不要", "不宜", "避免", "禁用", "停用", "停止", "停服", "勿", "忌", "不能", "不可"}
+
+// 否定词与药名之间允许的最大距离（字符），如“不要自行服用阿司匹林”
+const drugNegationWindow = 6
+
+// CheckMedicationSafety 检查文本中提到的药物是否与患者过敏史或病史冲突
+func CheckMedicationSafety(patient *models.Patient, text string) []models.SuggestionSafetyWarning {
+	var warnings []models.SuggestionSafetyWarning
+	seen := map[string]bool{}
+	add := func(warning models.SuggestionSafetyWarning) {
+		key := warning.Type + "|" + warning.Drug + "|" + warning.Matched
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		warnings = append(warnings, warning)
+	}
+
+	mentions := make([]string, len(DrugRules))
+	for i, rule := range DrugRules {
+		mentions[i] = rule.mentionedIn(text)
+	}
+
+	for i, rule := range DrugRules {
+		drug := mentions[i]
+		if drug == "" || partOfLongerMention(drug, mentions) {
+			continue
+		}
+
+		for _, allergy := range patient.Allergies {
+			allergy = strings.TrimSpace(allergy)
+			if allergy == "" || allergy == "无" {
+				continue
+			}
+			if rule.matchesAllergy(drug, allergy) {
+				add(models.SuggestionSafetyWarning{
+					Type:     models.SafetyWarningTypeAllergy,
+					Severity: models.SafetySeverityBlock,
+					Drug:     drug,
+					Matched:  allergy,
+					Message:  fmt.Sprintf("患者对%s过敏，建议中包含%s", allergy, drug),
+				})
+				continue
+			}
+			for _, class := range rule.CrossReactive {
+				if strings.Contains(allergy, class) {
+					add(models.SuggestionSafetyWarning{
+						Type:     models.SafetyWarningTypeAllergy,
+						Severity: models.SafetySeverityWarning,
+						Drug:     drug,
+						Matched:  allergy,
+						Message:  fmt.Sprintf("患者对%s过敏，%s可能存在交叉过敏", allergy, drug),
+					})
+					break
+				}
+			}
+			if class := rule.relatedAllergyClass(allergy); class != "" {
+				add(models.SuggestionSafetyWarning{
+					Type:     models.SafetyWarningTypeAllergy,
+					Severity: models.SafetySeverityWarning,
+					Drug:     drug,
+					Matched:  allergy,
+					Message:  fmt.Sprintf("患者对%s过敏，%s与其同属%s，可能存在交叉过敏", allergy, drug, class),
+				})
+			}
+		}
+
+		for _, item := range rule.Contraindications {
+			for _, disease := range patient.ChronicDiseases {
+				if condition := matchCondition(disease, item.Conditions); condition != "" {
+					add(models.SuggestionSafetyWarning{
+						Type:     models.SafetyWarningTypeContraindication,
+						Severity: item.Severity,
+						Drug:     drug,
+						Matched:  disease,
+						Message:  fmt.Sprintf("患者有%s病史，%s%s：%s", disease, drug, severityLabel(item.Severity), item.Reason),
+					})
+				}
+			}
+		}
+	}
+	return warnings
+}
+
+// mentionedIn 返回文本中以非否定形式提到的药名（通用名或别名）
+func (r DrugRule) mentionedIn(text string) string {
+	names := append([]string{r.Name}, r.Aliases...)
+	// 先匹配较长的名称，“阿莫西林克拉维酸钾”不会被记为“阿莫西林”
+	sort.SliceStable(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j])
+	})
+	for _, name := range names {
+		if containsDrugMention(text, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// matchesAllergy 过敏史中包含药名、通用名或所属类别时命中
+func (r DrugRule) matchesAllergy(drug string, allergy string) bool {
+	candidates := append([]string{drug, r.Name}, r.Classes...)
+	for _, candidate := range candidates {
+		if strings.Contains(allergy, candidate) || strings.Contains(candidate, allergy) {
+			return true
+		}
+	}
+	// “青霉素类过敏”与类别“青霉素类”、“磺胺过敏”与类别“磺胺类”
+	allergy = strings.TrimSuffix(strings.TrimSuffix(allergy, "过敏"), "类")
+	for _, class := range r.Classes {
+		if allergy != "" && strings.HasPrefix(class, allergy) {
+			return true
+		}
+	}
+	return false
+}
+
+// relatedAllergyClass 过敏史中是同类的其他药物时返回共同的类别，如布洛芬过敏时塞来昔布返回非甾体抗炎药
+func (r DrugRule) relatedAllergyClass(allergy string) string {
+	for _, other := range DrugRules {
+		if other.Name == r.Name || !other.namedIn(allergy) {
+			continue
+		}
+		for _, class := range other.Classes {
+			for _, own := range r.Classes {
+				if class == own {
+					return class
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// namedIn 文本中是否出现该药物的通用名或别名
+func (r DrugRule) namedIn(text string) bool {
+	for _, name := range append([]string{r.Name}, r.Aliases...) {
+		if strings.Contains(text, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// partOfLongerMention 药名是否只是文本中另一个药名的一部分，如“头孢克肟”中的“头孢”、“门冬胰岛素”中的“胰岛素”
+func partOfLongerMention(drug string, mentions []string) bool {
+	for _, mention := range mentions {
+		if len(mention) > len(drug) && strings.Contains(mention, drug) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchCondition(disease string, conditions []string) string {
+	for _, condition := range conditions {
+		if strings.Contains(disease, condition) {
+			return condition
+		}
+	}
+	return ""
+}
+
+func severityLabel(severity string) string {
+	if severity == models.SafetySeverityBlock {
+		return "禁用"
+	}
+	return "慎用"
+}
+
+// containsDrugMention 判断文本中是否以用药建议的形式提到药物：前面一小段内没有否定词，后面不是“过敏”
+func containsDrugMention(text string, name string) bool {
+	offset := 0
+	for {
+		index := strings.Index(text[offset:], name)
+		if index < 0 {
+			return false
+		}
+		start := offset + index
+		prefix := []rune(text[:start])
+		if len(prefix) > drugNegationWindow {
+			prefix = prefix[len(prefix)-drugNegationWindow:]
+		}
+		// 否定只在同一分句内有效
+		window := string(prefix)
+		if cut := strings.LastIndexAny(window, "，。；！？,.;!?\n"); cut >= 0 {
+			window = window[cut+1:]
+		}
+		// “对青霉素过敏”是在描述过敏史，不是用药建议
+		rest := strings.TrimPrefix(text[start+len(name):], "类")
+		negated := strings.HasPrefix(rest, "过敏")
+		for _, negation := range drugNegations {
+			if strings.Contains(window, negation) {
+				negated = true
+				break
+			}
+		}
+		if !negated {
+			return true
+		}
+		offset = start + len(name)
+	}
+}
+
+// ApplyMedicationSafety 检查建议内容，记录警告并设置安全状态
+func ApplyMedicationSafety(patient *models.Patient, suggestion *models.AISuggestion) {
+	warnings := CheckMedicationSafety(patient, suggestion.Content)
+	now := time.Now()
+	suggestion.SafetyStatus = models.AISuggestionSafetyClear
+	for i := range warnings {
+		warnings[i].BaseModel = models.BaseModel{
+			ID:        utils.GenerateID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		warnings[i].SuggestionID = suggestion.ID
+		warnings[i].PatientID = patient.ID
+		if warnings[i].Severity == models.SafetySeverityBlock {
+			suggestion.SafetyStatus = models.AISuggestionSafetyBlocked
+		} else if suggestion.SafetyStatus == models.AISuggestionSafetyClear {
+			suggestion.SafetyStatus = models.AISuggestionSafetyWarning
+		}
+	}
+	suggestion.SafetyWarnings = warnings
+}
+
+// UnresolvedSafetyWarnings 返回医生即将发送的内容中仍未确认的用药安全警告，existing 为已记录的警告。
+// 医生修改后的内容重新检查，已确认过的同一药物和病史不再拦截；新出现的警告没有ID
+func UnresolvedSafetyWarnings(patient *models.Patient, existing []models.SuggestionSafetyWarning, content string) []models.SuggestionSafetyWarning {
+	acknowledged := map[string]bool{}
+	for _, warning := range existing {
+		if warning.AcknowledgedBy != "" {
+			acknowledged[warning.Type+"|"+warning.Drug+"|"+warning.Matched] = true
+		}
+	}
+
+	var unresolved []models.SuggestionSafetyWarning
+	for _, warning := range CheckMedicationSafety(patient, content) {
+		if acknowledged[warning.Type+"|"+warning.Drug+"|"+warning.Matched] {
+			continue
+		}
+		// 沿用已有的警告ID，方便前端直接确认
+		for _, record := range existing {
+			if record.Type == warning.Type && record.Drug == warning.Drug && record.Matched == warning.Matched {
+				warning = record
+				break
+			}
+		}
+		unresolved = append(unresolved, warning)
+	}
+	return unresolved
+}
+
+// CheckDoctorMessageSafety 检查医生即将发送的内容，返回仍需确认的警告。采用AI建议时对照建议上的警告，
+// 否则对照患者待发送消息的警告；新出现的警告（医生修改或自己撰写的内容引入的）保存后返回，以便按ID确认：
+// 采用建议时记在该建议上，否则记为待发送警告，消息发送后通过 AttachDrafts 关联到消息
+func CheckDoctorMessageSafety(patient *models.Patient, suggestion *models.AISuggestion, content string, now time.Time) ([]models.SuggestionSafetyWarning, error) {
+	warningStorage := storage.GetSafetyWarningStorage()
+
+	var existing []models.SuggestionSafetyWarning
+	suggestionID := ""
+	if suggestion != nil {
+		existing = suggestion.SafetyWarnings
+		suggestionID = suggestion.ID
+	} else {
+		drafts, err := warningStorage.ListDrafts(patient.ID)
+		if err != nil {
+			return nil, err
+		}
+		existing = drafts
+	}
+
+	unresolved := UnresolvedSafetyWarnings(patient, existing, content)
+	var created []models.SuggestionSafetyWarning
+	for i := range unresolved {
+		if unresolved[i].ID != "" {
+			continue
+		}
+		unresolved[i].BaseModel = models.BaseModel{
+			ID:        utils.GenerateID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		unresolved[i].SuggestionID = suggestionID
+		unresolved[i].PatientID = patient.ID
+		created = append(created, unresolved[i])
+	}
+	if err := warningStorage.Create(created); err != nil {
+		return nil, err
+	}
+	return unresolved, nil
+}
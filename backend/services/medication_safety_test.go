@@ -0,0 +1,105 @@
+package services
+
+import (
+	"testing"
+
+	"we-dear/models"
+)
+
+func TestCheckMedicationSafety(t *testing.T) {
+	patient := &models.Patient{
+		Allergies:       []string{"青霉素"},
+		ChronicDiseases: []string{"支气管哮喘", "2型糖尿病"},
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		want     map[string]string // 药物 -> 严重程度
+		wantSafe bool
+	}{
+		{name: "过敏药物", text: "建议口服阿莫西林0.5g，每日三次。", want: map[string]string{"阿莫西林": models.SafetySeverityBlock}},
+		{name: "交叉过敏", text: "可以使用头孢克肟治疗。", want: map[string]string{"头孢克肟": models.SafetySeverityWarning}},
+		{name: "病史禁忌", text: "可加用倍他乐克控制心率。", want: map[string]string{"倍他乐克": models.SafetySeverityBlock}},
+		{name: "否定提及", text: "您对青霉素过敏，请不要服用阿莫西林。", wantSafe: true},
+		{name: "无关药物", text: "继续服用二甲双胍，注意监测血糖。", wantSafe: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			warnings := CheckMedicationSafety(patient, tt.text)
+			if tt.wantSafe {
+				if len(warnings) > 0 {
+					t.Fatalf("expected no warnings, got %+v", warnings)
+				}
+				return
+			}
+			if len(warnings) != len(tt.want) {
+				t.Fatalf("expected %d warnings, got %+v", len(tt.want), warnings)
+			}
+			for _, warning := range warnings {
+				if severity, ok := tt.want[warning.Drug]; !ok || severity != warning.Severity {
+					t.Errorf("unexpected warning %+v", warning)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckMedicationSafetyRelatedDrugs(t *testing.T) {
+	tests := []struct {
+		name    string
+		allergy string
+		text    string
+		want    map[string]string // 药物 -> 严重程度
+	}{
+		{name: "同类药物只警告", allergy: "布洛芬过敏", text: "疼痛时可服用塞来昔布。", want: map[string]string{"塞来昔布": models.SafetySeverityWarning}},
+		{name: "同一药物仍禁用", allergy: "布洛芬过敏", text: "疼痛时可服用芬必得。", want: map[string]string{"芬必得": models.SafetySeverityBlock}},
+		{name: "喹诺酮类", allergy: "左氧氟沙星", text: "改用莫西沙星抗感染。", want: map[string]string{"莫西沙星": models.SafetySeverityWarning}},
+		{name: "具体头孢菌素", allergy: "头孢曲松", text: "可以使用头孢克肟治疗。", want: map[string]string{"头孢克肟": models.SafetySeverityWarning}},
+		{name: "类别过敏", allergy: "非甾体抗炎药", text: "可以使用双氯芬酸。", want: map[string]string{"双氯芬酸": models.SafetySeverityBlock}},
+		{name: "无关类别", allergy: "布洛芬", text: "继续服用阿托伐他汀。", want: map[string]string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			patient := &models.Patient{Allergies: []string{tt.allergy}}
+			warnings := CheckMedicationSafety(patient, tt.text)
+			if len(warnings) != len(tt.want) {
+				t.Fatalf("expected %d warnings, got %+v", len(tt.want), warnings)
+			}
+			for _, warning := range warnings {
+				if severity, ok := tt.want[warning.Drug]; !ok || severity != warning.Severity {
+					t.Errorf("unexpected warning %+v", warning)
+				}
+			}
+		})
+	}
+}
+
+func TestUnresolvedSafetyWarningsHonorsAcknowledgement(t *testing.T) {
+	patient := &models.Patient{Allergies: []string{"青霉素类"}}
+	suggestion := &models.AISuggestion{Content: "建议服用阿莫西林。"}
+	ApplyMedicationSafety(patient, suggestion)
+	if suggestion.SafetyStatus != models.AISuggestionSafetyBlocked || len(suggestion.SafetyWarnings) != 1 {
+		t.Fatalf("expected a blocking warning, got %s %+v", suggestion.SafetyStatus, suggestion.SafetyWarnings)
+	}
+
+	if unresolved := UnresolvedSafetyWarnings(patient, suggestion.SafetyWarnings, suggestion.Content); len(unresolved) != 1 {
+		t.Fatalf("expected unacknowledged warning to block sending, got %+v", unresolved)
+	}
+	if unresolved := UnresolvedSafetyWarnings(patient, suggestion.SafetyWarnings, "建议多饮水，注意休息。"); len(unresolved) != 0 {
+		t.Fatalf("edited content without the drug should pass, got %+v", unresolved)
+	}
+
+	suggestion.SafetyWarnings[0].AcknowledgedBy = "doctor1"
+	if unresolved := UnresolvedSafetyWarnings(patient, suggestion.SafetyWarnings, suggestion.Content); len(unresolved) != 0 {
+		t.Fatalf("acknowledged warning should not block sending, got %+v", unresolved)
+	}
+	if unresolved := UnresolvedSafetyWarnings(patient, suggestion.SafetyWarnings, "建议服用阿莫西林或青霉素G。"); len(unresolved) != 1 || unresolved[0].ID != "" {
+		t.Fatalf("newly added drug should need acknowledgement as a new warning, got %+v", unresolved)
+	}
+	if unresolved := UnresolvedSafetyWarnings(patient, nil, suggestion.Content); len(unresolved) != 1 {
+		t.Fatalf("content written without a suggestion should still be checked, got %+v", unresolved)
+	}
+}
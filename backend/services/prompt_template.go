@@ -0,0 +1,184 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/storage"
+)
+
+// 内置模板的版本号，数据库中没有可用模板时使用
+const builtinTemplateVersion = "builtin"
+
+// PromptTemplateContent AIAgentTemplate.Content 的JSON结构
+type PromptTemplateContent struct {
+	SystemPrompt string   `json:"systemPrompt"`          // 系统提示，支持 {{变量}} 占位
+	Temperature  *float32 `json:"temperature,omitempty"` // 可选，覆盖默认温度
+	MaxTokens    *int     `json:"maxTokens,omitempty"`   // 可选，覆盖默认最大token数
+}
+
+// PromptTemplate 解析后可直接渲染的模板
+type PromptTemplate struct {
+	ID       string
+	Name     string
+	Version  string
+	Category string
+	Content  PromptTemplateContent
+}
+
+// PromptVariables 模板中可以使用的变量及说明
+var PromptVariables = map[string]string{
+	"patient_name":         "患者姓名",
+	"patient_gender":       "患者性别",
+	"patient_age":          "患者年龄",
+	"blood_type":           "血型",
+	"allergies":            "过敏史（顿号分隔）",
+	"chronic_diseases":     "慢性病史（顿号分隔）",
+	"medical_records":      "最近的诊疗记录",
+	"follow_up_records":    "最近的随访记录",
+	"conversation_summary": "既往对话摘要（定期由AI更新，医生可修正）",
+	"guidelines":           "检索到的相关诊疗规范摘录（带编号，可用 [n] 引用）",
+	"vital_findings":       "后台检测到的生理指标趋势异常（持续漂移、突变、测量中断）",
+	"current_time":         "当前时间",
+}
+
+var promptVariablePattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// ParsePromptTemplateContent 解析并校验模板内容，只允许使用已定义的变量
+func ParsePromptTemplateContent(content string) (PromptTemplateContent, error) {
+	var parsed PromptTemplateContent
+	if err := json.Unmarshal([]byte(content), &parsed); err != nil {
+		return parsed, fmt.Errorf("无效的JSON格式: %w", err)
+	}
+	if strings.TrimSpace(parsed.SystemPrompt) == "" {
+		return parsed, fmt.Errorf("systemPrompt不能为空")
+	}
+	if unknown := unknownPromptVariables(parsed.SystemPrompt); len(unknown) > 0 {
+		return parsed, fmt.Errorf("未知的模板变量: %s", strings.Join(unknown, ", "))
+	}
+	return parsed, nil
+}
+
+// RenderPrompt 用变量值替换模板中的 {{变量}} 占位
+func RenderPrompt(tpl string, vars map[string]string) (string, error) {
+	if unknown := unknownPromptVariables(tpl); len(unknown) > 0 {
+		return "", fmt.Errorf("未知的模板变量: %s", strings.Join(unknown, ", "))
+	}
+	return promptVariablePattern.ReplaceAllStringFunc(tpl, func(match string) string {
+		name := promptVariablePattern.FindStringSubmatch(match)[1]
+		return vars[name]
+	}), nil
+}
+
+// promptUsesVariable 判断模板是否引用了某个变量
+func promptUsesVariable(tpl string, name string) bool {
+	for _, match := range promptVariablePattern.FindAllStringSubmatch(tpl, -1) {
+		if match[1] == name {
+			return true
+		}
+	}
+	return false
+}
+
+func unknownPromptVariables(tpl string) []string {
+	seen := map[string]bool{}
+	var unknown []string
+	for _, match := range promptVariablePattern.FindAllStringSubmatch(tpl, -1) {
+		name := match[1]
+		if _, ok := PromptVariables[name]; !ok && !seen[name] {
+			seen[name] = true
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+// 慢性病关键字与模板分类的对应关系
+var diseaseCategoryKeywords = []struct {
+	Category string
+	Keywords []string
+}{
+	{models.AIAgentCategoryDiabetes, []string{"糖尿病", "血糖", "diabetes"}},
+	{models.AIAgentCategoryCardiac, []string{"高血压", "冠心病", "心脏", "心衰", "心律", "心梗", "hypertension", "cardiac"}},
+	{models.AIAgentCategoryOncology, []string{"癌", "肿瘤", "cancer"}},
+	{models.AIAgentCategoryPsychiatric, []string{"抑郁", "焦虑", "精神", "depression"}},
+}
+
+// PatientTemplateCategories 根据患者的慢性病史和年龄给出候选模板分类，按优先级排列，最后总是 general
+func PatientTemplateCategories(patient *models.Patient) []string {
+	var categories []string
+	added := map[string]bool{}
+	add := func(category string) {
+		if !added[category] {
+			added[category] = true
+			categories = append(categories, category)
+		}
+	}
+
+	for _, disease := range patient.ChronicDiseases {
+		lower := strings.ToLower(disease)
+		for _, item := range diseaseCategoryKeywords {
+			for _, keyword := range item.Keywords {
+				if strings.Contains(lower, keyword) {
+					add(item.Category)
+					break
+				}
+			}
+		}
+	}
+	if patient.Age >= 65 {
+		add(models.AIAgentCategoryGeriatric)
+	} else if patient.Age > 0 && patient.Age < 14 {
+		add(models.AIAgentCategoryPediatric)
+	}
+	add(models.AIAgentCategoryGeneral)
+	return categories
+}
+
+// SelectPromptTemplate 为患者选择已审核通过且启用的模板，
+// 依次尝试各候选分类，都没有时使用内置模板
+func SelectPromptTemplate(patient *models.Patient) *PromptTemplate {
+	templateStorage := storage.GetAITemplateStorage()
+	for _, category := range PatientTemplateCategories(patient) {
+		record, err := templateStorage.GetActiveByCategory(category)
+		if err != nil {
+			log.Printf("获取AI模板失败 (分类: %s): %v", category, err)
+			continue
+		}
+		if record == nil {
+			continue
+		}
+		content, err := ParsePromptTemplateContent(record.Content)
+		if err != nil {
+			// 审核通过的模板内容仍然有问题时跳过，避免影响回复生成
+			log.Printf("AI模板内容无效，已跳过 (ID: %s): %v", record.ID, err)
+			continue
+		}
+		return &PromptTemplate{
+			ID:       record.ID,
+			Name:     record.Name,
+			Version:  record.Version,
+			Category: category,
+			Content:  content,
+		}
+	}
+	return builtinPromptTemplate()
+}
+
+func builtinPromptTemplate() *PromptTemplate {
+	return &PromptTemplate{
+		Name:     "内置医疗助手模板",
+		Version:  builtinTemplateVersion,
+		Category: models.AIAgentCategoryGeneral,
+		Content: PromptTemplateContent{
+			SystemPrompt: config.MedicalAssistantSystemPrompt,
+		},
+	}
+}
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"we-dear/config"
+
+	deepseek "github.com/cohesion-org/deepseek-go"
+)
+
+func init() {
+	RegisterProvider("deepseek", func(cfg config.AIConfig) (ChatProvider, error) {
+		if cfg.DeepseekKey == "" {
+			return nil, fmt.Errorf("Deepseek API key未设置")
+		}
+		model := cfg.Model
+		if model == "" {
+			model = deepseek.DeepSeekChat
+		}
+		return &deepseekProvider{
+			model:  model,
+			client: deepseek.NewClient(cfg.DeepseekKey),
+		}, nil
+	})
+}
+
+// deepseekProvider 基于 deepseek-go 客户端的供应商实现
+type deepseekProvider struct {
+	model  string
+	client *deepseek.Client
+}
+
+func (p *deepseekProvider) Name() string  { return "deepseek" }
+func (p *deepseekProvider) Model() string { return p.model }
+
+func (p *deepseekProvider) CreateChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	messages := make([]deepseek.ChatCompletionMessage, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = deepseek.ChatCompletionMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+	}
+
+	request := &deepseek.ChatCompletionRequest{
+		Model:       p.model,
+		Messages:    messages,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		TopP:        req.TopP,
+	}
+	if req.JSONMode {
+		request.ResponseFormat = &deepseek.ResponseFormat{Type: "json_object"}
+	}
+
+	resp, err := p.client.CreateChatCompletion(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("deepseek API调用失败: %w", err)
+	}
+	if resp == nil || len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("deepseek返回了空响应")
+	}
+
+	return &ChatResponse{
+		Content:          resp.Choices[0].Message.Content,
+		Model:            resp.Model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}, nil
+}
+
+func (p *deepseekProvider) CreateChatCompletionStream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (*ChatResponse, error) {
+	messages := make([]deepseek.ChatCompletionMessage, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = deepseek.ChatCompletionMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+	}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, &deepseek.StreamChatCompletionRequest{
+		Model:       p.model,
+		Messages:    messages,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		TopP:        req.TopP,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("deepseek API调用失败: %w", err)
+	}
+	defer stream.Close()
+
+	result := &ChatResponse{Model: p.model}
+	var content strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("deepseek流式响应读取失败: %w", err)
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Usage != nil && chunk.Usage.TotalTokens > 0 {
+			result.PromptTokens = chunk.Usage.PromptTokens
+			result.CompletionTokens = chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			onDelta(chunk.Choices[0].Delta.Content)
+		}
+	}
+
+	if content.Len() == 0 {
+		return nil, fmt.Errorf("deepseek返回了空响应")
+	}
+	result.Content = content.String()
+	return result, nil
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"we-dear/config"
+	"we-dear/models"
+)
+
+func init() {
+	RegisterProvider("mock", func(cfg config.AIConfig) (ChatProvider, error) {
+		script := defaultMockScript
+		if cfg.MockScript != "" {
+			loaded, err := LoadMockScript(cfg.MockScript)
+			if err != nil {
+				return nil, err
+			}
+			script = loaded
+		}
+		return NewMockProvider(script), nil
+	})
+}
+
+// MockRule 一条脚本规则：用户消息包含任一关键字时返回 Reply
+type MockRule struct {
+	Match    []string `json:"match"`    // 关键字列表，任一命中即生效
+	Reply    string   `json:"reply"`    // 返回的回复内容
+	Category string   `json:"category"` // 结构化输出时的建议类别，默认 lifestyle
+	Priority int      `json:"priority"` // 结构化输出时的优先级，默认 2
+}
+
+// MockScript mock 供应商的回复脚本
+type MockScript struct {
+	Rules   []MockRule `json:"rules"`   // 按顺序匹配，第一条命中的规则生效
+	Default string     `json:"default"` // 没有规则命中时的回复
+}
+
+// 内置脚本，覆盖慢病管理中最常见的几类问题
+var defaultMockScript = MockScript{
+	Rules: []MockRule{
+		{
+			Match:    []string{"胸痛", "胸闷", "呼吸困难", "喘不上气"},
+			Reply:    "您描述的症状需要立即重视，请马上拨打120或到最近的医院急诊就诊，不要自行驾车。",
+			Category: models.AISuggestionCategoryUrgent,
+			Priority: models.AISuggestionPriorityCritical,
+		},
+		{
+			Match:    []string{"血压"},
+			Reply:    "感谢您记录血压数据。请继续每天早晚固定时间测量并记录，按时服药，低盐饮食。如果血压持续高于140/90或出现头晕头痛，请及时复诊。",
+			Category: models.AISuggestionCategoryLifestyle,
+			Priority: models.AISuggestionPriorityNormal,
+		},
+		{
+			Match:    []string{"血糖"},
+			Reply:    "感谢您记录血糖数据。请注意规律饮食和适量运动，按医嘱用药，并记录空腹和餐后血糖。如果多次空腹血糖高于7.0，请及时复诊调整方案。",
+			Category: models.AISuggestionCategoryLifestyle,
+			Priority: models.AISuggestionPriorityNormal,
+		},
+		{
+			Match:    []string{"药"},
+			Reply:    "关于用药问题，请不要自行停药或调整剂量，我会结合您的情况评估后给出具体建议。",
+			Category: models.AISuggestionCategoryMedication,
+			Priority: models.AISuggestionPriorityHigh,
+		},
+	},
+	Default: "您好，已收到您的消息，医生会尽快查看并回复。",
+}
+
+// LoadMockScript 从JSON文件加载回复脚本
+func LoadMockScript(path string) (MockScript, error) {
+	var script MockScript
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return script, fmt.Errorf("读取mock脚本失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &script); err != nil {
+		return script, fmt.Errorf("解析mock脚本失败: %w", err)
+	}
+	if script.Default == "" {
+		script.Default = defaultMockScript.Default
+	}
+	return script, nil
+}
+
+// MockProvider 不访问网络的确定性供应商，同样的输入总是得到同样的输出，
+// 用于测试、演示和没有API密钥的开发环境
+type MockProvider struct {
+	script MockScript
+}
+
+// NewMockProvider 使用指定脚本创建 mock 供应商
+func NewMockProvider(script MockScript) *MockProvider {
+	return &MockProvider{script: script}
+}
+
+func (p *MockProvider) Name() string  { return "mock" }
+func (p *MockProvider) Model() string { return "mock-chat" }
+
+func (p *MockProvider) CreateChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	system, user := splitPrompt(req.Messages)
+
+	var content string
+	if req.JSONMode {
+		content = p.replyJSON(system, user)
+	} else {
+		content = p.reply(user)
+	}
+
+	return &ChatResponse{
+		Content:          content,
+		Model:            p.Model(),
+		PromptTokens:     mockTokenCount(req.Messages),
+		CompletionTokens: len([]rune(content)),
+	}, nil
+}
+
+// CreateChatCompletionStream 将回复按固定长度切片逐段回调，模拟流式输出
+func (p *MockProvider) CreateChatCompletionStream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (*ChatResponse, error) {
+	resp, err := p.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	const chunkSize = 8
+	runes := []rune(resp.Content)
+	for start := 0; start < len(runes); start += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		end := start + chunkSize
+		if end > len(runes) {
+			end = len(runes)
+		}
+		onDelta(string(runes[start:end]))
+	}
+	return resp, nil
+}
+
+// reply 按脚本规则生成文本回复
+func (p *MockProvider) reply(user string) string {
+	return p.match(user).Reply
+}
+
+// match 返回第一条命中的规则，没有命中时返回默认回复
+func (p *MockProvider) match(user string) MockRule {
+	for _, rule := range p.script.Rules {
+		for _, keyword := range rule.Match {
+			if keyword != "" && strings.Contains(user, keyword) {
+				return rule
+			}
+		}
+	}
+	return MockRule{Reply: p.script.Default}
+}
+
+// replyJSON 生成JSON回复，能识别生理数据提取、分诊、对话摘要和结构化建议的提示并返回符合格式的结果
+func (p *MockProvider) replyJSON(system, user string) string {
+	switch {
+	case strings.Contains(system, `"readings"`):
+		return mockExtractVitals(user)
+	case strings.Contains(system, `"level"`):
+		return mockTriage(user)
+	case strings.Contains(system, `"summary"`):
+		return mockSummary(user)
+	case strings.Contains(system, `"rationale"`):
+		return p.replyStructured(system, user)
+	}
+	return "{}"
+}
+
+// replyStructured 按规则返回结构化建议，分类请求（schema 中没有 reply）只返回分类字段
+func (p *MockProvider) replyStructured(system, user string) string {
+	rule := p.match(user)
+	result := map[string]interface{}{
+		"category":   rule.Category,
+		"priority":   rule.Priority,
+		"confidence": 0.8,
+		"rationale":  "mock规则匹配",
+	}
+	if rule.Category == "" {
+		result["category"] = models.AISuggestionCategoryLifestyle
+	}
+	if rule.Priority == 0 {
+		result["priority"] = models.AISuggestionPriorityNormal
+	}
+	if strings.Contains(system, `"reply"`) {
+		result["reply"] = rule.Reply
+	}
+	data, _ := json.Marshal(result)
+	return string(data)
+}
+
+// mockTriage 用红旗症状规则模拟模型分诊
+func mockTriage(user string) string {
+	result := TriageByRules(user)
+	rationale := result.Rationale
+	if rationale == "" {
+		rationale = "mock未发现红旗症状"
+	}
+	data, _ := json.Marshal(map[string]string{
+		"level":     result.Level,
+		"rationale": rationale,
+	})
+	return string(data)
+}
+
+// mockSummary 将新增对话中患者的发言逐条截断后作为摘要
+func mockSummary(user string) string {
+	var lines []string
+	for _, line := range strings.Split(user, "\n") {
+		if index := strings.Index(line, "] 患者: "); index >= 0 {
+			lines = append(lines, "- "+truncateRunes(line[index+len("] 患者: "):], summaryMessageRunes))
+		}
+	}
+	if len(lines) == 0 {
+		lines = append(lines, "- 近期无患者发言")
+	}
+	data, _ := json.Marshal(map[string]string{"summary": strings.Join(lines, "\n")})
+	return string(data)
+}
+
+// mockVitalPatterns 内置测量类型的识别规则，捕获组依次对应 fields
+var mockVitalPatterns = []struct {
+	typ     string
+	pattern *regexp.Regexp
+	fields  []string
+}{
+	{"blood_pressure", regexp.MustCompile(`(\d{2,3})\s*[/／]\s*(\d{2,3})`), []string{"systolic", "diastolic"}},
+	{"blood_sugar", regexp.MustCompile(`血糖[^\d]{0,6}(\d{1,2}(?:\.\d+)?)`), []string{"value"}},
+	{"weight", regexp.MustCompile(`体重[^\d]{0,6}(\d{2,3}(?:\.\d+)?)\s*(公斤|kg|斤)?`), []string{"value"}},
+	{"heart_rate", regexp.MustCompile(`(?:心率|脉搏)[^\d]{0,6}(\d{2,3})`), []string{"value"}},
+	{"blood_oxygen", regexp.MustCompile(`(?:血氧|饱和度)[^\d]{0,6}(\d{2,3})`), []string{"value"}},
+	{"temperature", regexp.MustCompile(`体温[^\d]{0,6}(\d{2}(?:\.\d+)?)`), []string{"value"}},
+	{"hba1c", regexp.MustCompile(`(?:糖化血红蛋白|糖化|HbA1c)[^\d]{0,6}(\d{1,2}(?:\.\d+)?)`), []string{"value"}},
+	{"steps", regexp.MustCompile(`(\d{3,6})\s*步`), []string{"value"}},
+}
+
+// mockExtractVitals 用正则从消息中提取内置类型的全部读数，返回与提取提示一致的JSON；
+// measuredAt 留空，由调用方回退为当前时间，保证输出确定
+func mockExtractVitals(text string) string {
+	readings := []map[string]interface{}{}
+	for _, rule := range mockVitalPatterns {
+		previousEnd := 0
+		for _, match := range rule.pattern.FindAllStringSubmatchIndex(text, -1) {
+			values := map[string]float64{}
+			for i, field := range rule.fields {
+				values[field], _ = strconv.ParseFloat(text[match[2*i+2]:match[2*i+3]], 64)
+			}
+			reading := map[string]interface{}{"type": rule.typ, "values": values}
+
+			// 测量场景和单位只看本次读数所在的片段
+			segment := text[previousEnd:match[1]]
+			previousEnd = match[1]
+			switch rule.typ {
+			case "blood_sugar":
+				reading["context"] = "随机"
+				switch {
+				case strings.Contains(segment, "空腹"):
+					reading["context"] = "空腹"
+				case strings.Contains(segment, "餐后"):
+					reading["context"] = "餐后"
+				}
+			case "weight":
+				if strings.HasSuffix(segment, "斤") {
+					values["value"] /= 2
+				}
+			}
+			readings = append(readings, reading)
+		}
+	}
+
+	data, _ := json.Marshal(map[string]interface{}{"readings": readings})
+	return string(data)
+}
+
+// splitPrompt 取出第一条系统提示和最后一条用户消息；任务说明和输出格式都写在第一条系统提示中，
+// 之后的系统消息（如历史对话摘要）不参与判断
+func splitPrompt(messages []ChatMessage) (system string, user string) {
+	foundSystem := false
+	for _, msg := range messages {
+		switch msg.Role {
+		case ChatRoleSystem:
+			if !foundSystem {
+				system = msg.Content
+				foundSystem = true
+			}
+		case ChatRoleUser:
+			user = msg.Content
+		}
+	}
+	return system, user
+}
+
+// mockTokenCount 粗略按字符数估算token，便于下游统计逻辑有数据可用
+func mockTokenCount(messages []ChatMessage) int {
+	count := 0
+	for _, msg := range messages {
+		count += len([]rune(msg.Content))
+	}
+	return count
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"we-dear/config"
+)
+
+func TestMockProviderReplyRules(t *testing.T) {
+	provider := NewMockProvider(defaultMockScript)
+
+	resp, err := provider.CreateChatCompletion(context.Background(), ChatRequest{
+		Messages: []ChatMessage{
+			{Role: ChatRoleSystem, Content: "你是一位专业的医生"},
+			{Role: ChatRoleUser, Content: "今天早上血压150/95，有点头晕"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Content != defaultMockScript.Rules[1].Reply {
+		t.Errorf("expected blood pressure reply, got %q", resp.Content)
+	}
+
+	again, _ := provider.CreateChatCompletion(context.Background(), ChatRequest{
+		Messages: []ChatMessage{{Role: ChatRoleUser, Content: "今天早上血压150/95，有点头晕"}},
+	})
+	if again.Content != resp.Content {
+		t.Errorf("mock provider is not deterministic: %q vs %q", again.Content, resp.Content)
+	}
+}
+
+func TestMockProviderExtractVitals(t *testing.T) {
+	provider := NewMockProvider(defaultMockScript)
+	types := config.DefaultVitalSignTypes
+	now := time.Date(2024, 12, 18, 9, 0, 0, 0, time.Local)
+
+	resp, err := provider.CreateChatCompletion(context.Background(), ChatRequest{
+		JSONMode: true,
+		Messages: []ChatMessage{
+			{Role: ChatRoleSystem, Content: vitalExtractionPrompt(types, now)},
+			{Role: ChatRoleUser, Content: "昨天血压138/88，今天150/95，空腹血糖7.2，体重130斤，心率76"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	readings, rejected, err := parseVitalReadings(resp.Content, types, now)
+	if err != nil {
+		t.Fatalf("mock returned invalid JSON %q: %v", resp.Content, err)
+	}
+	if len(rejected) > 0 {
+		t.Errorf("unexpected rejected readings: %v", rejected)
+	}
+
+	var values []string
+	for _, reading := range readings {
+		definition, _ := findVitalSignType(types, reading.Type)
+		values = append(values, reading.Type+"="+FormatVitalValue(definition, reading))
+	}
+	expected := []string{"blood_pressure=138/88", "blood_pressure=150/95", "blood_sugar=7.2-空腹", "weight=65.0", "heart_rate=76"}
+	if strings.Join(values, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected readings %v, got %v", expected, values)
+	}
+}
+
+func TestMockProviderStructuredSuggestion(t *testing.T) {
+	provider := NewMockProvider(defaultMockScript)
+
+	req := withStructuredOutput(ChatRequest{
+		Messages: []ChatMessage{
+			{Role: ChatRoleSystem, Content: "你是一位专业的医生"},
+			{Role: ChatRoleUser, Content: "突然胸痛，喘不上气"},
+		},
+	})
+	resp, err := provider.CreateChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	structured, err := parseStructuredSuggestion(resp.Content, true)
+	if err != nil {
+		t.Fatalf("structured reply failed validation: %v (%s)", err, resp.Content)
+	}
+	if structured.Category != "urgent" || structured.Priority != 5 || structured.Reply == "" {
+		t.Errorf("unexpected structured suggestion: %+v", structured)
+	}
+}
+
+func TestMockProviderStructuredSuggestionWithHistorySummary(t *testing.T) {
+	provider := NewMockProvider(defaultMockScript)
+
+	// 历史摘要作为第二条系统消息，结构化输出说明仍在第一条
+	req := withStructuredOutput(ChatRequest{
+		Messages: []ChatMessage{
+			{Role: ChatRoleSystem, Content: "你是一位专业的医生"},
+			{Role: ChatRoleSystem, Content: "历史对话摘要：患者近期血压控制良好"},
+			{Role: ChatRoleUser, Content: "突然胸痛，喘不上气"},
+		},
+	})
+	resp, err := provider.CreateChatCompletion(context.Background(), req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := parseStructuredSuggestion(resp.Content, true); err != nil {
+		t.Fatalf("structured reply failed validation: %v (%s)", err, resp.Content)
+	}
+}
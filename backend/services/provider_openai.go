@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"we-dear/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func init() {
+	RegisterProvider("openai", func(cfg config.AIConfig) (ChatProvider, error) {
+		if cfg.OpenAIKey == "" {
+			return nil, fmt.Errorf("OpenAI API key未设置")
+		}
+		return newOpenAIProvider("openai", openai.DefaultConfig(cfg.OpenAIKey), cfg.Model), nil
+	})
+	// 任意兼容 OpenAI 接口的服务（本地 vLLM、Ollama、各类代理等）
+	RegisterProvider("openai_compatible", func(cfg config.AIConfig) (ChatProvider, error) {
+		if cfg.BaseURL == "" {
+			return nil, fmt.Errorf("OpenAI兼容接口地址未设置")
+		}
+		clientConfig := openai.DefaultConfig(cfg.APIKey)
+		clientConfig.BaseURL = cfg.BaseURL
+		return newOpenAIProvider("openai_compatible", clientConfig, cfg.Model), nil
+	})
+}
+
+// openAIProvider 基于 go-openai 客户端的供应商实现
+type openAIProvider struct {
+	name   string
+	model  string
+	client *openai.Client
+}
+
+func newOpenAIProvider(name string, clientConfig openai.ClientConfig, model string) *openAIProvider {
+	return &openAIProvider{
+		name:   name,
+		model:  model,
+		client: openai.NewClientWithConfig(clientConfig),
+	}
+}
+
+func (p *openAIProvider) Name() string  { return p.name }
+func (p *openAIProvider) Model() string { return p.model }
+
+func (p *openAIProvider) CreateChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	resp, err := p.client.CreateChatCompletion(ctx, p.buildRequest(req))
+	if err != nil {
+		return nil, fmt.Errorf("%s API调用失败: %w", p.name, err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("%s返回了空响应", p.name)
+	}
+
+	return &ChatResponse{
+		Content:          resp.Choices[0].Message.Content,
+		Model:            resp.Model,
+		PromptTokens:     resp.Usage.PromptTokens,
+		CompletionTokens: resp.Usage.CompletionTokens,
+	}, nil
+}
+
+func (p *openAIProvider) CreateChatCompletionStream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (*ChatResponse, error) {
+	request := p.buildRequest(req)
+	request.Stream = true
+	request.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	stream, err := p.client.CreateChatCompletionStream(ctx, request)
+	if err != nil {
+		return nil, fmt.Errorf("%s API调用失败: %w", p.name, err)
+	}
+	defer stream.Close()
+
+	result := &ChatResponse{Model: p.model}
+	var content strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s流式响应读取失败: %w", p.name, err)
+		}
+		if chunk.Model != "" {
+			result.Model = chunk.Model
+		}
+		if chunk.Usage != nil {
+			result.PromptTokens = chunk.Usage.PromptTokens
+			result.CompletionTokens = chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) > 0 && chunk.Choices[0].Delta.Content != "" {
+			content.WriteString(chunk.Choices[0].Delta.Content)
+			onDelta(chunk.Choices[0].Delta.Content)
+		}
+	}
+
+	if content.Len() == 0 {
+		return nil, fmt.Errorf("%s返回了空响应", p.name)
+	}
+	result.Content = content.String()
+	return result, nil
+}
+
+// buildRequest 将通用请求转换为 go-openai 请求
+func (p *openAIProvider) buildRequest(req ChatRequest) openai.ChatCompletionRequest {
+	messages := make([]openai.ChatCompletionMessage, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = openai.ChatCompletionMessage{
+			Role:    msg.Role,
+			Content: msg.Content,
+		}
+	}
+
+	request := openai.ChatCompletionRequest{
+		Model:       p.model,
+		Messages:    messages,
+		Temperature: req.Temperature,
+		MaxTokens:   req.MaxTokens,
+		TopP:        req.TopP,
+	}
+	if req.JSONMode {
+		request.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		}
+	}
+	return request
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"we-dear/config"
+	"we-dear/models"
+)
+
+// 患者档案中需要脱敏的字段及对应的占位符
+const (
+	PlaceholderPatientName    = "[患者姓名]"
+	PlaceholderIDCard         = "[身份证号]"
+	PlaceholderPhone          = "[联系电话]"
+	PlaceholderEmergencyPhone = "[紧急联系电话]"
+	PlaceholderAddress        = "[家庭住址]"
+)
+
+var (
+	// 档案之外出现在消息中的身份证号和手机号也一并脱敏
+	redactIDCardPattern = regexp.MustCompile(`\b\d{17}[\dXx]\b`)
+	redactPhonePattern  = regexp.MustCompile(`\b1[3-9]\d{9}\b`)
+)
+
+// redaction 一个被替换的原始值
+type redaction struct {
+	Placeholder string
+	Value       string
+}
+
+// Redactor 对发往外部模型的文本做假名化处理，并在回复中还原。
+// 每次请求使用一个新的 Redactor，占位符与原始值的对应关系只保存在内存中
+type Redactor struct {
+	redactions []redaction
+	counters   map[string]int
+}
+
+// NewPatientRedactor 根据患者档案创建 Redactor，patient 为 nil 时只处理通用的证件号和手机号
+func NewPatientRedactor(patient *models.Patient) *Redactor {
+	r := &Redactor{counters: map[string]int{}}
+	if patient == nil {
+		return r
+	}
+	r.add(PlaceholderPatientName, patient.Name)
+	r.add(PlaceholderIDCard, patient.IDCard)
+	r.add(PlaceholderPhone, patient.Phone)
+	r.add(PlaceholderEmergencyPhone, patient.EmergencyPhone)
+	r.add(PlaceholderAddress, patient.Address)
+	return r
+}
+
+func (r *Redactor) add(placeholder string, value string) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return
+	}
+	for _, item := range r.redactions {
+		if item.Value == value {
+			return
+		}
+	}
+	r.redactions = append(r.redactions, redaction{Placeholder: placeholder, Value: value})
+	// 先替换较长的值，避免姓名等短值破坏地址等长值
+	sort.SliceStable(r.redactions, func(i, j int) bool {
+		return len(r.redactions[i].Value) > len(r.redactions[j].Value)
+	})
+}
+
+// addPattern 为文本中匹配到的未知值分配编号占位符
+func (r *Redactor) addPattern(text string, pattern *regexp.Regexp, label string) {
+	for _, value := range pattern.FindAllString(text, -1) {
+		known := false
+		for _, item := range r.redactions {
+			if item.Value == value {
+				known = true
+				break
+			}
+		}
+		if known {
+			continue
+		}
+		r.counters[label]++
+		r.add(fmt.Sprintf("[%s%d]", label, r.counters[label]), value)
+	}
+}
+
+// Redact 将文本中的隐私信息替换为占位符
+func (r *Redactor) Redact(text string) string {
+	r.addPattern(text, redactIDCardPattern, "证件号")
+	r.addPattern(text, redactPhonePattern, "电话")
+	for _, item := range r.redactions {
+		text = strings.ReplaceAll(text, item.Value, item.Placeholder)
+	}
+	return text
+}
+
+// RedactRequest 返回脱敏后的请求副本
+func (r *Redactor) RedactRequest(req ChatRequest) ChatRequest {
+	messages := make([]ChatMessage, len(req.Messages))
+	for i, msg := range req.Messages {
+		messages[i] = ChatMessage{Role: msg.Role, Content: r.Redact(msg.Content)}
+	}
+	req.Messages = messages
+	return req
+}
+
+// Restore 将回复中的占位符还原为原始值
+func (r *Redactor) Restore(text string) string {
+	for _, item := range r.redactions {
+		text = strings.ReplaceAll(text, item.Placeholder, item.Value)
+	}
+	return text
+}
+
+// RestoreJSON 还原JSON回复中的占位符，原始值按JSON字符串转义，避免破坏格式
+func (r *Redactor) RestoreJSON(text string) string {
+	for _, item := range r.redactions {
+		escaped, _ := json.Marshal(item.Value)
+		text = strings.ReplaceAll(text, item.Placeholder, strings.Trim(string(escaped), `"`))
+	}
+	return text
+}
+
+// restoreStream 包装流式回调：占位符可能被拆到两段内容中，
+// 未闭合的 "[" 之后的内容先缓存，等下一段到达后再还原输出
+func (r *Redactor) restoreStream(onDelta func(delta string)) (wrapped func(delta string), flush func()) {
+	var pending string
+	wrapped = func(delta string) {
+		pending += delta
+		cut := len(pending)
+		if open := strings.LastIndex(pending, "["); open >= 0 && !strings.Contains(pending[open:], "]") {
+			// 超过最长占位符长度的方括号不可能是占位符，不再等待
+			if len(pending)-open <= r.maxPlaceholderLen() {
+				cut = open
+			}
+		}
+		if cut > 0 {
+			onDelta(r.Restore(pending[:cut]))
+			pending = pending[cut:]
+		}
+	}
+	flush = func() {
+		if pending != "" {
+			onDelta(r.Restore(pending))
+			pending = ""
+		}
+	}
+	return wrapped, flush
+}
+
+func (r *Redactor) maxPlaceholderLen() int {
+	max := 0
+	for _, item := range r.redactions {
+		if len(item.Placeholder) > max {
+			max = len(item.Placeholder)
+		}
+	}
+	return max
+}
+
+// shouldRedact 判断发往该供应商的请求是否需要脱敏：默认都脱敏，
+// 只有 AI_REDACT_EXEMPT_PROVIDERS 中列出的供应商发送原文
+func shouldRedact(provider ChatProvider) bool {
+	for _, name := range config.GlobalConfig.AI.RedactExemptProviders {
+		if name == provider.Name() {
+			return false
+		}
+	}
+	return true
+}
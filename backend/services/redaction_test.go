@@ -0,0 +1,55 @@
+package services
+
+import (
+	"strings"
+	"testing"
+
+	"we-dear/config"
+	"we-dear/models"
+)
+
+func TestRedactorRoundTrip(t *testing.T) {
+	patient := &models.Patient{
+		Name:    "张三",
+		IDCard:  "110101195001011234",
+		Phone:   "13800138000",
+		Address: "北京市东城区某街道1号",
+	}
+	redactor := NewPatientRedactor(patient)
+
+	text := "患者张三，身份证110101195001011234，电话13800138000，住北京市东城区某街道1号。家属电话13900139000"
+	redacted := redactor.Redact(text)
+	for _, value := range []string{"张三", "110101195001011234", "13800138000", "北京市东城区", "13900139000"} {
+		if strings.Contains(redacted, value) {
+			t.Errorf("redacted text still contains %q: %s", value, redacted)
+		}
+	}
+	if restored := redactor.Restore(redacted); restored != text {
+		t.Errorf("restore mismatch:\n got %s\nwant %s", restored, text)
+	}
+
+	var streamed strings.Builder
+	onDelta, flush := redactor.restoreStream(func(delta string) { streamed.WriteString(delta) })
+	for _, chunk := range []string{"[患者", "姓名]您好，请联系[电", "话1]"} {
+		onDelta(chunk)
+	}
+	flush()
+	if streamed.String() != "张三您好，请联系13900139000" {
+		t.Errorf("unexpected streamed restore: %s", streamed.String())
+	}
+}
+
+func TestShouldRedactByDefault(t *testing.T) {
+	saved := config.GlobalConfig
+	defer func() { config.GlobalConfig = saved }()
+	config.GlobalConfig.AI.RedactExemptProviders = []string{"mock"}
+
+	for _, provider := range []ChatProvider{&flakyProvider{name: "openai_compatible"}, &deepseekProvider{}} {
+		if !shouldRedact(provider) {
+			t.Errorf("provider %s should be redacted by default", provider.Name())
+		}
+	}
+	if shouldRedact(NewMockProvider(MockScript{})) {
+		t.Error("exempt provider should not be redacted")
+	}
+}
@@ -0,0 +1,365 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"we-dear/config"
+
+	deepseek "github.com/cohesion-org/deepseek-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// 熔断器状态
+const (
+	BreakerClosed   = "closed"    // 正常
+	BreakerOpen     = "open"      // 熔断中，请求直接跳过该供应商
+	BreakerHalfOpen = "half_open" // 冷却结束，放行一次试探请求
+)
+
+// ErrCircuitOpen 供应商处于熔断状态
+var ErrCircuitOpen = errors.New("供应商已熔断")
+
+// ErrStreamIdle 流式输出在单次请求超时时间内没有收到新内容
+var ErrStreamIdle = errors.New("流式输出超时未收到新内容")
+
+// CircuitBreaker 供应商熔断器：连续失败达到阈值后熔断，冷却后放行一次试探请求，
+// 试探成功恢复，失败则重新熔断
+type CircuitBreaker struct {
+	mu            sync.Mutex
+	threshold     int
+	cooldown      time.Duration
+	state         string
+	failures      int
+	probing       bool
+	openedAt      time.Time
+	lastError     string
+	lastFailureAt time.Time
+	now           func() time.Time
+}
+
+// BreakerStatus 熔断器状态快照
+type BreakerStatus struct {
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	OpenedAt            *time.Time `json:"openedAt,omitempty"`
+	RetryAt             *time.Time `json:"retryAt,omitempty"` // 熔断中时，下一次放行试探请求的时间
+	LastError           string     `json:"lastError,omitempty"`
+	LastFailureAt       *time.Time `json:"lastFailureAt,omitempty"`
+}
+
+// NewCircuitBreaker 创建熔断器，threshold <= 0 时不熔断
+func NewCircuitBreaker(threshold int, cooldown time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		state:     BreakerClosed,
+		now:       time.Now,
+	}
+}
+
+// Allow 判断是否可以向该供应商发送请求
+func (b *CircuitBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		// 同一时间只放行一个试探请求
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Success 记录一次成功，恢复正常状态
+func (b *CircuitBreaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = BreakerClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure 记录一次失败
+func (b *CircuitBreaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	b.probing = false
+	b.lastFailureAt = b.now()
+	if err != nil {
+		b.lastError = err.Error()
+	}
+	if b.threshold <= 0 {
+		return
+	}
+	if b.state == BreakerHalfOpen || b.failures >= b.threshold {
+		b.state = BreakerOpen
+		b.openedAt = b.now()
+	}
+}
+
+// Release 请求被调用方取消，不计入成功或失败，只释放试探名额
+func (b *CircuitBreaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+// Status 返回当前状态
+func (b *CircuitBreaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	status := BreakerStatus{
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+	}
+	if b.state != BreakerClosed {
+		openedAt := b.openedAt
+		retryAt := b.openedAt.Add(b.cooldown)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+	if !b.lastFailureAt.IsZero() {
+		lastFailureAt := b.lastFailureAt
+		status.LastFailureAt = &lastFailureAt
+	}
+	return status
+}
+
+// RetryPolicy 单个供应商的重试策略
+type RetryPolicy struct {
+	MaxRetries int           // 最大重试次数（不含首次）
+	BaseDelay  time.Duration // 第一次重试前的等待时间，之后每次翻倍
+	MaxDelay   time.Duration // 等待时间上限
+}
+
+// Backoff 第 retry 次重试前的等待时间：指数增长，在上限的一半到上限之间随机抖动，
+// 避免多个 worker 同时重试
+func (p RetryPolicy) Backoff(retry int) time.Duration {
+	delay := p.BaseDelay
+	for i := 1; i < retry && delay < p.MaxDelay; i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// errorStatusCode 从供应商错误中取出HTTP状态码，网络错误等没有状态码时返回 0
+func errorStatusCode(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var requestErr *openai.RequestError
+	if errors.As(err, &requestErr) {
+		return requestErr.HTTPStatusCode
+	}
+	var deepseekErr deepseek.APIError
+	if errors.As(err, &deepseekErr) {
+		return deepseekErr.StatusCode
+	}
+	return 0
+}
+
+// isRetryable 网络错误、超时、限流和服务端错误可以重试，请求本身有问题（4xx）的不重试
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	status := errorStatusCode(err)
+	return status == 0 ||
+		status == http.StatusRequestTimeout ||
+		status == http.StatusTooManyRequests ||
+		status >= http.StatusInternalServerError
+}
+
+// isProviderFault 判断失败是否说明供应商不可用（计入熔断）：
+// 可重试的错误，以及密钥无效、余额不足等认证和计费错误
+func isProviderFault(err error) bool {
+	if isRetryable(err) {
+		return true
+	}
+	switch errorStatusCode(err) {
+	case http.StatusUnauthorized, http.StatusPaymentRequired, http.StatusForbidden:
+		return true
+	}
+	return false
+}
+
+// providerHandle 故障转移链中的一个供应商及其熔断器
+type providerHandle struct {
+	provider ChatProvider
+	breaker  *CircuitBreaker
+}
+
+// newProviderHandle 按配置为供应商创建熔断器
+func newProviderHandle(provider ChatProvider, cfg config.AIConfig) *providerHandle {
+	return &providerHandle{
+		provider: provider,
+		breaker:  NewCircuitBreaker(cfg.BreakerFailures, time.Duration(cfg.BreakerCooldown)*time.Second),
+	}
+}
+
+// newFallbackProviders 创建 AI_FALLBACK_PROVIDERS 中配置的备用供应商，创建失败的跳过
+func newFallbackProviders(cfg config.AIConfig) []ChatProvider {
+	var providers []ChatProvider
+	for _, item := range cfg.FallbackProviders {
+		fallback := cfg
+		// 模型名称本身可能包含冒号（如 qwen2.5:7b），只按第一个冒号切分
+		parts := strings.SplitN(item, ":", 2)
+		fallback.Provider = strings.TrimSpace(parts[0])
+		if len(parts) == 2 {
+			fallback.Model = strings.TrimSpace(parts[1])
+		}
+		provider, err := NewChatProvider(fallback)
+		if err != nil {
+			log.Printf("初始化备用AI提供商 %s 失败: %v", item, err)
+			continue
+		}
+		providers = append(providers, provider)
+	}
+	return providers
+}
+
+// retryPolicy 按配置创建重试策略
+func retryPolicy(cfg config.AIConfig) RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: cfg.MaxRetries,
+		BaseDelay:  time.Duration(cfg.RetryBaseDelayMs) * time.Millisecond,
+		MaxDelay:   time.Duration(cfg.RetryMaxDelayMs) * time.Millisecond,
+	}
+}
+
+// attemptFunc 向一个供应商发送一次请求，attempt 从 1 开始
+type attemptFunc func(ctx context.Context, provider ChatProvider, attempt int) (*ChatResponse, error)
+
+// withIdleTimeout 返回超过 timeout 没有调用 touch 就取消的 context，取消原因为 ErrStreamIdle；
+// 用于流式输出，只要持续收到内容就不会超时，总时长由 parent 限制
+func withIdleTimeout(parent context.Context, timeout time.Duration) (ctx context.Context, touch func(), stop func()) {
+	ctx, cancel := context.WithCancelCause(parent)
+	timer := time.AfterFunc(timeout, func() { cancel(ErrStreamIdle) })
+	touch = func() { timer.Reset(timeout) }
+	stop = func() {
+		timer.Stop()
+		cancel(context.Canceled)
+	}
+	return ctx, touch, stop
+}
+
+// withFailover 按顺序尝试故障转移链中的供应商：跳过熔断中的供应商，
+// 可重试的错误按退避策略重试，重试用完或不可重试时切换到下一个供应商。
+// started 不为 nil 时为流式调用：单次请求不设总超时，由 attempt 按内容间隔判断超时（见 withIdleTimeout）；
+// started 返回 true 时说明已经向调用方输出了内容，此时不再重试或切换
+func (s *AIService) withFailover(ctx context.Context, attempt attemptFunc, started func() bool) (*ChatResponse, error) {
+	var lastErr error
+	for _, handle := range s.providers {
+		name := handle.provider.Name()
+		if !handle.breaker.Allow() {
+			lastErr = fmt.Errorf("%s: %w", name, ErrCircuitOpen)
+			continue
+		}
+
+		for n := 1; ; n++ {
+			attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+			if started == nil {
+				attemptCtx, cancel = context.WithTimeout(ctx, s.attemptTimeout)
+			}
+			resp, err := attempt(attemptCtx, handle.provider, n)
+			cancel()
+			if err == nil {
+				handle.breaker.Success()
+				return resp, nil
+			}
+			lastErr = err
+
+			// 调用方取消或总超时，不再尝试
+			if ctx.Err() != nil {
+				handle.breaker.Release()
+				return nil, err
+			}
+			if started != nil && started() {
+				// 已经输出内容后才超时，说明供应商能正常响应，只是输出慢，不计入熔断
+				if errors.Is(err, ErrStreamIdle) {
+					handle.breaker.Release()
+				} else {
+					s.recordOutcome(handle, err)
+				}
+				return nil, err
+			}
+			if !isRetryable(err) || n > s.retry.MaxRetries {
+				s.recordOutcome(handle, err)
+				break
+			}
+
+			delay := s.retry.Backoff(n)
+			log.Printf("%s 调用失败，%v 后进行第%d次重试: %v", name, delay, n, err)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				handle.breaker.Release()
+				return nil, err
+			}
+		}
+		log.Printf("%s 调用失败，尝试下一个供应商: %v", name, lastErr)
+	}
+	if lastErr == nil {
+		lastErr = errors.New("未配置AI供应商")
+	}
+	return nil, fmt.Errorf("所有AI供应商均调用失败: %w", lastErr)
+}
+
+// recordOutcome 供应商不可用的错误计入熔断，请求本身的错误说明供应商可以正常响应
+func (s *AIService) recordOutcome(handle *providerHandle, err error) {
+	if isProviderFault(err) {
+		handle.breaker.Failure(err)
+	} else {
+		handle.breaker.Success()
+	}
+}
+
+// ProviderStatus 故障转移链中一个供应商的状态
+type ProviderStatus struct {
+	Name    string        `json:"name"`
+	Model   string        `json:"model"`
+	Primary bool          `json:"primary"` // 是否为主供应商
+	Breaker BreakerStatus `json:"breaker"`
+}
+
+// ProviderStatuses 按故障转移顺序返回各供应商的熔断状态
+func (s *AIService) ProviderStatuses() []ProviderStatus {
+	statuses := make([]ProviderStatus, 0, len(s.providers))
+	for i, handle := range s.providers {
+		statuses = append(statuses, ProviderStatus{
+			Name:    handle.provider.Name(),
+			Model:   handle.provider.Model(),
+			Primary: i == 0,
+			Breaker: handle.breaker.Status(),
+		})
+	}
+	return statuses
+}
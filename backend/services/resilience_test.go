@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	now := time.Now()
+	breaker := NewCircuitBreaker(2, time.Minute)
+	breaker.now = func() time.Time { return now }
+
+	breaker.Failure(errors.New("timeout"))
+	if !breaker.Allow() {
+		t.Fatal("breaker should stay closed below the threshold")
+	}
+	breaker.Failure(errors.New("timeout"))
+	if breaker.Allow() {
+		t.Fatal("breaker should open after consecutive failures")
+	}
+
+	now = now.Add(time.Minute)
+	if !breaker.Allow() {
+		t.Fatal("breaker should let one probe through after the cooldown")
+	}
+	if breaker.Allow() {
+		t.Fatal("only one probe should be allowed while half-open")
+	}
+	breaker.Failure(errors.New("still down"))
+	if status := breaker.Status(); status.State != BreakerOpen {
+		t.Fatalf("failed probe should reopen the breaker, got %s", status.State)
+	}
+
+	now = now.Add(time.Minute)
+	breaker.Allow()
+	breaker.Success()
+	if status := breaker.Status(); status.State != BreakerClosed || status.ConsecutiveFailures != 0 {
+		t.Fatalf("successful probe should close the breaker, got %+v", status)
+	}
+}
+
+// flakyProvider 前 failures 次调用返回 err
+type flakyProvider struct {
+	name     string
+	failures int
+	err      error
+	calls    int
+}
+
+func (p *flakyProvider) Name() string  { return p.name }
+func (p *flakyProvider) Model() string { return p.name + "-model" }
+
+func (p *flakyProvider) CreateChatCompletion(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	p.calls++
+	if p.calls <= p.failures {
+		return nil, p.err
+	}
+	return &ChatResponse{Content: "ok from " + p.name, Model: p.Model()}, nil
+}
+
+func TestWithFailoverRetriesThenFallsBack(t *testing.T) {
+	primary := &flakyProvider{name: "primary", failures: 100, err: &openai.APIError{HTTPStatusCode: 503}}
+	fallback := &flakyProvider{name: "fallback", failures: 1, err: errors.New("connection reset")}
+	s := NewAIServiceWithProvider(primary, fallback)
+	s.retry = RetryPolicy{MaxRetries: 2}
+
+	call := func(ctx context.Context, provider ChatProvider, attempt int) (*ChatResponse, error) {
+		return provider.CreateChatCompletion(ctx, ChatRequest{})
+	}
+	resp, err := s.withFailover(context.Background(), call, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if resp.Content != "ok from fallback" {
+		t.Errorf("expected fallback reply, got %q", resp.Content)
+	}
+	if primary.calls != 3 || fallback.calls != 2 {
+		t.Errorf("expected 3 primary and 2 fallback calls, got %d and %d", primary.calls, fallback.calls)
+	}
+
+	// 请求本身的错误不重试，也不计入熔断
+	bad := &flakyProvider{name: "bad", failures: 100, err: &openai.APIError{HTTPStatusCode: 400}}
+	s = NewAIServiceWithProvider(bad)
+	s.retry = RetryPolicy{MaxRetries: 2}
+	if _, err := s.withFailover(context.Background(), call, nil); err == nil {
+		t.Fatal("expected an error")
+	}
+	if bad.calls != 1 {
+		t.Errorf("non-retryable error should not be retried, got %d calls", bad.calls)
+	}
+	if status := s.ProviderStatuses()[0].Breaker; status.ConsecutiveFailures != 0 {
+		t.Errorf("bad request should not count as provider failure, got %+v", status)
+	}
+}
+
+// slowStreamProvider 每隔 interval 输出一段内容，stallAfter > 0 时输出该段数后不再输出
+type slowStreamProvider struct {
+	flakyProvider
+	chunks     []string
+	interval   time.Duration
+	stallAfter int
+}
+
+func (p *slowStreamProvider) CreateChatCompletionStream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (*ChatResponse, error) {
+	content := ""
+	for i, chunk := range p.chunks {
+		if p.stallAfter > 0 && i == p.stallAfter {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		select {
+		case <-time.After(p.interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		onDelta(chunk)
+		content += chunk
+	}
+	return &ChatResponse{Content: content, Model: p.Model()}, nil
+}
+
+func TestWithFailoverSlowStream(t *testing.T) {
+	chunks := []string{"血压", "偏高", "，", "请", "按时", "服药"}
+	provider := &slowStreamProvider{flakyProvider: flakyProvider{name: "slow"}, chunks: chunks, interval: 30 * time.Millisecond}
+	s := NewAIServiceWithProvider(provider)
+	// 总耗时约 180ms，超过单次请求超时，但每段内容的间隔都在超时以内
+	s.attemptTimeout = 80 * time.Millisecond
+
+	started := false
+	stream := func(ctx context.Context, p ChatProvider, attempt int) (*ChatResponse, error) {
+		return streamWithIdleTimeout(ctx, p, ChatRequest{}, s.attemptTimeout, func(string) { started = true })
+	}
+	resp, err := s.withFailover(context.Background(), stream, func() bool { return started })
+	if err != nil {
+		t.Fatalf("slow but progressing stream should not time out: %v", err)
+	}
+	if resp.Content != "血压偏高，请按时服药" {
+		t.Errorf("unexpected content %q", resp.Content)
+	}
+
+	// 输出一部分后停止输出，按内容间隔超时，但不计入熔断
+	provider.stallAfter = 2
+	started = false
+	_, err = s.withFailover(context.Background(), stream, func() bool { return started })
+	if !errors.Is(err, ErrStreamIdle) {
+		t.Fatalf("expected idle timeout, got %v", err)
+	}
+	if status := s.ProviderStatuses()[0].Breaker; status.ConsecutiveFailures != 0 {
+		t.Errorf("idle timeout after output started should not count as provider failure, got %+v", status)
+	}
+}
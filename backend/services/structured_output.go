@@ -0,0 +1,151 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/utils"
+)
+
+// StructuredSuggestion 模型按 JSON Schema 返回的结构化建议
+type StructuredSuggestion struct {
+	Reply      string  `json:"reply"`
+	Category   string  `json:"category"`
+	Priority   int     `json:"priority"`
+	Confidence float64 `json:"confidence"`
+	Rationale  string  `json:"rationale"`
+}
+
+// suggestionSchema 返回结构化建议的 JSON Schema，includeReply 为 false 时只包含分类字段
+func suggestionSchema(includeReply bool) string {
+	properties := map[string]interface{}{
+		"category": map[string]interface{}{
+			"type": "string",
+			"enum": []string{
+				models.AISuggestionCategoryMedication,
+				models.AISuggestionCategoryVisit,
+				models.AISuggestionCategoryLifestyle,
+				models.AISuggestionCategoryUrgent,
+			},
+		},
+		"priority": map[string]interface{}{
+			"type":    "integer",
+			"minimum": models.AISuggestionPriorityLow,
+			"maximum": models.AISuggestionPriorityCritical,
+		},
+		"confidence": map[string]interface{}{
+			"type":    "number",
+			"minimum": 0,
+			"maximum": 1,
+		},
+		"rationale": map[string]interface{}{
+			"type": "string",
+		},
+	}
+	required := []string{"category", "priority", "rationale"}
+	if includeReply {
+		properties["reply"] = map[string]interface{}{
+			"type":      "string",
+			"minLength": 1,
+		}
+		required = append([]string{"reply"}, required...)
+	}
+
+	schema, _ := json.MarshalIndent(map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}, "", "  ")
+	return string(schema)
+}
+
+// withStructuredOutput 在系统提示后追加结构化输出要求，并要求模型输出JSON
+func withStructuredOutput(req ChatRequest) ChatRequest {
+	messages := make([]ChatMessage, len(req.Messages))
+	copy(messages, req.Messages)
+	if len(messages) > 0 && messages[0].Role == ChatRoleSystem {
+		messages[0].Content += fmt.Sprintf(config.StructuredReplyInstruction, suggestionSchema(true))
+	}
+	req.Messages = messages
+	req.JSONMode = true
+	return req
+}
+
+// parseStructuredSuggestion 校验并解析模型返回的结构化建议
+func parseStructuredSuggestion(content string, includeReply bool) (*StructuredSuggestion, error) {
+	content = stripJSONFence(content)
+	if _, err := utils.ValidateJSONSchema(suggestionSchema(includeReply), content); err != nil {
+		return nil, err
+	}
+
+	var result StructuredSuggestion
+	if err := json.Unmarshal([]byte(content), &result); err != nil {
+		return nil, fmt.Errorf("解析结构化建议失败: %w", err)
+	}
+	if result.Confidence == 0 {
+		result.Confidence = 0.5
+	}
+	return &result, nil
+}
+
+// stripJSONFence 去掉部分模型会包裹在JSON外面的 ```json 代码块标记
+func stripJSONFence(content string) string {
+	content = strings.TrimSpace(content)
+	if strings.HasPrefix(content, "```") {
+		content = strings.TrimPrefix(content, "```json")
+		content = strings.TrimPrefix(content, "```")
+		content = strings.TrimSuffix(content, "```")
+	}
+	return strings.TrimSpace(content)
+}
+
+// partialStructuredSuggestion 结构化建议未通过校验时的兜底：JSON 中的 reply 可以取出时只用 reply 作为回复，
+// 其他字段合法的保留，不合法的使用 unstructuredSuggestion 的默认值；不是JSON或没有 reply 时原文作为回复
+func partialStructuredSuggestion(content string) *StructuredSuggestion {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal([]byte(stripJSONFence(content)), &fields) != nil {
+		return unstructuredSuggestion(content)
+	}
+	var reply string
+	if json.Unmarshal(fields["reply"], &reply) != nil || strings.TrimSpace(reply) == "" {
+		return unstructuredSuggestion(content)
+	}
+
+	result := unstructuredSuggestion(reply)
+	var category string
+	if json.Unmarshal(fields["category"], &category) == nil {
+		switch category {
+		case models.AISuggestionCategoryMedication, models.AISuggestionCategoryVisit,
+			models.AISuggestionCategoryLifestyle, models.AISuggestionCategoryUrgent:
+			result.Category = category
+		}
+	}
+	var priority int
+	if json.Unmarshal(fields["priority"], &priority) == nil &&
+		priority >= models.AISuggestionPriorityLow && priority <= models.AISuggestionPriorityCritical {
+		result.Priority = priority
+	}
+	var confidence float64
+	if json.Unmarshal(fields["confidence"], &confidence) == nil && confidence >= 0 && confidence <= 1 {
+		result.Confidence = confidence
+	}
+	var rationale string
+	if json.Unmarshal(fields["rationale"], &rationale) == nil && strings.TrimSpace(rationale) != "" {
+		result.Rationale = rationale
+	}
+	return result
+}
+
+// unstructuredSuggestion 模型没有按要求输出时的兜底：原文作为回复，
+// 优先级取“高”让医生尽快查看，置信度为0表示未经模型判断
+func unstructuredSuggestion(content string) *StructuredSuggestion {
+	return &StructuredSuggestion{
+		Reply:     content,
+		Category:  models.AISuggestionCategoryMedication,
+		Priority:  models.AISuggestionPriorityHigh,
+		Rationale: "模型未返回结构化结果",
+	}
+}
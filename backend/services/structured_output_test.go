@@ -0,0 +1,28 @@
+package services
+
+import (
+	"testing"
+
+	"we-dear/models"
+)
+
+func TestPartialStructuredSuggestion(t *testing.T) {
+	// priority 超出范围，未通过校验，但 reply 和其他字段可以取出
+	content := "```json\n{\"reply\": \"请按时服药，一周后复查血压。\", \"category\": \"visit\", \"priority\": 9, \"confidence\": 0.8}\n```"
+	if _, err := parseStructuredSuggestion(content, true); err == nil {
+		t.Fatal("expected schema validation to fail")
+	}
+	result := partialStructuredSuggestion(content)
+	if result.Reply != "请按时服药，一周后复查血压。" {
+		t.Errorf("expected only the reply text, got %q", result.Reply)
+	}
+	if result.Category != models.AISuggestionCategoryVisit || result.Confidence != 0.8 || result.Priority != models.AISuggestionPriorityHigh {
+		t.Errorf("unexpected salvaged fields: %+v", result)
+	}
+
+	for _, raw := range []string{"请按时服药。", `{"category": "visit"}`, `{"reply": "请按时服药`} {
+		if result := partialStructuredSuggestion(raw); result.Reply != raw || result.Confidence != 0 {
+			t.Errorf("expected raw text fallback for %q, got %+v", raw, result)
+		}
+	}
+}
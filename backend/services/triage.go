@@ -0,0 +1,310 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+)
+
+// TriageRule 红旗症状规则
+type TriageRule struct {
+	Name     string            // 规则名称，会记录在分诊记录中
+	Level    string            // 命中后的紧急程度
+	Keywords []string          // 关键字，任一命中即生效（前面带否定词的不算）
+	Check    func(string) bool // 关键字无法表达的规则（如数值阈值）
+}
+
+var (
+	triageBloodPressurePattern = regexp.MustCompile(`(\d{2,3})\s*[/／]\s*(\d{2,3})`)
+	triageBloodSugarPattern    = regexp.MustCompile(`血糖[^\d]{0,6}(\d{1,2}(?:\.\d+)?)`)
+	triageNegations            = []string{"没有", "没", "无", "不", "未"}
+)
+
+// TriageRules 红旗症状规则列表，按紧急程度从高到低排列
+var TriageRules = []TriageRule{
+	{Name: "胸痛", Level: models.MessageUrgencyCritical, Keywords: []string{"胸痛", "胸口痛", "胸口疼", "压榨"}},
+	{Name: "呼吸困难", Level: models.MessageUrgencyCritical, Keywords: []string{"呼吸困难", "喘不上气", "喘不过气", "憋气"}},
+	{Name: "意识改变", Level: models.MessageUrgencyCritical, Keywords: []string{"昏迷", "意识模糊", "叫不醒", "抽搐"}},
+	{Name: "卒中表现", Level: models.MessageUrgencyCritical, Keywords: []string{"口角歪斜", "嘴歪", "说话不清", "言语不清", "半身无力", "一侧肢体无力"}},
+	{Name: "大出血", Level: models.MessageUrgencyCritical, Keywords: []string{"大出血", "吐血", "呕血", "便血"}},
+	{Name: "自伤念头", Level: models.MessageUrgencyCritical, Keywords: []string{"自杀", "不想活"}},
+	{Name: "晕厥", Level: models.MessageUrgencyUrgent, Keywords: []string{"晕倒", "晕厥", "昏倒"}},
+	{Name: "剧烈头痛", Level: models.MessageUrgencyUrgent, Keywords: []string{"剧烈头痛", "头痛欲裂"}},
+	{Name: "心悸", Level: models.MessageUrgencyUrgent, Keywords: []string{"心慌", "心悸", "心跳很快"}},
+	{Name: "视物模糊", Level: models.MessageUrgencyUrgent, Keywords: []string{"视物模糊", "看不清东西"}},
+	{Name: "血压≥180/110", Level: models.MessageUrgencyUrgent, Check: func(text string) bool {
+		for _, match := range triageBloodPressurePattern.FindAllStringSubmatch(text, -1) {
+			systolic, _ := strconv.Atoi(match[1])
+			diastolic, _ := strconv.Atoi(match[2])
+			if systolic >= 180 || diastolic >= 110 {
+				return true
+			}
+		}
+		return false
+	}},
+	{Name: "血糖<3.9或>16.7", Level: models.MessageUrgencyUrgent, Check: func(text string) bool {
+		for _, match := range triageBloodSugarPattern.FindAllStringSubmatch(text, -1) {
+			value, _ := strconv.ParseFloat(match[1], 64)
+			if value > 0 && (value < 3.9 || value > 16.7) {
+				return true
+			}
+		}
+		return false
+	}},
+}
+
+// TriageResult 一次分诊判断的结果
+type TriageResult struct {
+	Level        string
+	MatchedRules []string
+	Rationale    string
+}
+
+// UrgencyRank 紧急程度的排序值，越大越紧急
+func UrgencyRank(level string) int {
+	switch level {
+	case models.MessageUrgencyCritical:
+		return 2
+	case models.MessageUrgencyUrgent:
+		return 1
+	}
+	return 0
+}
+
+// TriageByRules 用红旗症状规则判断消息的紧急程度
+func TriageByRules(content string) TriageResult {
+	result := TriageResult{Level: models.MessageUrgencyNormal}
+	for _, rule := range TriageRules {
+		if !rule.matches(content) {
+			continue
+		}
+		result.MatchedRules = append(result.MatchedRules, rule.Name)
+		if UrgencyRank(rule.Level) > UrgencyRank(result.Level) {
+			result.Level = rule.Level
+		}
+	}
+	if len(result.MatchedRules) > 0 {
+		result.Rationale = "命中红旗症状: " + strings.Join(result.MatchedRules, "、")
+	}
+	return result
+}
+
+func (r TriageRule) matches(content string) bool {
+	if r.Check != nil && r.Check(content) {
+		return true
+	}
+	for _, keyword := range r.Keywords {
+		if containsUnnegated(content, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsUnnegated 判断文本中是否出现关键字，且紧挨着的前文不是否定词
+func containsUnnegated(text string, keyword string) bool {
+	offset := 0
+	for {
+		index := strings.Index(text[offset:], keyword)
+		if index < 0 {
+			return false
+		}
+		start := offset + index
+		prefix := []rune(text[:start])
+		if len(prefix) > 2 {
+			prefix = prefix[len(prefix)-2:]
+		}
+		negated := false
+		for _, negation := range triageNegations {
+			if strings.HasSuffix(string(prefix), negation) {
+				negated = true
+				break
+			}
+		}
+		if !negated {
+			return true
+		}
+		offset = start + len(keyword)
+	}
+}
+
+// TriageMessageByRules 对消息执行规则分诊并保存结果，需要时升级给医生
+func TriageMessageByRules(message *models.Message) (*models.TriageDecision, error) {
+	result := TriageByRules(message.Content)
+	decision := newTriageDecision(message, models.TriageSourceRule, result)
+	return decision, applyTriageDecision(message, decision)
+}
+
+// TriageMessageByModel 用大模型对消息分诊并保存结果，模型调用失败时也会保存一条带错误信息的记录
+func (s *AIService) TriageMessageByModel(patient *models.Patient, message *models.Message) (*models.TriageDecision, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	result, modelUsed, err := s.triageByModel(ctx, aiCall{Purpose: models.AICallPurposeTriage, Patient: patient, MessageID: message.ID}, message.Content)
+	decision := newTriageDecision(message, models.TriageSourceModel, result)
+	decision.ModelUsed = modelUsed
+	if err != nil {
+		decision.Error = err.Error()
+	}
+	if applyErr := applyTriageDecision(message, decision); applyErr != nil {
+		return decision, applyErr
+	}
+	return decision, err
+}
+
+// needsModelTriage 任务重试时，已经成功完成过模型分诊的消息不再重复判断
+func (s *AIService) needsModelTriage(messageID string) bool {
+	decisions, err := storage.GetTriageStorage().GetDecisionsByMessageID(messageID)
+	if err != nil {
+		return true
+	}
+	for _, decision := range decisions {
+		if decision.Source == models.TriageSourceModel && decision.Error == "" {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *AIService) triageByModel(ctx context.Context, call aiCall, content string) (TriageResult, string, error) {
+	result := TriageResult{Level: models.MessageUrgencyNormal}
+
+	resp, err := s.chat(ctx, call, ChatRequest{
+		Messages: []ChatMessage{
+			{Role: ChatRoleSystem, Content: config.TriageSystemPrompt},
+			{Role: ChatRoleUser, Content: content},
+		},
+		Temperature: 0.1,
+		JSONMode:    true,
+	})
+	if err != nil {
+		return result, s.provider.Model(), fmt.Errorf("模型分诊失败: %w", err)
+	}
+
+	var parsed struct {
+		Level     string `json:"level"`
+		Rationale string `json:"rationale"`
+	}
+	if err := json.Unmarshal([]byte(stripJSONFence(resp.Content)), &parsed); err != nil {
+		return result, modelName(resp, s.provider), fmt.Errorf("解析模型分诊结果失败: %w", err)
+	}
+	switch parsed.Level {
+	case models.MessageUrgencyNormal, models.MessageUrgencyUrgent, models.MessageUrgencyCritical:
+	default:
+		return result, modelName(resp, s.provider), fmt.Errorf("无效的分诊等级: %s", parsed.Level)
+	}
+
+	result.Level = parsed.Level
+	result.Rationale = parsed.Rationale
+	return result, modelName(resp, s.provider), nil
+}
+
+func newTriageDecision(message *models.Message, source string, result TriageResult) *models.TriageDecision {
+	now := time.Now()
+	return &models.TriageDecision{
+		BaseModel: models.BaseModel{
+			ID:        utils.GenerateID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		MessageID:    message.ID,
+		PatientID:    message.PatientID,
+		Source:       source,
+		Level:        result.Level,
+		MatchedRules: result.MatchedRules,
+		Rationale:    result.Rationale,
+	}
+}
+
+// applyTriageDecision 保存分诊记录；紧急程度只升不降，达到 urgent 时创建或升级升级事件
+func applyTriageDecision(message *models.Message, decision *models.TriageDecision) error {
+	triageStorage := storage.GetTriageStorage()
+	if decision.MatchedRules == nil {
+		decision.MatchedRules = []string{}
+	}
+	if err := triageStorage.CreateDecision(decision); err != nil {
+		return fmt.Errorf("保存分诊记录失败: %w", err)
+	}
+
+	if UrgencyRank(decision.Level) <= UrgencyRank(message.Urgency) {
+		return nil
+	}
+	if err := triageStorage.UpdateMessageUrgency(message.ID, decision.Level); err != nil {
+		return fmt.Errorf("更新消息紧急程度失败: %w", err)
+	}
+	message.Urgency = decision.Level
+
+	return escalate(message, decision)
+}
+
+// escalate 为紧急消息创建升级事件，已有未处理的事件时提升其等级
+func escalate(message *models.Message, decision *models.TriageDecision) error {
+	triageStorage := storage.GetTriageStorage()
+	reason := decision.Rationale
+	if reason == "" {
+		reason = "分诊判断为" + decision.Level
+	}
+
+	existing, err := triageStorage.GetOpenEscalationByMessageID(message.ID)
+	if err != nil {
+		return fmt.Errorf("获取升级事件失败: %w", err)
+	}
+	if existing != nil {
+		existing.Level = decision.Level
+		existing.Reason = reason
+		existing.Status = models.EscalationStatusOpen
+		return triageStorage.SaveEscalation(existing)
+	}
+
+	patient, err := storage.GetPatientStorage().GetPatientByID(message.PatientID)
+	if err != nil {
+		return fmt.Errorf("获取患者信息失败: %w", err)
+	}
+
+	now := time.Now()
+	escalation := &models.Escalation{
+		BaseModel: models.BaseModel{
+			ID:        utils.GenerateID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		PatientID: message.PatientID,
+		DoctorID:  patient.DoctorID,
+		MessageID: message.ID,
+		Level:     decision.Level,
+		Reason:    reason,
+		Status:    models.EscalationStatusOpen,
+	}
+	if err := triageStorage.CreateEscalation(escalation); err != nil {
+		return fmt.Errorf("创建升级事件失败: %w", err)
+	}
+	log.Printf("消息已升级给医生 (MessageID: %s, 等级: %s, 原因: %s)", message.ID, decision.Level, reason)
+	return nil
+}
+
+// EscalateSuggestion 按消息的紧急程度提升AI建议的类别和优先级
+func EscalateSuggestion(suggestion *models.AISuggestion, urgency string) {
+	minPriority := 0
+	switch urgency {
+	case models.MessageUrgencyCritical:
+		minPriority = models.AISuggestionPriorityCritical
+	case models.MessageUrgencyUrgent:
+		minPriority = models.AISuggestionPriorityUrgent
+	default:
+		return
+	}
+	suggestion.Category = models.AISuggestionCategoryUrgent
+	if suggestion.Priority < minPriority {
+		suggestion.Priority = minPriority
+	}
+}
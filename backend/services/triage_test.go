@@ -0,0 +1,21 @@
+package services
+
+import "testing"
+
+func TestTriageByRules(t *testing.T) {
+	cases := []struct {
+		content string
+		level   string
+	}{
+		{"突然胸痛，喘不上气", "critical"},
+		{"没有胸痛，就是有点累", "normal"},
+		{"今天血压185/100，头有点胀", "urgent"},
+		{"早上空腹血糖3.2，手抖出汗", "urgent"},
+		{"想问一下二甲双胍饭前还是饭后吃", "normal"},
+	}
+	for _, tc := range cases {
+		if got := TriageByRules(tc.content); got.Level != tc.level {
+			t.Errorf("TriageByRules(%q) = %s (%v), want %s", tc.content, got.Level, got.MatchedRules, tc.level)
+		}
+	}
+}
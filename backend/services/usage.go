@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+)
+
+// 月度预算用完后，非必要任务每隔多久重新检查一次预算
+const budgetRecheckInterval = time.Hour
+
+// nonEssentialJobTypes 预算用完时暂停的任务类型。生成建议和分诊关系到患者安全，不受预算限制
+var nonEssentialJobTypes = map[string]bool{
+	models.AIJobTypeSummary: true,
+}
+
+var (
+	modelPricesOnce sync.Once
+	modelPrices     []config.ModelPrice
+)
+
+// ModelPrices 返回当前使用的价格表：配置了 AI_PRICE_TABLE 时从文件加载，加载失败时使用内置价格
+func ModelPrices() []config.ModelPrice {
+	modelPricesOnce.Do(func() {
+		modelPrices = config.DefaultModelPrices
+		path := config.GlobalConfig.AI.PriceTable
+		if path == "" {
+			return
+		}
+		prices, err := LoadModelPrices(path)
+		if err != nil {
+			log.Printf("加载模型价格表失败，使用内置价格: %v", err)
+			return
+		}
+		modelPrices = prices
+	})
+	return modelPrices
+}
+
+// LoadModelPrices 从JSON文件加载价格表，格式与 config.ModelPrice 相同
+func LoadModelPrices(path string) ([]config.ModelPrice, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var prices []config.ModelPrice
+	if err := json.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("解析价格表失败: %w", err)
+	}
+	return prices, nil
+}
+
+// PriceFor 查找模型价格，按最长前缀匹配；价格表中没有的模型返回 false
+func PriceFor(prices []config.ModelPrice, model string) (config.ModelPrice, bool) {
+	var best config.ModelPrice
+	found := false
+	for _, price := range prices {
+		if strings.HasPrefix(model, price.Model) && len(price.Model) > len(best.Model) {
+			best = price
+			found = true
+		}
+	}
+	return best, found
+}
+
+// CallCost 按价格表计算一次调用的费用（元）
+func CallCost(prices []config.ModelPrice, model string, promptTokens int, completionTokens int) float64 {
+	price, ok := PriceFor(prices, model)
+	if !ok {
+		return 0
+	}
+	return (float64(promptTokens)*price.Prompt + float64(completionTokens)*price.Completion) / 1e6
+}
+
+// usageOwner 返回费用归属的医生和科室
+func usageOwner(patient *models.Patient) (doctorID string, departmentID string) {
+	if patient == nil || patient.DoctorID == "" {
+		return "", ""
+	}
+	doctor, err := storage.GetDoctorStorage().GetDoctorByID(patient.DoctorID)
+	if err != nil {
+		return patient.DoctorID, ""
+	}
+	return doctor.ID, doctor.DepartmentID
+}
+
+type usagePatientKey struct{}
+
+// withUsagePatient 在 context 中记录费用归属的患者，供不经过 AIService.chat 的调用（如嵌入）记录用量
+func withUsagePatient(ctx context.Context, patient *models.Patient) context.Context {
+	return context.WithValue(ctx, usagePatientKey{}, patient)
+}
+
+// recordEmbeddingUsage 记录一次嵌入调用的调用日志并累加每日用量，嵌入的文本不保存；保存失败只打印错误
+func recordEmbeddingUsage(ctx context.Context, provider string, model string, promptTokens int, callErr error, latency time.Duration) {
+	now := time.Now()
+	entry := &models.AICallLog{
+		BaseModel: models.BaseModel{
+			ID:        utils.GenerateID(),
+			CreatedAt: now,
+			UpdatedAt: now,
+		},
+		Purpose:      models.AICallPurposeEmbedding,
+		Provider:     provider,
+		Model:        model,
+		Attempt:      1,
+		LatencyMs:    latency.Milliseconds(),
+		PromptTokens: promptTokens,
+		Cost:         CallCost(ModelPrices(), model, promptTokens, 0),
+	}
+	if patient, ok := ctx.Value(usagePatientKey{}).(*models.Patient); ok && patient != nil {
+		entry.PatientID = patient.ID
+		entry.DoctorID, entry.DepartmentID = usageOwner(patient)
+	}
+	if callErr != nil {
+		entry.Error = callErr.Error()
+	}
+
+	if err := storage.GetAICallLogStorage().Create(entry); err != nil {
+		log.Printf("保存AI调用日志失败 (用途: %s): %v", entry.Purpose, err)
+	}
+	recordUsage(entry)
+}
+
+// recordUsage 将一次调用累加到每日用量，保存失败只打印错误
+func recordUsage(entry *models.AICallLog) {
+	usage := &models.AIUsageDaily{
+		BaseModel: models.BaseModel{
+			ID:        utils.GenerateID(),
+			CreatedAt: entry.CreatedAt,
+			UpdatedAt: entry.CreatedAt,
+		},
+		Day:              entry.CreatedAt.Format("2006-01-02"),
+		DoctorID:         entry.DoctorID,
+		DepartmentID:     entry.DepartmentID,
+		PatientID:        entry.PatientID,
+		TemplateID:       entry.TemplateID,
+		Purpose:          entry.Purpose,
+		Provider:         entry.Provider,
+		Model:            entry.Model,
+		Calls:            1,
+		PromptTokens:     int64(entry.PromptTokens),
+		CompletionTokens: int64(entry.CompletionTokens),
+		Cost:             entry.Cost,
+	}
+	if entry.Error != "" {
+		usage.FailedCalls = 1
+	}
+	if err := storage.GetAIUsageStorage().AddUsage(usage); err != nil {
+		log.Printf("保存AI用量失败 (用途: %s, PatientID: %s): %v", entry.Purpose, entry.PatientID, err)
+	}
+}
+
+// BudgetStatus 一个预算本月的使用情况
+type BudgetStatus struct {
+	models.AIBudget
+	Spent    float64 `json:"spent"`    // 本月已用（元）
+	Exceeded bool    `json:"exceeded"` // 是否已超出
+}
+
+// monthStart 所在月份的第一天零点
+func monthStart(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+}
+
+// GetBudgetStatus 计算预算本月的使用情况
+func GetBudgetStatus(budget models.AIBudget, now time.Time) (*BudgetStatus, error) {
+	spent, err := storage.GetAIUsageStorage().SpentSince(budget.Scope, budget.ScopeID, monthStart(now))
+	if err != nil {
+		return nil, err
+	}
+	return &BudgetStatus{
+		AIBudget: budget,
+		Spent:    spent,
+		Exceeded: budget.MonthlyLimit > 0 && spent >= budget.MonthlyLimit,
+	}, nil
+}
+
+// ExceededBudget 依次检查全院、科室和医生的月度预算，返回第一个已超出的预算，都未超出时返回 nil
+func ExceededBudget(doctorID string, departmentID string, now time.Time) (*BudgetStatus, error) {
+	scopes := []struct{ scope, id string }{
+		{models.AIBudgetScopeGlobal, ""},
+		{models.AIBudgetScopeDepartment, departmentID},
+		{models.AIBudgetScopeDoctor, doctorID},
+	}
+	usageStorage := storage.GetAIUsageStorage()
+	for _, item := range scopes {
+		if item.scope != models.AIBudgetScopeGlobal && item.id == "" {
+			continue
+		}
+		budget, err := usageStorage.GetBudget(item.scope, item.id)
+		if err != nil {
+			return nil, err
+		}
+		if budget == nil {
+			continue
+		}
+		status, err := GetBudgetStatus(*budget, now)
+		if err != nil {
+			return nil, err
+		}
+		if status.Exceeded {
+			return status, nil
+		}
+	}
+	return nil, nil
+}
+
+// budgetPause 判断非必要任务是否因预算用完需要暂停，返回暂停原因和下次检查时间
+func budgetPause(job *models.AIJob, now time.Time) (string, time.Time, bool) {
+	if !nonEssentialJobTypes[job.Type] {
+		return "", time.Time{}, false
+	}
+	patient, err := storage.GetPatientStorage().GetPatientByID(job.PatientID)
+	if err != nil {
+		return "", time.Time{}, false
+	}
+	doctorID, departmentID := usageOwner(patient)
+	exceeded, err := ExceededBudget(doctorID, departmentID, now)
+	if err != nil {
+		log.Printf("检查AI预算失败 (JobID: %s): %v", job.ID, err)
+		return "", time.Time{}, false
+	}
+	if exceeded == nil {
+		return "", time.Time{}, false
+	}
+
+	// 下个月预算重置，不需要等满一个检查间隔
+	next := now.Add(budgetRecheckInterval)
+	if reset := monthStart(now).AddDate(0, 1, 0); reset.Before(next) {
+		next = reset
+	}
+	reason := fmt.Sprintf("%s预算已用完（本月 %.2f / %.2f 元），任务暂停", budgetScopeLabel(exceeded.Scope), exceeded.Spent, exceeded.MonthlyLimit)
+	return reason, next, true
+}
+
+func budgetScopeLabel(scope string) string {
+	switch scope {
+	case models.AIBudgetScopeDepartment:
+		return "科室"
+	case models.AIBudgetScopeDoctor:
+		return "医生"
+	}
+	return "全院"
+}
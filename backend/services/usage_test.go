@@ -0,0 +1,40 @@
+package services
+
+import (
+	"math"
+	"testing"
+
+	"we-dear/config"
+)
+
+func TestCallCostUsesLongestPrefix(t *testing.T) {
+	prices := []config.ModelPrice{
+		{Model: "gpt-4o", Prompt: 18, Completion: 72},
+		{Model: "gpt-4o-mini", Prompt: 1.1, Completion: 4.4},
+	}
+
+	cost := CallCost(prices, "gpt-4o-mini-2024-07-18", 1000000, 500000)
+	if math.Abs(cost-3.3) > 1e-9 {
+		t.Errorf("expected gpt-4o-mini pricing (3.3), got %v", cost)
+	}
+	if cost := CallCost(prices, "gpt-4o-2024-08-06", 1000, 0); math.Abs(cost-0.018) > 1e-9 {
+		t.Errorf("expected gpt-4o pricing (0.018), got %v", cost)
+	}
+	if cost := CallCost(prices, "unknown-model", 1000, 1000); cost != 0 {
+		t.Errorf("unknown model should cost 0, got %v", cost)
+	}
+}
+
+func TestPartialStreamResponseEstimatesTokens(t *testing.T) {
+	sent := ChatRequest{Messages: []ChatMessage{
+		{Role: ChatRoleSystem, Content: "你是一位专业的医生"},
+		{Role: ChatRoleUser, Content: "血压有点高怎么办"},
+	}}
+	resp := partialStreamResponse(sent, "建议低盐饮食")
+	if resp.PromptTokens != EstimateTokens("你是一位专业的医生")+EstimateTokens("血压有点高怎么办") {
+		t.Errorf("unexpected prompt tokens %d", resp.PromptTokens)
+	}
+	if resp.CompletionTokens == 0 || resp.CompletionTokens != EstimateTokens("建议低盐饮食") {
+		t.Errorf("aborted stream should count the streamed content, got %d", resp.CompletionTokens)
+	}
+}
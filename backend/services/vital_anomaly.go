@@ -0,0 +1,462 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+)
+
+// vitalSample 参与趋势分析的一个读数
+type vitalSample struct {
+	DataID     string
+	Value      float64
+	MeasuredAt time.Time
+}
+
+// sampleStats 计算读数的均值和总体标准差
+func sampleStats(samples []vitalSample) (mean float64, std float64) {
+	if len(samples) == 0 {
+		return 0, 0
+	}
+	for _, sample := range samples {
+		mean += sample.Value
+	}
+	mean /= float64(len(samples))
+	for _, sample := range samples {
+		std += (sample.Value - mean) * (sample.Value - mean)
+	}
+	return mean, math.Sqrt(std / float64(len(samples)))
+}
+
+// detectVitalDrift 比较近期窗口和之前基线窗口的均值，偏离达到 DriftPercent、超过基线的正常波动，
+// 且至少三分之二的近期读数偏向同一侧时视为持续漂移；samples 按测量时间升序
+func detectVitalDrift(samples []vitalSample, now time.Time, cfg config.VitalAnomalyConfig) *models.VitalFinding {
+	recentStart := now.AddDate(0, 0, -cfg.RecentDays)
+	baselineStart := recentStart.AddDate(0, 0, -cfg.BaselineDays)
+	var baseline, recent []vitalSample
+	for _, sample := range samples {
+		switch {
+		case sample.MeasuredAt.Before(baselineStart) || sample.MeasuredAt.After(now):
+			// 不在统计窗口内
+		case sample.MeasuredAt.Before(recentStart):
+			baseline = append(baseline, sample)
+		default:
+			recent = append(recent, sample)
+		}
+	}
+	if len(baseline) < cfg.MinReadings || len(recent) < cfg.MinReadings {
+		return nil
+	}
+
+	baselineMean, baselineStd := sampleStats(baseline)
+	recentMean, _ := sampleStats(recent)
+	if baselineMean == 0 {
+		return nil
+	}
+	change := (recentMean - baselineMean) / math.Abs(baselineMean) * 100
+	if math.Abs(change) < cfg.DriftPercent || math.Abs(recentMean-baselineMean) <= baselineStd {
+		return nil
+	}
+	// 一两次极端读数拉高均值不算持续漂移
+	sameSide := 0
+	for _, sample := range recent {
+		if (sample.Value-baselineMean)*change > 0 {
+			sameSide++
+		}
+	}
+	if sameSide*3 < len(recent)*2 {
+		return nil
+	}
+
+	return &models.VitalFinding{
+		Kind:          models.VitalFindingKindDrift,
+		Baseline:      baselineMean,
+		Current:       recentMean,
+		ChangePercent: change,
+		WindowStart:   baselineStart,
+		WindowEnd:     now,
+		SampleCount:   len(baseline) + len(recent),
+	}
+}
+
+// detectVitalJump 将近期窗口内的每个读数与它之前 BaselineDays 天的读数比较，
+// 偏离均值达到 JumpPercent 且超过 JumpDeviations 倍标准差时视为突变，返回最近的一次
+func detectVitalJump(samples []vitalSample, now time.Time, cfg config.VitalAnomalyConfig) *models.VitalFinding {
+	recentStart := now.AddDate(0, 0, -cfg.RecentDays)
+	for i := len(samples) - 1; i >= 0; i-- {
+		sample := samples[i]
+		if sample.MeasuredAt.After(now) {
+			continue
+		}
+		if sample.MeasuredAt.Before(recentStart) {
+			break
+		}
+
+		windowStart := sample.MeasuredAt.AddDate(0, 0, -cfg.BaselineDays)
+		var prior []vitalSample
+		for _, previous := range samples[:i] {
+			if !previous.MeasuredAt.Before(windowStart) {
+				prior = append(prior, previous)
+			}
+		}
+		if len(prior) < cfg.MinReadings {
+			continue
+		}
+		mean, std := sampleStats(prior)
+		if mean == 0 {
+			continue
+		}
+		change := (sample.Value - mean) / math.Abs(mean) * 100
+		if math.Abs(change) < cfg.JumpPercent || (std > 0 && math.Abs(sample.Value-mean) < cfg.JumpDeviations*std) {
+			continue
+		}
+
+		return &models.VitalFinding{
+			Kind:          models.VitalFindingKindJump,
+			Baseline:      mean,
+			Current:       sample.Value,
+			ChangePercent: change,
+			DataID:        sample.DataID,
+			WindowStart:   windowStart,
+			WindowEnd:     sample.MeasuredAt,
+			SampleCount:   len(prior) + 1,
+		}
+	}
+	return nil
+}
+
+// detectVitalGap 距上次测量超过平时测量间隔（相邻读数间隔的中位数）的 GapFactor 倍，
+// 且不少于 MinGapDays 天时视为测量中断；times 按时间升序
+func detectVitalGap(times []time.Time, now time.Time, cfg config.VitalAnomalyConfig) *models.VitalFinding {
+	if len(times) < cfg.MinReadings || len(times) < 2 {
+		return nil
+	}
+	intervals := make([]float64, 0, len(times)-1)
+	for i := 1; i < len(times); i++ {
+		intervals = append(intervals, times[i].Sub(times[i-1]).Hours()/24)
+	}
+	sort.Float64s(intervals)
+	typical := intervals[len(intervals)/2]
+	if len(intervals)%2 == 0 {
+		typical = (intervals[len(intervals)/2-1] + typical) / 2
+	}
+
+	last := times[len(times)-1]
+	since := now.Sub(last).Hours() / 24
+	if since <= math.Max(typical*cfg.GapFactor, float64(cfg.MinGapDays)) {
+		return nil
+	}
+	return &models.VitalFinding{
+		Kind:        models.VitalFindingKindGap,
+		Baseline:    typical,
+		Current:     since,
+		WindowStart: last,
+		WindowEnd:   now,
+		SampleCount: len(times),
+	}
+}
+
+// detectPatientAnomalies 按测量类型、测量场景和数值字段分组检测趋势异常，返回未保存的记录；
+// 测量中断按类型检测，不区分场景和字段。records 按测量时间升序
+func detectPatientAnomalies(records []models.PhysiologicalData, types []config.VitalSignType, now time.Time, cfg config.VitalAnomalyConfig) []models.VitalFinding {
+	byType := map[string][]models.PhysiologicalData{}
+	for _, record := range records {
+		byType[record.Type] = append(byType[record.Type], record)
+	}
+
+	var findings []models.VitalFinding
+	for _, definition := range types {
+		typeRecords := byType[definition.Type]
+		if len(typeRecords) == 0 {
+			continue
+		}
+
+		times := make([]time.Time, 0, len(typeRecords))
+		var contexts []string
+		seen := map[string]bool{}
+		for _, record := range typeRecords {
+			times = append(times, record.MeasuredAt)
+			if !seen[record.Context] {
+				seen[record.Context] = true
+				contexts = append(contexts, record.Context)
+			}
+		}
+		sort.Strings(contexts)
+		if finding := detectVitalGap(times, now, cfg); finding != nil {
+			finding.Type = definition.Type
+			finding.Message = vitalGapMessage(definition, finding)
+			findings = append(findings, *finding)
+		}
+
+		for _, context := range contexts {
+			for _, field := range definition.Fields {
+				var samples []vitalSample
+				for _, record := range typeRecords {
+					if value, ok := record.Components[field.Name]; ok && record.Context == context {
+						samples = append(samples, vitalSample{DataID: record.ID, Value: value, MeasuredAt: record.MeasuredAt})
+					}
+				}
+				for _, finding := range []*models.VitalFinding{
+					detectVitalDrift(samples, now, cfg),
+					detectVitalJump(samples, now, cfg),
+				} {
+					if finding == nil {
+						continue
+					}
+					finding.Type = definition.Type
+					finding.Context = context
+					finding.Field = field.Name
+					finding.Message = vitalFindingMessage(definition, field, finding, cfg)
+					findings = append(findings, *finding)
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// vitalFindingMessage 生成漂移和突变的说明，如"空腹血糖值近7天平均 7.2 mmol/L，较此前28天平均 6 上升 20%"
+func vitalFindingMessage(definition config.VitalSignType, field config.VitalField, finding *models.VitalFinding, cfg config.VitalAnomalyConfig) string {
+	label := finding.Context + field.Label
+	direction := "上升"
+	if finding.ChangePercent < 0 {
+		direction = "下降"
+	}
+	change := fmt.Sprintf("%s %.0f%%", direction, math.Abs(finding.ChangePercent))
+	decimals := field.Decimals + 1
+
+	if finding.Kind == models.VitalFindingKindJump {
+		return fmt.Sprintf("%s %s 读数 %s %s，较此前%d天平均 %s %s",
+			label, finding.WindowEnd.Format("01-02 15:04"), formatNumber(finding.Current), definition.Unit,
+			cfg.BaselineDays, formatNumber(roundTo(finding.Baseline, decimals)), change)
+	}
+	return fmt.Sprintf("%s近%d天平均 %s %s，较此前%d天平均 %s %s",
+		label, cfg.RecentDays, formatNumber(roundTo(finding.Current, decimals)), definition.Unit,
+		cfg.BaselineDays, formatNumber(roundTo(finding.Baseline, decimals)), change)
+}
+
+// vitalGapMessage 生成测量中断的说明，如"血压已 9 天未测量，此前约每 1 天测量一次"
+func vitalGapMessage(definition config.VitalSignType, finding *models.VitalFinding) string {
+	return fmt.Sprintf("%s已 %d 天未测量，此前约每 %s 天测量一次",
+		definition.Name, int(finding.Current), formatNumber(roundTo(finding.Baseline, 1)))
+}
+
+func roundTo(value float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	return math.Round(value*scale) / scale
+}
+
+// vitalFindingKey 判断检测结果与已有记录是否为同一异常：漂移按指标合并，
+// 突变按读数、测量中断按上次测量时间区分，新的突变或中断单独记录
+func vitalFindingKey(finding *models.VitalFinding) string {
+	key := strings.Join([]string{finding.Type, finding.Context, finding.Field, finding.Kind}, "|")
+	switch finding.Kind {
+	case models.VitalFindingKindJump:
+		key += "|" + finding.DataID
+	case models.VitalFindingKindGap:
+		key += "|" + strconv.FormatInt(finding.WindowStart.UnixMicro(), 10)
+	}
+	return key
+}
+
+// AnalyzePatientVitals 检测患者已确认生理数据的趋势异常并与已有记录合并：仍存在的异常更新数值，
+// 新出现的异常新建记录，不再出现的异常关闭；测量中断在患者重新测量前一直保留。返回患者当前未关闭的异常。
+// 同一患者的检测持锁串行执行
+func AnalyzePatientVitals(patient *models.Patient, now time.Time) ([]models.VitalFinding, error) {
+	var current []models.VitalFinding
+	err := storage.GetVitalFindingStorage().WithPatientLock(patient.ID, func() error {
+		var err error
+		current, err = analyzePatientVitals(patient, now)
+		return err
+	})
+	return current, err
+}
+
+func analyzePatientVitals(patient *models.Patient, now time.Time) ([]models.VitalFinding, error) {
+	cfg := config.GlobalConfig.Vital
+	from := now.AddDate(0, 0, -(cfg.RecentDays + cfg.BaselineDays))
+	records, err := storage.GetPhysiologicalDataStorage().ListMeasuredSince(patient.ID, from)
+	if err != nil {
+		return nil, err
+	}
+	findingStorage := storage.GetVitalFindingStorage()
+	active, err := findingStorage.ListActive(patient.ID)
+	if err != nil {
+		return nil, err
+	}
+	existing := map[string]*models.VitalFinding{}
+	for i := range active {
+		existing[vitalFindingKey(&active[i])] = &active[i]
+	}
+
+	var current []models.VitalFinding
+	for _, detected := range detectPatientAnomalies(records, VitalSignTypes(), now, cfg) {
+		key := vitalFindingKey(&detected)
+		if finding, ok := existing[key]; ok {
+			delete(existing, key)
+			finding.Baseline = detected.Baseline
+			finding.Current = detected.Current
+			finding.ChangePercent = detected.ChangePercent
+			finding.WindowStart = detected.WindowStart
+			finding.WindowEnd = detected.WindowEnd
+			finding.SampleCount = detected.SampleCount
+			finding.Message = detected.Message
+			finding.UpdatedAt = now
+			if err := findingStorage.Save(finding); err != nil {
+				return nil, err
+			}
+			current = append(current, *finding)
+			continue
+		}
+
+		detected.ID = utils.GenerateID()
+		detected.CreatedAt = now
+		detected.UpdatedAt = now
+		detected.PatientID = patient.ID
+		detected.DoctorID = patient.DoctorID
+		detected.Status = models.VitalFindingStatusOpen
+		if err := findingStorage.Create(&detected); err != nil {
+			return nil, err
+		}
+		current = append(current, detected)
+	}
+
+	for _, finding := range existing {
+		// 长时间未测量时窗口内读数不足，检测不到中断，但中断仍在持续
+		if finding.Kind == models.VitalFindingKindGap && !measuredAfter(records, finding.Type, finding.WindowStart) {
+			if definition, ok := VitalSignTypeByName(finding.Type); ok {
+				finding.Current = now.Sub(finding.WindowStart).Hours() / 24
+				finding.WindowEnd = now
+				finding.Message = vitalGapMessage(definition, finding)
+			}
+			finding.UpdatedAt = now
+			if err := findingStorage.Save(finding); err != nil {
+				return nil, err
+			}
+			current = append(current, *finding)
+			continue
+		}
+
+		finding.Status = models.VitalFindingStatusResolved
+		finding.ResolvedAt = now
+		finding.UpdatedAt = now
+		if err := findingStorage.Save(finding); err != nil {
+			return nil, err
+		}
+	}
+	return current, nil
+}
+
+func measuredAfter(records []models.PhysiologicalData, dataType string, after time.Time) bool {
+	for _, record := range records {
+		if record.Type == dataType && record.MeasuredAt.After(after) {
+			return true
+		}
+	}
+	return false
+}
+
+// AnalyzeAllVitals 检测近期有数据或有未关闭异常的全部患者，单个患者失败只打印错误
+func AnalyzeAllVitals(now time.Time) (int, error) {
+	cfg := config.GlobalConfig.Vital
+	from := now.AddDate(0, 0, -(cfg.RecentDays + cfg.BaselineDays))
+	patientIDs, err := storage.GetPhysiologicalDataStorage().PatientsMeasuredSince(from)
+	if err != nil {
+		return 0, err
+	}
+	withFindings, err := storage.GetVitalFindingStorage().PatientsWithActive()
+	if err != nil {
+		return 0, err
+	}
+
+	analyzed := 0
+	seen := map[string]bool{}
+	for _, patientID := range append(patientIDs, withFindings...) {
+		if seen[patientID] {
+			continue
+		}
+		seen[patientID] = true
+		patient, err := storage.GetPatientStorage().GetPatientByID(patientID)
+		if err != nil {
+			log.Printf("获取患者信息失败 (PatientID: %s): %v", patientID, err)
+			continue
+		}
+		if _, err := AnalyzePatientVitals(patient, now); err != nil {
+			log.Printf("生理指标趋势检测失败 (PatientID: %s): %v", patientID, err)
+			continue
+		}
+		analyzed++
+	}
+	return analyzed, nil
+}
+
+// formatVitalFindings 将未关闭的趋势异常整理为提示中的条目，没有异常时返回空字符串
+func formatVitalFindings(findings []models.VitalFinding) string {
+	var lines []string
+	for _, finding := range findings {
+		lines = append(lines, "- "+finding.Message)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// VitalAnomalyAnalyzer 定期在后台检测全部患者的生理指标趋势异常
+type VitalAnomalyAnalyzer struct {
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// NewVitalAnomalyAnalyzer 创建后台检测，interval 不大于 0 时 Start 不启动检测
+func NewVitalAnomalyAnalyzer(interval time.Duration) *VitalAnomalyAnalyzer {
+	return &VitalAnomalyAnalyzer{
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+// Start 立即检测一次，之后按间隔定期检测
+func (a *VitalAnomalyAnalyzer) Start() {
+	if a.interval <= 0 {
+		log.Printf("生理指标趋势检测未启用")
+		return
+	}
+	a.wg.Add(1)
+	go a.run()
+	log.Printf("生理指标趋势检测已启动: interval=%s", a.interval)
+}
+
+// Stop 停止检测并等待正在进行的检测完成
+func (a *VitalAnomalyAnalyzer) Stop() {
+	close(a.stop)
+	a.wg.Wait()
+}
+
+func (a *VitalAnomalyAnalyzer) run() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		if analyzed, err := AnalyzeAllVitals(time.Now()); err != nil {
+			log.Printf("生理指标趋势检测失败: %v", err)
+		} else {
+			log.Printf("生理指标趋势检测完成: %d 位患者", analyzed)
+		}
+
+		select {
+		case <-a.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+)
+
+// dailyReadings 生成从 days 天前到 last 天前每天一条的读数，value 返回第 i 天（从0开始）的数值分量
+func dailyReadings(now time.Time, dataType string, context string, days int, last int, value func(i int) models.VitalComponents) []models.PhysiologicalData {
+	var records []models.PhysiologicalData
+	for i, day := 0, days; day >= last; i, day = i+1, day-1 {
+		records = append(records, models.PhysiologicalData{
+			BaseModel:  models.BaseModel{ID: fmt.Sprintf("%s-%d", dataType, day)},
+			Type:       dataType,
+			Context:    context,
+			Components: value(i),
+			MeasuredAt: now.AddDate(0, 0, -day),
+		})
+	}
+	return records
+}
+
+func TestDetectPatientAnomalies(t *testing.T) {
+	now := time.Date(2026, 10, 18, 8, 0, 0, 0, time.Local)
+	cfg := config.DefaultVitalAnomalyConfig
+	noise := func(i int) float64 { return float64(i%3-1) * 0.1 }
+
+	// 空腹血糖前两周稳定在6左右，之后三周逐渐升高20%
+	sugar := dailyReadings(now, "blood_sugar", "空腹", 35, 0, func(i int) models.VitalComponents {
+		value := 6 + noise(i)
+		if i > 14 {
+			value += 1.2 * float64(i-14) / 21
+		}
+		return models.VitalComponents{"value": value}
+	})
+	findings := detectPatientAnomalies(sugar, config.DefaultVitalSignTypes, now, cfg)
+	if len(findings) != 1 || findings[0].Kind != models.VitalFindingKindDrift || findings[0].Context != "空腹" || findings[0].ChangePercent < cfg.DriftPercent {
+		t.Fatalf("expected an upward fasting glucose drift, got %+v", findings)
+	}
+
+	// 血压平稳，最后一次收缩压突然升高
+	pressure := dailyReadings(now, "blood_pressure", "", 20, 0, func(i int) models.VitalComponents {
+		return models.VitalComponents{"systolic": 130 + noise(i)*30, "diastolic": 80}
+	})
+	pressure[len(pressure)-1].Components["systolic"] = 182
+	findings = detectPatientAnomalies(pressure, config.DefaultVitalSignTypes, now, cfg)
+	if len(findings) != 1 || findings[0].Kind != models.VitalFindingKindJump || findings[0].Field != "systolic" || findings[0].DataID != pressure[len(pressure)-1].ID {
+		t.Fatalf("expected a systolic jump on the latest reading, got %+v", findings)
+	}
+	if findings[0].Message != "收缩压 10-18 08:00 读数 182 mmHg，较此前28天平均 129.9 上升 40%" {
+		t.Errorf("unexpected message %q", findings[0].Message)
+	}
+
+	// 每天测量体重，最近6天没有测量
+	weight := dailyReadings(now, "weight", "", 20, 6, func(i int) models.VitalComponents {
+		return models.VitalComponents{"value": 70 + noise(i)}
+	})
+	findings = detectPatientAnomalies(weight, config.DefaultVitalSignTypes, now, cfg)
+	if len(findings) != 1 || findings[0].Kind != models.VitalFindingKindGap || findings[0].Message != "体重已 6 天未测量，此前约每 1 天测量一次" {
+		t.Fatalf("expected a weight measurement gap, got %+v", findings)
+	}
+
+	// 平稳的读数不产生异常
+	stable := dailyReadings(now, "heart_rate", "", 30, 0, func(i int) models.VitalComponents {
+		return models.VitalComponents{"value": 72 + noise(i)*20}
+	})
+	if findings := detectPatientAnomalies(stable, config.DefaultVitalSignTypes, now, cfg); len(findings) != 0 {
+		t.Errorf("expected no findings for stable readings, got %+v", findings)
+	}
+}
+
+func TestVitalFindingKey(t *testing.T) {
+	drift := &models.VitalFinding{Type: "blood_sugar", Context: "空腹", Field: "value", Kind: models.VitalFindingKindDrift, DataID: "a"}
+	if vitalFindingKey(drift) != "blood_sugar|空腹|value|drift" {
+		t.Errorf("drift key should not depend on the reading: %s", vitalFindingKey(drift))
+	}
+	first := &models.VitalFinding{Type: "blood_pressure", Field: "systolic", Kind: models.VitalFindingKindJump, DataID: "a"}
+	second := &models.VitalFinding{Type: "blood_pressure", Field: "systolic", Kind: models.VitalFindingKindJump, DataID: "b"}
+	if vitalFindingKey(first) == vitalFindingKey(second) {
+		t.Error("jumps on different readings should be recorded separately")
+	}
+}
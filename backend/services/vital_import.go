@@ -0,0 +1,723 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"we-dear/models"
+)
+
+// 导入文件格式
+const (
+	ImportFormatOpenMHealth = "openmhealth" // Open mHealth 数据点（单个或数组）
+	ImportFormatFHIR        = "fhir"        // FHIR R4 Observation 或包含 Observation 的 Bundle
+)
+
+// MaxImportRows 单个文件最多导入的记录数
+const MaxImportRows = 5000
+
+// ErrInvalidImport 导入文件无法解析
+var ErrInvalidImport = errors.New("无效的导入文件")
+
+// importRow 从导入文件解析出的一条记录，Err 不为空时该记录无法转换为读数
+type importRow struct {
+	Ref     string
+	Reading IngestReading
+	Err     error
+}
+
+// ImportPhysiologicalData 将 Open mHealth 或 FHIR 文件中的测量数据导入为患者已确认的生理数据，
+// 逐条返回结果；重复导入同一文件时已导入的记录返回 duplicate。format 为空时按内容判断格式
+func ImportPhysiologicalData(patientID string, format string, content []byte, now time.Time) ([]IngestResult, error) {
+	if format == "" {
+		format = detectImportFormat(content)
+	}
+	var rows []importRow
+	var err error
+	switch format {
+	case ImportFormatOpenMHealth:
+		rows, err = parseOpenMHealth(content)
+	case ImportFormatFHIR:
+		rows, err = parseFHIR(content, patientID)
+	default:
+		return nil, fmt.Errorf("%w: 不支持的格式 %s", ErrInvalidImport, format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImport, err)
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("%w: 文件中没有测量数据", ErrInvalidImport)
+	}
+	if len(rows) > MaxImportRows {
+		return nil, fmt.Errorf("%w: 单个文件最多导入%d条记录", ErrInvalidImport, MaxImportRows)
+	}
+
+	ingester := newReadingIngester(readingSource{PatientID: patientID, Source: models.PhysiologicalSourceImport}, now)
+	results := make([]IngestResult, 0, len(rows))
+	for i, row := range rows {
+		if row.Err != nil {
+			results = append(results, IngestResult{Index: i, Ref: row.Ref, Type: row.Reading.Type, Status: IngestInvalid, Error: row.Err.Error()})
+			continue
+		}
+		result, err := ingester.ingest(i, row.Reading)
+		if err != nil {
+			return nil, err
+		}
+		result.Ref = row.Ref
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// detectImportFormat 有 resourceType 字段的按 FHIR 解析，否则按 Open mHealth 解析
+func detectImportFormat(content []byte) string {
+	var probe struct {
+		ResourceType string `json:"resourceType"`
+	}
+	if json.Unmarshal(content, &probe) == nil && probe.ResourceType != "" {
+		return ImportFormatFHIR
+	}
+	return ImportFormatOpenMHealth
+}
+
+// importQuantity 导入文件中带单位的数值
+type importQuantity struct {
+	Value float64
+	Unit  string
+}
+
+func identity(value float64) float64 { return value }
+
+// importUnitConversions 导入数据的单位换算，第一层为测量类型的单位，第二层为来源单位（小写，含 UCUM 写法）
+var importUnitConversions = map[string]map[string]func(float64) float64{
+	"mmHg": {
+		"mmhg": identity, "mm[hg]": identity,
+		"kpa": func(v float64) float64 { return v * 7.50062 },
+	},
+	"mmol/L": {
+		"mmol/l": identity,
+		"mg/dl":  func(v float64) float64 { return v / 18 },
+	},
+	"kg": {
+		"kg": identity,
+		"g":  func(v float64) float64 { return v / 1000 },
+		"lb": func(v float64) float64 { return v * 0.45359237 }, "[lb_av]": func(v float64) float64 { return v * 0.45359237 },
+		"斤": func(v float64) float64 { return v / 2 },
+	},
+	"次/分": {
+		"/min": identity, "beats/min": identity, "{beats}/min": identity, "bpm": identity, "次/分": identity,
+	},
+	"%": {
+		"%": identity,
+	},
+	"℃": {
+		"cel": identity, "c": identity, "℃": identity, "°c": identity,
+		"[degf]": fahrenheitToCelsius, "f": fahrenheitToCelsius, "°f": fahrenheitToCelsius,
+	},
+	"步": {
+		"steps": identity, "{steps}": identity, "步": identity,
+	},
+}
+
+func fahrenheitToCelsius(value float64) float64 {
+	return (value - 32) * 5 / 9
+}
+
+// convertImportUnit 将数值换算为测量类型的单位，未给出单位时视为已是目标单位
+func convertImportUnit(quantity importQuantity, target string) (float64, error) {
+	unit := strings.TrimSpace(quantity.Unit)
+	if unit == "" || unit == target {
+		return quantity.Value, nil
+	}
+	convert, ok := importUnitConversions[target][strings.ToLower(unit)]
+	if !ok {
+		return 0, fmt.Errorf("不支持的单位 %s（应为 %s）", unit, target)
+	}
+	return convert(quantity.Value), nil
+}
+
+// importReading 将各数值字段换算单位并按字段精度取整，生成待保存的读数
+func importReading(dataType string, context string, measuredAt time.Time, quantities map[string]importQuantity) (IngestReading, error) {
+	reading := IngestReading{Type: dataType, Context: context, MeasuredAt: measuredAt, Values: map[string]float64{}}
+	definition, ok := VitalSignTypeByName(dataType)
+	if !ok {
+		return reading, fmt.Errorf("不支持的数据类型: %s", dataType)
+	}
+	for _, field := range definition.Fields {
+		quantity, ok := quantities[field.Name]
+		if !ok {
+			continue
+		}
+		value, err := convertImportUnit(quantity, definition.Unit)
+		if err != nil {
+			return reading, fmt.Errorf("%s%s", field.Label, err.Error())
+		}
+		decimals := field.Decimals
+		if field.Integer {
+			decimals = 0
+		}
+		reading.Values[field.Name] = roundTo(value, decimals)
+	}
+	return reading, nil
+}
+
+// parseImportTime 解析 RFC3339 时间或只有日期的时间
+func parseImportTime(value string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return parsed, nil
+	}
+	if parsed, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return parsed, nil
+	}
+	return time.Time{}, fmt.Errorf("无效的时间: %q", value)
+}
+
+// splitJSONItems 解析 JSON 数组或单个对象
+func splitJSONItems(content []byte) ([]json.RawMessage, error) {
+	content = bytes.TrimSpace(content)
+	if len(content) > 0 && content[0] == '[' {
+		var items []json.RawMessage
+		err := json.Unmarshal(content, &items)
+		return items, err
+	}
+	var item json.RawMessage
+	if err := json.Unmarshal(content, &item); err != nil {
+		return nil, err
+	}
+	return []json.RawMessage{item}, nil
+}
+
+// omhMapping Open mHealth schema 与测量类型的对应关系，Fields 为数值字段到 body 中属性名的映射
+type omhMapping struct {
+	Schema string
+	Type   string
+	Fields map[string]string
+}
+
+// omhSchemas 支持的 schema；没有 header 时按顺序匹配 body 中的属性，第一个匹配的为准
+var omhSchemas = []omhMapping{
+	{Schema: "blood-pressure", Type: "blood_pressure", Fields: map[string]string{"systolic": "systolic_blood_pressure", "diastolic": "diastolic_blood_pressure"}},
+	{Schema: "blood-glucose", Type: "blood_sugar", Fields: map[string]string{"value": "blood_glucose"}},
+	{Schema: "body-weight", Type: "weight", Fields: map[string]string{"value": "body_weight"}},
+	{Schema: "heart-rate", Type: "heart_rate", Fields: map[string]string{"value": "heart_rate"}},
+	{Schema: "oxygen-saturation", Type: "blood_oxygen", Fields: map[string]string{"value": "oxygen_saturation"}},
+	{Schema: "body-temperature", Type: "temperature", Fields: map[string]string{"value": "body_temperature"}},
+	{Schema: "step-count", Type: "steps", Fields: map[string]string{"value": "step_count"}},
+}
+
+// omhSchemaFor 按 schema 名称查找映射，名称为空时按 body 中的属性判断
+func omhSchemaFor(point omhDataPoint) (omhMapping, bool) {
+	name := point.Header.SchemaID.Name
+	for _, mapping := range omhSchemas {
+		if name != "" {
+			if mapping.Schema == name {
+				return mapping, true
+			}
+			continue
+		}
+		for _, property := range mapping.Fields {
+			if _, found := point.Body[property]; found {
+				return mapping, true
+			}
+		}
+	}
+	return omhMapping{}, false
+}
+
+type omhDataPoint struct {
+	Header struct {
+		ID       string `json:"id"`
+		SchemaID struct {
+			Name string `json:"name"`
+		} `json:"schema_id"`
+		AcquisitionProvenance struct {
+			SourceName string `json:"source_name"`
+		} `json:"acquisition_provenance"`
+	} `json:"header"`
+	Body map[string]json.RawMessage `json:"body"`
+}
+
+type omhTimeFrame struct {
+	DateTime     string `json:"date_time"`
+	TimeInterval struct {
+		StartDateTime string `json:"start_date_time"`
+		EndDateTime   string `json:"end_date_time"`
+	} `json:"time_interval"`
+}
+
+// parseOpenMHealth 解析 Open mHealth 数据点，可以是单个数据点、数据点数组，也可以只有 body；
+// 没有 header 时按 body 中的属性判断 schema
+func parseOpenMHealth(content []byte) ([]importRow, error) {
+	items, err := splitJSONItems(content)
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]importRow, 0, len(items))
+	for i, item := range items {
+		var point omhDataPoint
+		if err := json.Unmarshal(item, &point); err != nil {
+			rows = append(rows, importRow{Ref: fmt.Sprintf("#%d", i), Err: fmt.Errorf("无效的数据点: %v", err)})
+			continue
+		}
+		if point.Body == nil {
+			json.Unmarshal(item, &point.Body)
+		}
+		row := importRow{Ref: point.Header.ID}
+		if row.Ref == "" {
+			row.Ref = fmt.Sprintf("#%d", i)
+		}
+		row.Reading, row.Err = omhReading(point)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+func omhReading(point omhDataPoint) (IngestReading, error) {
+	mapping, ok := omhSchemaFor(point)
+	if !ok {
+		return IngestReading{}, fmt.Errorf("不支持的 Open mHealth schema: %s", point.Header.SchemaID.Name)
+	}
+
+	quantities := map[string]importQuantity{}
+	for field, property := range mapping.Fields {
+		raw, found := point.Body[property]
+		if !found {
+			continue
+		}
+		quantity, err := omhQuantity(raw)
+		if err != nil {
+			return IngestReading{Type: mapping.Type}, fmt.Errorf("无效的 %s: %v", property, err)
+		}
+		quantities[field] = quantity
+	}
+
+	var frame omhTimeFrame
+	if raw, found := point.Body["effective_time_frame"]; found {
+		json.Unmarshal(raw, &frame)
+	}
+	timestamp := frame.DateTime
+	if timestamp == "" {
+		timestamp = frame.TimeInterval.EndDateTime
+	}
+	if timestamp == "" {
+		timestamp = frame.TimeInterval.StartDateTime
+	}
+	if timestamp == "" {
+		return IngestReading{Type: mapping.Type}, fmt.Errorf("缺少测量时间 effective_time_frame")
+	}
+	measuredAt, err := parseImportTime(timestamp)
+	if err != nil {
+		return IngestReading{Type: mapping.Type}, err
+	}
+
+	context := ""
+	if raw, found := point.Body["temporal_relationship_to_meal"]; found {
+		var relationship string
+		json.Unmarshal(raw, &relationship)
+		context = mealContext(relationship)
+	}
+	reading, err := importReading(mapping.Type, context, measuredAt, quantities)
+	if source := point.Header.AcquisitionProvenance.SourceName; source != "" {
+		reading.Notes = "Open mHealth导入，来源：" + source
+	} else {
+		reading.Notes = "Open mHealth导入"
+	}
+	return reading, err
+}
+
+// omhQuantity 解析 {"value": 120, "unit": "mmHg"}，也兼容旧版 step-count 直接给出数值
+func omhQuantity(raw json.RawMessage) (importQuantity, error) {
+	var number float64
+	if json.Unmarshal(raw, &number) == nil {
+		return importQuantity{Value: number}, nil
+	}
+	var value struct {
+		Value *float64 `json:"value"`
+		Unit  string   `json:"unit"`
+	}
+	if err := json.Unmarshal(raw, &value); err != nil {
+		return importQuantity{}, err
+	}
+	if value.Value == nil {
+		return importQuantity{}, fmt.Errorf("缺少数值")
+	}
+	return importQuantity{Value: *value.Value, Unit: value.Unit}, nil
+}
+
+// mealContext 将 Open mHealth 的 temporal_relationship_to_meal 转换为血糖测量场景
+func mealContext(relationship string) string {
+	relationship = strings.ToLower(relationship)
+	switch {
+	case relationship == "fasting":
+		return "空腹"
+	case strings.Contains(relationship, "postprandial") || strings.Contains(relationship, "after"):
+		return "餐后"
+	default:
+		return ""
+	}
+}
+
+// loincMapping LOINC 编码与测量类型的对应关系；Field 为空表示组合观测（如血压），数值在 component 中
+type loincMapping struct {
+	Type    string
+	Field   string
+	Context string
+}
+
+const loincSystem = "http://loinc.org"
+
+// loincPanels 多字段类型对应的组合观测编码，单独上报的分量观测配对后按该编码合并
+var loincPanels = map[string]string{
+	"blood_pressure": "85354-9",
+}
+
+var loincCodes = map[string]loincMapping{
+	"85354-9": {Type: "blood_pressure"},                     // Blood pressure panel
+	"55284-4": {Type: "blood_pressure"},                     // Blood pressure systolic and diastolic
+	"8480-6":  {Type: "blood_pressure", Field: "systolic"},  // Systolic blood pressure
+	"8462-4":  {Type: "blood_pressure", Field: "diastolic"}, // Diastolic blood pressure
+	"2339-0":  {Type: "blood_sugar", Field: "value"},        // Glucose [Mass/volume] in Blood
+	"15074-8": {Type: "blood_sugar", Field: "value"},        // Glucose [Moles/volume] in Blood
+	"2345-7":  {Type: "blood_sugar", Field: "value"},        // Glucose [Mass/volume] in Serum or Plasma
+	"14749-6": {Type: "blood_sugar", Field: "value"},        // Glucose [Moles/volume] in Serum or Plasma
+	"41653-7": {Type: "blood_sugar", Field: "value"},        // Glucose [Mass/volume] in Capillary blood by Glucometer
+	"14743-9": {Type: "blood_sugar", Field: "value"},        // Glucose [Moles/volume] in Capillary blood by Glucometer
+	"1558-6":  {Type: "blood_sugar", Field: "value", Context: "空腹"},
+	"14771-0": {Type: "blood_sugar", Field: "value", Context: "空腹"},
+	"1521-4":  {Type: "blood_sugar", Field: "value", Context: "餐后"}, // Glucose --2 hours post meal
+	"29463-7": {Type: "weight", Field: "value"},                     // Body weight
+	"3141-9":  {Type: "weight", Field: "value"},                     // Body weight Measured
+	"8867-4":  {Type: "heart_rate", Field: "value"},                 // Heart rate
+	"59408-5": {Type: "blood_oxygen", Field: "value"},               // Oxygen saturation by Pulse oximetry
+	"2708-6":  {Type: "blood_oxygen", Field: "value"},               // Oxygen saturation in Arterial blood
+	"8310-5":  {Type: "temperature", Field: "value"},                // Body temperature
+	"4548-4":  {Type: "hba1c", Field: "value"},                      // Hemoglobin A1c/Hemoglobin.total in Blood
+	"55423-8": {Type: "steps", Field: "value"},                      // Number of steps
+	"41950-7": {Type: "steps", Field: "value"},                      // Number of steps in 24 hour Measured
+}
+
+type fhirCoding struct {
+	System string `json:"system"`
+	Code   string `json:"code"`
+}
+
+type fhirCodeableConcept struct {
+	Coding []fhirCoding `json:"coding"`
+	Text   string       `json:"text"`
+}
+
+// loinc 返回第一个能识别的 LOINC 编码
+func (c fhirCodeableConcept) loinc() (string, loincMapping, bool) {
+	for _, coding := range c.Coding {
+		if coding.System != loincSystem {
+			continue
+		}
+		if mapping, ok := loincCodes[coding.Code]; ok {
+			return coding.Code, mapping, true
+		}
+	}
+	return "", loincMapping{}, false
+}
+
+type fhirQuantity struct {
+	Value *float64 `json:"value"`
+	Unit  string   `json:"unit"`
+	Code  string   `json:"code"` // UCUM 单位
+}
+
+type fhirComponent struct {
+	Code          fhirCodeableConcept `json:"code"`
+	ValueQuantity *fhirQuantity       `json:"valueQuantity"`
+}
+
+type fhirObservation struct {
+	ResourceType      string              `json:"resourceType"`
+	ID                string              `json:"id"`
+	Status            string              `json:"status"`
+	Code              fhirCodeableConcept `json:"code"`
+	EffectiveDateTime string              `json:"effectiveDateTime"`
+	EffectiveInstant  string              `json:"effectiveInstant"`
+	EffectivePeriod   struct {
+		Start string `json:"start"`
+		End   string `json:"end"`
+	} `json:"effectivePeriod"`
+	Issued        string          `json:"issued"`
+	ValueQuantity *fhirQuantity   `json:"valueQuantity"`
+	Component     []fhirComponent `json:"component"`
+	Device        struct {
+		Display string `json:"display"`
+	} `json:"device"`
+	Subject struct {
+		Reference string `json:"reference"`
+	} `json:"subject"`
+}
+
+// effectiveTime 返回观测的测量时间，依次取 effectiveDateTime、effectiveInstant、effectivePeriod 和 issued
+func (o fhirObservation) effectiveTime() string {
+	for _, candidate := range []string{o.EffectiveDateTime, o.EffectiveInstant, o.EffectivePeriod.End, o.EffectivePeriod.Start, o.Issued} {
+		if candidate != "" {
+			return candidate
+		}
+	}
+	return ""
+}
+
+type fhirBundle struct {
+	ResourceType string `json:"resourceType"`
+	Entry        []struct {
+		FullURL  string          `json:"fullUrl"`
+		Resource json.RawMessage `json:"resource"`
+	} `json:"entry"`
+}
+
+// fhirItem 解析出的一个 Observation
+type fhirItem struct {
+	Ref         string
+	Observation fhirObservation
+	Err         error
+}
+
+// parseFHIR 解析 FHIR R4 Observation，或 Bundle 中的全部 Observation（其他资源忽略）；
+// subject 指向其他患者的观测报告为无效，不导入到 patientID 名下
+func parseFHIR(content []byte, patientID string) ([]importRow, error) {
+	var bundle fhirBundle
+	if err := json.Unmarshal(content, &bundle); err != nil {
+		return nil, err
+	}
+	switch bundle.ResourceType {
+	case "Observation":
+		item := fhirParseItem(content, "")
+		checkFHIRSubject(&item, patientID, nil)
+		return fhirRows([]fhirItem{item}), nil
+	case "Bundle":
+	default:
+		return nil, fmt.Errorf("不支持的 FHIR 资源类型 %q，应为 Bundle 或 Observation", bundle.ResourceType)
+	}
+
+	// Bundle 中的 Patient 资源，subject 可以通过 fullUrl 引用它们
+	bundlePatients := map[string]string{}
+	for _, entry := range bundle.Entry {
+		var probe struct {
+			ResourceType string `json:"resourceType"`
+			ID           string `json:"id"`
+		}
+		if json.Unmarshal(entry.Resource, &probe) == nil && probe.ResourceType == "Patient" && entry.FullURL != "" {
+			bundlePatients[entry.FullURL] = probe.ID
+		}
+	}
+
+	var items []fhirItem
+	for _, entry := range bundle.Entry {
+		var probe struct {
+			ResourceType string `json:"resourceType"`
+		}
+		if json.Unmarshal(entry.Resource, &probe) != nil || probe.ResourceType != "Observation" {
+			continue
+		}
+		item := fhirParseItem(entry.Resource, entry.FullURL)
+		checkFHIRSubject(&item, patientID, bundlePatients)
+		items = append(items, item)
+	}
+	return fhirRows(items), nil
+}
+
+// checkFHIRSubject 观测的 subject 不指向该患者时标记为无效；没有 subject 的观测视为属于该患者
+func checkFHIRSubject(item *fhirItem, patientID string, bundlePatients map[string]string) {
+	if item.Err != nil {
+		return
+	}
+	reference := item.Observation.Subject.Reference
+	if reference == "" || fhirReferencesPatient(reference, patientID, bundlePatients) {
+		return
+	}
+	item.Err = fmt.Errorf("观测对象 %s 不是当前患者", reference)
+}
+
+// fhirReferencesPatient 判断引用是否指向该患者：Patient/<id>、以 /Patient/<id> 结尾的完整地址（可带版本），
+// 或 Bundle 中 id 为该患者ID的 Patient 资源的 fullUrl
+func fhirReferencesPatient(reference string, patientID string, bundlePatients map[string]string) bool {
+	if id, ok := bundlePatients[reference]; ok {
+		return id == patientID
+	}
+	if index := strings.Index(reference, "/_history/"); index >= 0 {
+		reference = reference[:index]
+	}
+	return reference == "Patient/"+patientID || strings.HasSuffix(reference, "/Patient/"+patientID)
+}
+
+func fhirParseItem(resource json.RawMessage, fullURL string) fhirItem {
+	var observation fhirObservation
+	if err := json.Unmarshal(resource, &observation); err != nil {
+		return fhirItem{Ref: fullURL, Err: fmt.Errorf("无效的 Observation: %v", err)}
+	}
+	item := fhirItem{Ref: observation.ID, Observation: observation}
+	if item.Ref == "" {
+		item.Ref = fullURL
+	}
+	return item
+}
+
+// fhirRows 将观测转换为导入行。单独上报的收缩压（8480-6）、舒张压（8462-4）等多字段类型的分量观测，
+// 按患者和测量时间配对后合并为一条读数；配不齐的分量观测报告为无效
+func fhirRows(items []fhirItem) []importRow {
+	rows := make([]importRow, 0, len(items))
+	groups := map[string][]int{} // 配对键 -> 分量观测在 items 中的下标
+	groupRows := map[string]int{}
+	for i, item := range items {
+		if item.Err != nil {
+			rows = append(rows, importRow{Ref: item.Ref, Err: item.Err})
+			continue
+		}
+		if key, ok := fhirComponentKey(item.Observation); ok {
+			if _, exists := groups[key]; !exists {
+				groupRows[key] = len(rows)
+				rows = append(rows, importRow{})
+			}
+			groups[key] = append(groups[key], i)
+			continue
+		}
+		row := importRow{Ref: item.Ref}
+		row.Reading, row.Err = fhirReading(item.Observation)
+		rows = append(rows, row)
+	}
+
+	for key, indexes := range groups {
+		refs := make([]string, 0, len(indexes))
+		observations := make([]fhirObservation, 0, len(indexes))
+		for _, index := range indexes {
+			refs = append(refs, items[index].Ref)
+			observations = append(observations, items[index].Observation)
+		}
+		row := importRow{Ref: strings.Join(refs, "+")}
+		if missing := missingFHIRComponents(observations); missing != "" {
+			_, mapping, _ := observations[0].Code.loinc()
+			row.Reading = IngestReading{Type: mapping.Type}
+			row.Err = fmt.Errorf("缺少同一患者同一测量时间的%s观测", missing)
+		} else {
+			row.Reading, row.Err = fhirReading(mergeFHIRComponents(observations))
+		}
+		rows[groupRows[key]] = row
+	}
+	return rows
+}
+
+// fhirComponentKey 单独上报的分量观测返回配对键（患者 + 测量时间），其他观测返回 false
+func fhirComponentKey(observation fhirObservation) (string, bool) {
+	_, mapping, ok := observation.Code.loinc()
+	if !ok || mapping.Field == "" {
+		return "", false
+	}
+	definition, ok := VitalSignTypeByName(mapping.Type)
+	if !ok || len(definition.Fields) < 2 {
+		return "", false
+	}
+	timestamp := observation.effectiveTime()
+	if measuredAt, err := parseImportTime(timestamp); err == nil {
+		timestamp = measuredAt.UTC().Format(time.RFC3339)
+	}
+	return mapping.Type + "|" + observation.Subject.Reference + "|" + timestamp, true
+}
+
+// missingFHIRComponents 返回配对后仍缺少的字段名称，如"舒张压"，齐全时返回空
+func missingFHIRComponents(observations []fhirObservation) string {
+	_, mapping, _ := observations[0].Code.loinc()
+	definition, _ := VitalSignTypeByName(mapping.Type)
+	present := map[string]bool{}
+	for _, observation := range observations {
+		_, componentMapping, _ := observation.Code.loinc()
+		present[componentMapping.Field] = true
+	}
+	var missing []string
+	for _, field := range definition.Fields {
+		if !present[field.Name] {
+			missing = append(missing, field.Label)
+		}
+	}
+	return strings.Join(missing, "、")
+}
+
+// mergeFHIRComponents 将同一时间的分量观测合并为组合观测，任一观测已作废时合并结果也作废
+func mergeFHIRComponents(observations []fhirObservation) fhirObservation {
+	merged := observations[0]
+	merged.ValueQuantity = nil
+	merged.Component = nil
+	for _, observation := range observations {
+		if observation.Status == "entered-in-error" || observation.Status == "cancelled" {
+			merged.Status = observation.Status
+		}
+		merged.Component = append(merged.Component, fhirComponent{Code: observation.Code, ValueQuantity: observation.ValueQuantity})
+	}
+	_, mapping, _ := merged.Code.loinc()
+	merged.Code = fhirCodeableConcept{Coding: []fhirCoding{{System: loincSystem, Code: loincPanels[mapping.Type]}}}
+	return merged
+}
+
+func fhirReading(observation fhirObservation) (IngestReading, error) {
+	if observation.Status == "entered-in-error" || observation.Status == "cancelled" {
+		return IngestReading{}, fmt.Errorf("观测状态为 %s，不导入", observation.Status)
+	}
+	code, mapping, ok := observation.Code.loinc()
+	if !ok {
+		return IngestReading{}, fmt.Errorf("不支持的观测编码 %s", fhirCodeText(observation.Code))
+	}
+
+	quantities := map[string]importQuantity{}
+	if mapping.Field != "" {
+		if observation.ValueQuantity == nil || observation.ValueQuantity.Value == nil {
+			return IngestReading{Type: mapping.Type}, fmt.Errorf("LOINC %s 缺少 valueQuantity", code)
+		}
+		quantities[mapping.Field] = observation.ValueQuantity.quantity()
+	} else {
+		for _, component := range observation.Component {
+			_, componentMapping, ok := component.Code.loinc()
+			if !ok || componentMapping.Type != mapping.Type || componentMapping.Field == "" ||
+				component.ValueQuantity == nil || component.ValueQuantity.Value == nil {
+				continue
+			}
+			quantities[componentMapping.Field] = component.ValueQuantity.quantity()
+		}
+	}
+
+	timestamp := observation.effectiveTime()
+	if timestamp == "" {
+		return IngestReading{Type: mapping.Type}, fmt.Errorf("缺少测量时间 effectiveDateTime")
+	}
+	measuredAt, err := parseImportTime(timestamp)
+	if err != nil {
+		return IngestReading{Type: mapping.Type}, err
+	}
+
+	reading, err := importReading(mapping.Type, mapping.Context, measuredAt, quantities)
+	reading.Notes = "FHIR导入"
+	if observation.Device.Display != "" {
+		reading.Notes += "，设备：" + observation.Device.Display
+	}
+	return reading, err
+}
+
+// quantity 优先使用 UCUM 单位编码
+func (q *fhirQuantity) quantity() importQuantity {
+	unit := q.Code
+	if unit == "" {
+		unit = q.Unit
+	}
+	return importQuantity{Value: *q.Value, Unit: unit}
+}
+
+func fhirCodeText(concept fhirCodeableConcept) string {
+	var codes []string
+	for _, coding := range concept.Coding {
+		codes = append(codes, coding.Code)
+	}
+	if concept.Text != "" {
+		codes = append(codes, concept.Text)
+	}
+	if len(codes) == 0 {
+		return "（空）"
+	}
+	return strings.Join(codes, " ")
+}
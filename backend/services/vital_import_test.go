@@ -0,0 +1,228 @@
+package services
+
+import (
+	"testing"
+
+	"we-dear/config"
+)
+
+func TestParseFHIR(t *testing.T) {
+	bundle := `{
+  "resourceType": "Bundle",
+  "type": "collection",
+  "entry": [
+    {"fullUrl": "urn:uuid:patient", "resource": {"resourceType": "Patient", "id": "p1"}},
+    {"resource": {
+      "resourceType": "Observation", "id": "bp1", "status": "final",
+      "code": {"coding": [{"system": "http://loinc.org", "code": "85354-9"}]},
+      "effectiveDateTime": "2024-12-18T08:00:00+08:00",
+      "component": [
+        {"code": {"coding": [{"system": "http://loinc.org", "code": "8480-6"}]}, "valueQuantity": {"value": 138, "unit": "mmHg", "code": "mm[Hg]"}},
+        {"code": {"coding": [{"system": "http://loinc.org", "code": "8462-4"}]}, "valueQuantity": {"value": 88, "unit": "mmHg", "code": "mm[Hg]"}}
+      ]
+    }},
+    {"resource": {
+      "resourceType": "Observation", "id": "glu1", "status": "final",
+      "code": {"coding": [{"system": "http://loinc.org", "code": "1558-6"}]},
+      "effectiveDateTime": "2024-12-18T07:00:00+08:00",
+      "valueQuantity": {"value": 126, "unit": "mg/dL", "code": "mg/dL"}
+    }},
+    {"resource": {
+      "resourceType": "Observation", "id": "wt1", "status": "final",
+      "code": {"coding": [{"system": "http://loinc.org", "code": "29463-7"}]},
+      "effectivePeriod": {"start": "2024-12-17T07:00:00+08:00"},
+      "valueQuantity": {"value": 154, "unit": "lb", "code": "[lb_av]"}
+    }},
+    {"resource": {
+      "resourceType": "Observation", "id": "x1", "status": "final",
+      "code": {"coding": [{"system": "http://loinc.org", "code": "2093-3"}], "text": "Cholesterol"},
+      "effectiveDateTime": "2024-12-18T07:00:00+08:00",
+      "valueQuantity": {"value": 5.2, "unit": "mmol/L"}
+    }}
+  ]
+}`
+	rows, err := parseFHIR([]byte(bundle), "p1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 observations, got %d", len(rows))
+	}
+
+	bp := rows[0]
+	if bp.Err != nil || bp.Ref != "bp1" || bp.Reading.Type != "blood_pressure" || bp.Reading.Values["systolic"] != 138 || bp.Reading.Values["diastolic"] != 88 {
+		t.Errorf("unexpected blood pressure row: %+v", bp)
+	}
+	if bp.Reading.MeasuredAt.UTC().Hour() != 0 {
+		t.Errorf("expected timezone to be preserved, got %s", bp.Reading.MeasuredAt)
+	}
+	if glucose := rows[1]; glucose.Err != nil || glucose.Reading.Context != "空腹" || glucose.Reading.Values["value"] != 7 {
+		t.Errorf("expected 126 mg/dL fasting glucose to convert to 7.0 mmol/L, got %+v", glucose)
+	}
+	if weight := rows[2]; weight.Err != nil || weight.Reading.Values["value"] != 69.9 {
+		t.Errorf("expected 154 lb to convert to 69.9 kg, got %+v", weight)
+	}
+	if rows[3].Err == nil {
+		t.Error("expected unsupported LOINC code to be reported")
+	}
+
+	if _, err := parseFHIR([]byte(`{"resourceType": "Patient"}`), "p1"); err == nil {
+		t.Error("expected non-Observation resource to be rejected")
+	}
+}
+
+func TestParseFHIRPairsBloodPressureComponents(t *testing.T) {
+	bundle := `{
+  "resourceType": "Bundle",
+  "entry": [
+    {"resource": {"resourceType": "Observation", "id": "sys1", "status": "final",
+      "subject": {"reference": "Patient/p1"},
+      "code": {"coding": [{"system": "http://loinc.org", "code": "8480-6"}]},
+      "effectiveDateTime": "2024-12-18T08:00:00+08:00",
+      "valueQuantity": {"value": 142, "unit": "mmHg", "code": "mm[Hg]"}}},
+    {"resource": {"resourceType": "Observation", "id": "hr1", "status": "final",
+      "code": {"coding": [{"system": "http://loinc.org", "code": "8867-4"}]},
+      "effectiveDateTime": "2024-12-18T08:00:00+08:00",
+      "valueQuantity": {"value": 72, "unit": "/min"}}},
+    {"resource": {"resourceType": "Observation", "id": "dia1", "status": "final",
+      "subject": {"reference": "Patient/p1"},
+      "code": {"coding": [{"system": "http://loinc.org", "code": "8462-4"}]},
+      "effectiveDateTime": "2024-12-18T00:00:00Z",
+      "valueQuantity": {"value": 91, "unit": "mmHg", "code": "mm[Hg]"}}},
+    {"resource": {"resourceType": "Observation", "id": "sys2", "status": "final",
+      "subject": {"reference": "Patient/p1"},
+      "code": {"coding": [{"system": "http://loinc.org", "code": "8480-6"}]},
+      "effectiveDateTime": "2024-12-19T08:00:00+08:00",
+      "valueQuantity": {"value": 135, "unit": "mmHg", "code": "mm[Hg]"}}}
+  ]
+}`
+	rows, err := parseFHIR([]byte(bundle), "p1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("expected paired blood pressure, heart rate and unpaired systolic rows, got %+v", rows)
+	}
+	if bp := rows[0]; bp.Err != nil || bp.Ref != "sys1+dia1" || bp.Reading.Values["systolic"] != 142 || bp.Reading.Values["diastolic"] != 91 {
+		t.Errorf("expected systolic and diastolic observations to be paired, got %+v", bp)
+	}
+	if rows[1].Err != nil || rows[1].Reading.Type != "heart_rate" {
+		t.Errorf("unexpected heart rate row: %+v", rows[1])
+	}
+	if unpaired := rows[2]; unpaired.Err == nil || unpaired.Ref != "sys2" || unpaired.Reading.Type != "blood_pressure" {
+		t.Errorf("expected unpaired systolic observation to be reported invalid, got %+v", unpaired)
+	}
+}
+
+func TestParseFHIRRejectsOtherPatients(t *testing.T) {
+	bundle := `{
+  "resourceType": "Bundle",
+  "entry": [
+    {"fullUrl": "urn:uuid:a1", "resource": {"resourceType": "Patient", "id": "p1"}},
+    {"fullUrl": "urn:uuid:b2", "resource": {"resourceType": "Patient", "id": "p2"}},
+    {"resource": {"resourceType": "Observation", "id": "own", "status": "final",
+      "subject": {"reference": "Patient/p1"},
+      "code": {"coding": [{"system": "http://loinc.org", "code": "8867-4"}]},
+      "effectiveDateTime": "2024-12-18T08:00:00+08:00",
+      "valueQuantity": {"value": 72, "unit": "/min"}}},
+    {"resource": {"resourceType": "Observation", "id": "other", "status": "final",
+      "subject": {"reference": "https://fhir.example.com/Patient/p2"},
+      "code": {"coding": [{"system": "http://loinc.org", "code": "8867-4"}]},
+      "effectiveDateTime": "2024-12-18T08:00:00+08:00",
+      "valueQuantity": {"value": 95, "unit": "/min"}}},
+    {"resource": {"resourceType": "Observation", "id": "bundled", "status": "final",
+      "subject": {"reference": "urn:uuid:a1"},
+      "code": {"coding": [{"system": "http://loinc.org", "code": "29463-7"}]},
+      "effectiveDateTime": "2024-12-18T08:00:00+08:00",
+      "valueQuantity": {"value": 65, "unit": "kg"}}},
+    {"resource": {"resourceType": "Observation", "id": "bundled-other", "status": "final",
+      "subject": {"reference": "urn:uuid:b2"},
+      "code": {"coding": [{"system": "http://loinc.org", "code": "29463-7"}]},
+      "effectiveDateTime": "2024-12-18T08:00:00+08:00",
+      "valueQuantity": {"value": 80, "unit": "kg"}}},
+    {"resource": {"resourceType": "Observation", "id": "unattributed", "status": "final",
+      "code": {"coding": [{"system": "http://loinc.org", "code": "8310-5"}]},
+      "effectiveDateTime": "2024-12-18T08:00:00+08:00",
+      "valueQuantity": {"value": 36.6, "unit": "Cel"}}}
+  ]
+}`
+	rows, err := parseFHIR([]byte(bundle), "p1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	valid := map[string]bool{"own": true, "bundled": true, "unattributed": true}
+	if len(rows) != 5 {
+		t.Fatalf("expected 5 rows, got %+v", rows)
+	}
+	for _, row := range rows {
+		if valid[row.Ref] && row.Err != nil {
+			t.Errorf("observation %s belongs to the patient, got %v", row.Ref, row.Err)
+		}
+		if !valid[row.Ref] && row.Err == nil {
+			t.Errorf("observation %s belongs to another patient and should be invalid", row.Ref)
+		}
+	}
+}
+
+func TestParseOpenMHealth(t *testing.T) {
+	points := `[
+  {
+    "header": {"id": "omh-1", "schema_id": {"namespace": "omh", "name": "blood-glucose", "version": "3.0"},
+      "acquisition_provenance": {"source_name": "Accu-Chek"}},
+    "body": {
+      "blood_glucose": {"unit": "mmol/L", "value": 8.34},
+      "temporal_relationship_to_meal": "2 hours postprandial",
+      "effective_time_frame": {"date_time": "2024-12-18T12:30:00+08:00"}
+    }
+  },
+  {
+    "body": {
+      "heart_rate": {"unit": "beats/min", "value": 71.6},
+      "effective_time_frame": {"time_interval": {"start_date_time": "2024-12-18T07:00:00+08:00", "end_date_time": "2024-12-18T07:01:00+08:00"}}
+    }
+  },
+  {
+    "header": {"id": "omh-3", "schema_id": {"name": "body-temperature"}},
+    "body": {"body_temperature": {"unit": "K", "value": 310}, "effective_time_frame": {"date_time": "2024-12-18T07:00:00+08:00"}}
+  },
+  {
+    "header": {"id": "omh-4", "schema_id": {"name": "blood-pressure"}},
+    "body": {"systolic_blood_pressure": {"unit": "mmHg", "value": 120}}
+  }
+]`
+	rows, err := parseOpenMHealth([]byte(points))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rows) != 4 {
+		t.Fatalf("expected 4 rows, got %d", len(rows))
+	}
+	if glucose := rows[0]; glucose.Err != nil || glucose.Reading.Type != "blood_sugar" || glucose.Reading.Context != "餐后" ||
+		glucose.Reading.Values["value"] != 8.3 || glucose.Reading.Notes != "Open mHealth导入，来源：Accu-Chek" {
+		t.Errorf("unexpected glucose row: %+v", glucose)
+	}
+	if heart := rows[1]; heart.Err != nil || heart.Ref != "#1" || heart.Reading.Type != "heart_rate" || heart.Reading.Values["value"] != 72 ||
+		heart.Reading.MeasuredAt.Minute() != 1 {
+		t.Errorf("expected header-less heart rate rounded and timed at interval end, got %+v", heart)
+	}
+	if rows[2].Err == nil {
+		t.Error("expected unsupported unit to be reported")
+	}
+	if rows[3].Err == nil {
+		t.Error("expected missing time frame to be reported")
+	}
+}
+
+func TestImportUnitConversionsCoverDefaultTypes(t *testing.T) {
+	for _, definition := range config.DefaultVitalSignTypes {
+		if _, ok := importUnitConversions[definition.Unit]; !ok {
+			t.Errorf("no import unit conversions for %s (%s)", definition.Type, definition.Unit)
+		}
+	}
+	if value, err := convertImportUnit(importQuantity{Value: 98.6, Unit: "[degF]"}, "℃"); err != nil || roundTo(value, 1) != 37 {
+		t.Errorf("expected 98.6 °F to be 37 ℃, got %v: %v", value, err)
+	}
+	if detectImportFormat([]byte(`{"resourceType": "Bundle"}`)) != ImportFormatFHIR || detectImportFormat([]byte(`[{"body": {}}]`)) != ImportFormatOpenMHealth {
+		t.Error("unexpected format detection")
+	}
+}
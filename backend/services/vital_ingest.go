@@ -0,0 +1,171 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+)
+
+const (
+	// 幂等键最大长度
+	maxIdempotencyKeyLength = 128
+	// 设备时钟允许比服务器快的时间，超出视为测量时间无效
+	readingClockSkew = 5 * time.Minute
+)
+
+// 批量保存读数时单条读数的处理结果
+const (
+	IngestCreated   = "created"   // 已保存
+	IngestDuplicate = "duplicate" // 已保存过（幂等键相同或时间、类型、数值相同），未重复保存
+	IngestInvalid   = "invalid"   // 数据无效
+)
+
+// IngestReading 批量上传或导入的一条读数，数值优先使用 values，为空时解析 value 文本（如 138/88）
+type IngestReading struct {
+	IdempotencyKey string             `json:"idempotencyKey"` // 设备生成的唯一键，重发时保持不变
+	Type           string             `json:"type"`
+	Values         map[string]float64 `json:"values"`
+	Value          string             `json:"value"`
+	Context        string             `json:"context"`
+	MeasuredAt     time.Time          `json:"measuredAt"`
+	Notes          string             `json:"notes"`
+}
+
+// IngestResult 单条读数的处理结果，按上传顺序返回
+type IngestResult struct {
+	Index          int    `json:"index"`
+	Ref            string `json:"ref,omitempty"` // 导入文件中的记录标识（如 FHIR Observation ID）
+	IdempotencyKey string `json:"idempotencyKey,omitempty"`
+	Type           string `json:"type,omitempty"`
+	Status         string `json:"status"`           // created/duplicate/invalid
+	DataID         string `json:"dataId,omitempty"` // 保存或已存在的生理数据ID
+	Error          string `json:"error,omitempty"`  // 数据无效的原因
+}
+
+// readingSource 一批读数共同的归属和来源
+type readingSource struct {
+	PatientID  string
+	Source     string
+	DeviceID   string // 设备上传时的设备ID，幂等键在设备内唯一
+	DeviceInfo string
+}
+
+// readingIngester 逐条校验、查重并保存一批读数，记录本批次已使用的幂等键
+type readingIngester struct {
+	source    readingSource
+	now       time.Time
+	batchKeys map[string]string
+}
+
+func newReadingIngester(source readingSource, now time.Time) *readingIngester {
+	return &readingIngester{source: source, now: now, batchKeys: map[string]string{}}
+}
+
+// ingest 保存一条读数：无效的读数返回原因，已保存过的读数返回已有数据的ID；
+// 只有数据库错误时返回 error，调用方可整批重试
+func (in *readingIngester) ingest(index int, reading IngestReading) (IngestResult, error) {
+	result := IngestResult{Index: index, IdempotencyKey: reading.IdempotencyKey, Type: reading.Type, Status: IngestInvalid}
+	data, err := in.readingData(reading)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+
+	existing, err := in.findDuplicate(data)
+	if err != nil {
+		return result, err
+	}
+	if existing != "" {
+		result.Status = IngestDuplicate
+		result.DataID = existing
+		return result, nil
+	}
+
+	if err := RecordPhysiologicalData(data); err != nil {
+		// 同一批数据并发重发时，另一个请求可能已经保存了相同幂等键的数据
+		if data.IdempotencyKey != "" {
+			if saved, lookupErr := storage.GetPhysiologicalDataStorage().GetByIdempotencyKey(in.source.DeviceID, data.IdempotencyKey); lookupErr == nil && saved != nil {
+				result.Status = IngestDuplicate
+				result.DataID = saved.ID
+				return result, nil
+			}
+		}
+		return result, err
+	}
+	if data.IdempotencyKey != "" {
+		in.batchKeys[data.IdempotencyKey] = data.ID
+	}
+	result.Status = IngestCreated
+	result.DataID = data.ID
+	return result, nil
+}
+
+// readingData 校验一条读数并转换为待保存的已确认生理数据
+func (in *readingIngester) readingData(reading IngestReading) (*models.PhysiologicalData, error) {
+	if len(reading.IdempotencyKey) > maxIdempotencyKeyLength {
+		return nil, fmt.Errorf("幂等键不能超过%d个字符", maxIdempotencyKeyLength)
+	}
+	if _, ok := VitalSignTypeByName(reading.Type); !ok {
+		return nil, fmt.Errorf("不支持的数据类型: %s", reading.Type)
+	}
+	if reading.MeasuredAt.IsZero() {
+		return nil, fmt.Errorf("缺少测量时间")
+	}
+	if reading.MeasuredAt.After(in.now.Add(readingClockSkew)) {
+		return nil, fmt.Errorf("测量时间晚于当前时间")
+	}
+
+	data := &models.PhysiologicalData{
+		BaseModel: models.BaseModel{
+			ID:        utils.GenerateID(),
+			CreatedAt: in.now,
+			UpdatedAt: in.now,
+		},
+		PatientID:  in.source.PatientID,
+		Type:       reading.Type,
+		Value:      reading.Value,
+		Components: reading.Values,
+		Context:    reading.Context,
+		MeasuredAt: reading.MeasuredAt,
+		Notes:      reading.Notes,
+		Source:     in.source.Source,
+		DeviceInfo: in.source.DeviceInfo,
+		Status:     models.PhysiologicalStatusConfirmed,
+		DeviceID:   in.source.DeviceID,
+	}
+	// 幂等键只在设备内唯一
+	if in.source.DeviceID != "" {
+		data.IdempotencyKey = reading.IdempotencyKey
+	}
+	if err := NormalizePhysiologicalData(data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// findDuplicate 依次按本批次的幂等键、已保存数据的幂等键、相同时间类型和数值查重，返回已有数据的ID
+func (in *readingIngester) findDuplicate(data *models.PhysiologicalData) (string, error) {
+	store := storage.GetPhysiologicalDataStorage()
+	if data.IdempotencyKey != "" {
+		if id, ok := in.batchKeys[data.IdempotencyKey]; ok {
+			return id, nil
+		}
+		existing, err := store.GetByIdempotencyKey(in.source.DeviceID, data.IdempotencyKey)
+		if err != nil || existing != nil {
+			return dataID(existing), err
+		}
+	}
+	// 设备换了幂等键重发、重复导入同一文件，或患者同时手动录入了同一次测量
+	existing, err := store.FindDuplicate(data)
+	return dataID(existing), err
+}
+
+func dataID(data *models.PhysiologicalData) string {
+	if data == nil {
+		return ""
+	}
+	return data.ID
+}
@@ -0,0 +1,192 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"we-dear/config"
+	"we-dear/storage"
+)
+
+// 一次查询最多返回的时间段数量，避免按小时查询多年数据
+const maxSeriesBuckets = 2000
+
+// ErrInvalidSeriesQuery 时间序列查询条件无效
+var ErrInvalidSeriesQuery = errors.New("无效的查询条件")
+
+// 各聚合粒度的近似时长，用于限制时间段数量
+var seriesBucketDurations = map[string]time.Duration{
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+	"week":  7 * 24 * time.Hour,
+	"month": 28 * 24 * time.Hour,
+}
+
+// SeriesStats 一个数值分量的统计；没有目标范围时达标率为空
+type SeriesStats struct {
+	Count   int64    `json:"count"`
+	Min     float64  `json:"min"`
+	Max     float64  `json:"max"`
+	Mean    float64  `json:"mean"`
+	InRange *float64 `json:"inRange,omitempty"` // 在目标范围内的读数百分比
+	Below   *float64 `json:"below,omitempty"`   // 低于目标范围的百分比
+	Above   *float64 `json:"above,omitempty"`   // 高于目标范围的百分比
+
+	belowCount int64
+	aboveCount int64
+}
+
+// add 合并另一组统计，均值按数量加权
+func (s *SeriesStats) add(other SeriesStats) {
+	if other.Count == 0 {
+		return
+	}
+	if s.Count == 0 || other.Min < s.Min {
+		s.Min = other.Min
+	}
+	if s.Count == 0 || other.Max > s.Max {
+		s.Max = other.Max
+	}
+	s.Mean = (s.Mean*float64(s.Count) + other.Mean*float64(other.Count)) / float64(s.Count+other.Count)
+	s.Count += other.Count
+	s.belowCount += other.belowCount
+	s.aboveCount += other.aboveCount
+}
+
+// finish 有目标范围时计算达标率
+func (s *SeriesStats) finish(hasTarget bool) {
+	if !hasTarget || s.Count == 0 {
+		return
+	}
+	percent := func(n int64) *float64 {
+		value := float64(n) * 100 / float64(s.Count)
+		return &value
+	}
+	s.Below = percent(s.belowCount)
+	s.Above = percent(s.aboveCount)
+	s.InRange = percent(s.Count - s.belowCount - s.aboveCount)
+}
+
+// SeriesField 序列中的一个数值分量
+type SeriesField struct {
+	Name         string             `json:"name"`
+	Label        string             `json:"label"`
+	Target       *config.VitalRange `json:"target,omitempty"` // 统计达标率使用的目标范围
+	TargetSource string             `json:"targetSource"`     // 目标范围来源（patient/protocol/default）
+}
+
+// SeriesPoint 一个时间段的统计
+type SeriesPoint struct {
+	Bucket time.Time              `json:"bucket"` // 时间段起点
+	Fields map[string]SeriesStats `json:"fields"`
+}
+
+// VitalSeries 患者某类生理数据的时间序列
+type VitalSeries struct {
+	Type    string                 `json:"type"`
+	Unit    string                 `json:"unit"`
+	Context string                 `json:"context,omitempty"`
+	Bucket  string                 `json:"bucket"`
+	From    time.Time              `json:"from"`
+	To      time.Time              `json:"to"`
+	Fields  []SeriesField          `json:"fields"`
+	Points  []SeriesPoint          `json:"points"`
+	Summary map[string]SeriesStats `json:"summary"` // 整个时间范围的统计
+}
+
+// SeriesQuery 时间序列查询条件
+type SeriesQuery struct {
+	PatientID string
+	Type      string
+	Context   string
+	From      time.Time
+	To        time.Time
+	Bucket    string
+}
+
+// GetVitalSeries 按时间段聚合患者已确认的生理数据，达标率按患者生效的目标范围统计
+func GetVitalSeries(query SeriesQuery) (*VitalSeries, error) {
+	definition, ok := VitalSignTypeByName(query.Type)
+	if !ok {
+		return nil, fmt.Errorf("%w: 不支持的数据类型 %s", ErrInvalidSeriesQuery, query.Type)
+	}
+	duration, ok := seriesBucketDurations[query.Bucket]
+	if !ok {
+		return nil, fmt.Errorf("%w: 不支持的聚合粒度 %s", ErrInvalidSeriesQuery, query.Bucket)
+	}
+	if query.Context != "" {
+		valid := false
+		for _, context := range definition.Contexts {
+			valid = valid || context == query.Context
+		}
+		if !valid {
+			return nil, fmt.Errorf("%w: %s没有测量场景 %s", ErrInvalidSeriesQuery, definition.Name, query.Context)
+		}
+	}
+	if !query.From.Before(query.To) {
+		return nil, fmt.Errorf("%w: 开始时间必须早于结束时间", ErrInvalidSeriesQuery)
+	}
+	if query.To.Sub(query.From)/duration > maxSeriesBuckets {
+		return nil, fmt.Errorf("%w: 时间范围过长，按%s聚合最多%d个时间段", ErrInvalidSeriesQuery, query.Bucket, maxSeriesBuckets)
+	}
+
+	series := &VitalSeries{
+		Type:    definition.Type,
+		Unit:    definition.Unit,
+		Context: query.Context,
+		Bucket:  query.Bucket,
+		From:    query.From,
+		To:      query.To,
+		Points:  []SeriesPoint{},
+		Summary: map[string]SeriesStats{},
+	}
+	filter := storage.SeriesFilter{
+		PatientID: query.PatientID,
+		Type:      query.Type,
+		Context:   query.Context,
+		From:      query.From,
+		To:        query.To,
+		Bucket:    query.Bucket,
+	}
+	patient, err := storage.GetPatientStorage().GetPatientByID(query.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := storage.GetVitalAlertStorage().ListTargets(patient.ID)
+	if err != nil {
+		return nil, err
+	}
+	hasTarget := map[string]bool{}
+	for _, field := range definition.Fields {
+		target := resolveVitalTarget(patient, overrides, config.DefaultVitalTargetProtocols, definition, field, query.Context)
+		series.Fields = append(series.Fields, SeriesField{Name: field.Name, Label: field.Label, Target: target.Target, TargetSource: target.Source})
+		if target.Target != nil {
+			hasTarget[field.Name] = true
+			filter.Targets = append(filter.Targets, storage.SeriesTarget{Field: field.Name, Low: target.Target.Low, High: target.Target.High})
+		}
+	}
+
+	rows, err := storage.GetPhysiologicalDataStorage().Series(filter)
+	if err != nil {
+		return nil, fmt.Errorf("统计生理数据失败: %w", err)
+	}
+
+	for _, row := range rows {
+		stats := SeriesStats{Count: row.Count, Min: row.Min, Max: row.Max, Mean: row.Mean, belowCount: row.Below, aboveCount: row.Above}
+		if n := len(series.Points); n == 0 || !series.Points[n-1].Bucket.Equal(row.Bucket) {
+			series.Points = append(series.Points, SeriesPoint{Bucket: row.Bucket, Fields: map[string]SeriesStats{}})
+		}
+		total := series.Summary[row.Field]
+		total.add(stats)
+		series.Summary[row.Field] = total
+
+		stats.finish(hasTarget[row.Field])
+		series.Points[len(series.Points)-1].Fields[row.Field] = stats
+	}
+	for name, total := range series.Summary {
+		total.finish(hasTarget[name])
+		series.Summary[name] = total
+	}
+	return series, nil
+}
@@ -0,0 +1,23 @@
+package services
+
+import "testing"
+
+func TestSeriesStatsMerge(t *testing.T) {
+	var total SeriesStats
+	total.add(SeriesStats{Count: 3, Min: 120, Max: 150, Mean: 130, aboveCount: 1})
+	total.add(SeriesStats{Count: 1, Min: 85, Max: 85, Mean: 85, belowCount: 1})
+	total.finish(true)
+
+	if total.Count != 4 || total.Min != 85 || total.Max != 150 || total.Mean != 118.75 {
+		t.Errorf("unexpected merged stats: %+v", total)
+	}
+	if total.InRange == nil || *total.InRange != 50 || *total.Below != 25 || *total.Above != 25 {
+		t.Errorf("unexpected time in range: %v %v %v", total.InRange, total.Below, total.Above)
+	}
+
+	untargeted := SeriesStats{Count: 2, Mean: 8000}
+	untargeted.finish(false)
+	if untargeted.InRange != nil {
+		t.Error("expected no time in range without a target")
+	}
+}
@@ -0,0 +1,350 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/storage"
+)
+
+// 模型返回的测量时间格式
+const vitalTimeLayout = "2006-01-02 15:04:05"
+
+var (
+	vitalSignTypesOnce sync.Once
+	vitalSignTypes     []config.VitalSignType
+)
+
+// VitalSignTypes 返回当前可提取的测量类型：配置了 AI_VITAL_SIGN_TABLE 时从文件加载，加载失败时使用内置类型
+func VitalSignTypes() []config.VitalSignType {
+	vitalSignTypesOnce.Do(func() {
+		vitalSignTypes = config.DefaultVitalSignTypes
+		path := config.GlobalConfig.AI.VitalSignTable
+		if path == "" {
+			return
+		}
+		types, err := LoadVitalSignTypes(path)
+		if err != nil {
+			log.Printf("加载测量类型定义失败，使用内置类型: %v", err)
+			return
+		}
+		vitalSignTypes = types
+	})
+	return vitalSignTypes
+}
+
+// LoadVitalSignTypes 从JSON文件加载测量类型定义，格式与 config.VitalSignType 相同
+func LoadVitalSignTypes(path string) ([]config.VitalSignType, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var types []config.VitalSignType
+	if err := json.Unmarshal(data, &types); err != nil {
+		return nil, fmt.Errorf("解析测量类型定义失败: %w", err)
+	}
+	seen := map[string]bool{}
+	for _, item := range types {
+		if item.Type == "" || len(item.Fields) == 0 {
+			return nil, fmt.Errorf("测量类型 %q 缺少类型名称或数值字段", item.Name)
+		}
+		if seen[item.Type] {
+			return nil, fmt.Errorf("测量类型 %s 重复定义", item.Type)
+		}
+		seen[item.Type] = true
+		for _, field := range item.Fields {
+			if field.Name == "" || field.Min > field.Max {
+				return nil, fmt.Errorf("测量类型 %s 的字段 %q 定义无效", item.Type, field.Name)
+			}
+		}
+	}
+	return types, nil
+}
+
+// findVitalSignType 按类型名称查找测量类型定义
+func findVitalSignType(types []config.VitalSignType, name string) (config.VitalSignType, bool) {
+	for _, item := range types {
+		if item.Type == name {
+			return item, true
+		}
+	}
+	return config.VitalSignType{}, false
+}
+
+// VitalSignTypeByName 在当前使用的测量类型中按名称查找
+func VitalSignTypeByName(name string) (config.VitalSignType, bool) {
+	return findVitalSignType(VitalSignTypes(), name)
+}
+
+// vitalSignSchema 根据测量类型生成提取结果的 JSON Schema
+func vitalSignSchema(types []config.VitalSignType) string {
+	names := make([]string, 0, len(types))
+	for _, item := range types {
+		names = append(names, item.Type)
+	}
+	schema, _ := json.MarshalIndent(map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"readings": map[string]interface{}{
+				"type": "array",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"type":       map[string]interface{}{"type": "string", "enum": names},
+						"values":     map[string]interface{}{"type": "object", "additionalProperties": map[string]interface{}{"type": "number"}},
+						"context":    map[string]interface{}{"type": "string"},
+						"measuredAt": map[string]interface{}{"type": "string"},
+					},
+					"required": []string{"type", "values"},
+				},
+			},
+		},
+		"required": []string{"readings"},
+	}, "", "  ")
+	return string(schema)
+}
+
+// describeVitalSignTypes 生成提示中每种测量类型的说明
+func describeVitalSignTypes(types []config.VitalSignType) string {
+	lines := make([]string, 0, len(types))
+	for _, item := range types {
+		fields := make([]string, 0, len(item.Fields))
+		for _, field := range item.Fields {
+			kind := "数值"
+			if field.Integer {
+				kind = "整数"
+			}
+			fields = append(fields, fmt.Sprintf("%s（%s，%s）", field.Name, field.Label, kind))
+		}
+		line := fmt.Sprintf("- %s：%s，单位%s，values 包含 %s", item.Type, item.Name, item.Unit, strings.Join(fields, "、"))
+		if len(item.Contexts) > 0 {
+			line += fmt.Sprintf("；context 为测量场景，可选 %s", strings.Join(item.Contexts, "/"))
+		}
+		if item.Hint != "" {
+			line += "；" + item.Hint
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// vitalExtractionPrompt 生成生理数据提取的系统提示
+func vitalExtractionPrompt(types []config.VitalSignType, now time.Time) string {
+	return fmt.Sprintf(config.VitalExtractionPrompt, describeVitalSignTypes(types), vitalSignSchema(types), now.Format(vitalTimeLayout))
+}
+
+// VitalReading 从消息中提取并校验过的一条读数
+type VitalReading struct {
+	Type       string             `json:"type"`
+	Values     map[string]float64 `json:"values"`
+	Context    string             `json:"context,omitempty"`
+	MeasuredAt time.Time          `json:"measuredAt"`
+}
+
+// rawVitalReading 模型返回的读数
+type rawVitalReading struct {
+	Type       string             `json:"type"`
+	Values     map[string]float64 `json:"values"`
+	Context    string             `json:"context"`
+	MeasuredAt string             `json:"measuredAt"`
+}
+
+// parseVitalReadings 解析模型返回的提取结果，逐条校验类型、字段和合理范围；
+// 不合格的读数不返回，原因放在 rejected 中。测量时间缺失、无法解析或晚于当前时间的使用当前时间
+func parseVitalReadings(content string, types []config.VitalSignType, now time.Time) (readings []VitalReading, rejected []string, err error) {
+	var result struct {
+		Readings []rawVitalReading `json:"readings"`
+	}
+	if err := json.Unmarshal([]byte(stripJSONFence(content)), &result); err != nil {
+		return nil, nil, fmt.Errorf("解析AI响应失败: %w", err)
+	}
+
+	seen := map[string]bool{}
+	for _, raw := range result.Readings {
+		reading, err := validateVitalReading(raw, types, now)
+		if err != nil {
+			rejected = append(rejected, err.Error())
+			continue
+		}
+		definition, _ := findVitalSignType(types, reading.Type)
+		key := reading.Type + "|" + FormatVitalValue(definition, reading) + "|" + reading.MeasuredAt.Format(vitalTimeLayout)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		readings = append(readings, reading)
+	}
+	return readings, rejected, nil
+}
+
+// validateVitalReading 校验一条读数，整数字段四舍五入，测量场景不在可选值中时使用默认值
+func validateVitalReading(raw rawVitalReading, types []config.VitalSignType, now time.Time) (VitalReading, error) {
+	definition, ok := findVitalSignType(types, raw.Type)
+	if !ok {
+		return VitalReading{}, fmt.Errorf("未知的测量类型 %q", raw.Type)
+	}
+
+	reading := VitalReading{Type: definition.Type, Values: map[string]float64{}}
+	for _, field := range definition.Fields {
+		value, ok := raw.Values[field.Name]
+		if !ok {
+			return VitalReading{}, fmt.Errorf("%s缺少%s", definition.Name, field.Label)
+		}
+		if field.Integer {
+			value = math.Round(value)
+		}
+		if value < field.Min || value > field.Max {
+			return VitalReading{}, fmt.Errorf("%s%s %g 超出合理范围 %g-%g", definition.Name, field.Label, value, field.Min, field.Max)
+		}
+		reading.Values[field.Name] = value
+	}
+
+	if len(definition.Contexts) > 0 {
+		reading.Context = definition.Contexts[0]
+		for _, context := range definition.Contexts {
+			if raw.Context == context {
+				reading.Context = context
+				break
+			}
+		}
+	}
+
+	reading.MeasuredAt = now
+	if measuredAt, err := time.ParseInLocation(vitalTimeLayout, raw.MeasuredAt, now.Location()); err == nil && !measuredAt.After(now) {
+		reading.MeasuredAt = measuredAt
+	}
+	return reading, nil
+}
+
+// FormatVitalValue 将读数格式化为保存的数据值：多个字段用 / 连接，有测量场景时以 - 追加（如 138/88、7.2-空腹）
+func FormatVitalValue(definition config.VitalSignType, reading VitalReading) string {
+	parts := make([]string, 0, len(definition.Fields))
+	for _, field := range definition.Fields {
+		decimals := field.Decimals
+		if field.Integer {
+			decimals = 0
+		}
+		parts = append(parts, strconv.FormatFloat(reading.Values[field.Name], 'f', decimals, 64))
+	}
+	value := strings.Join(parts, "/")
+	if reading.Context != "" {
+		value += "-" + reading.Context
+	}
+	return value
+}
+
+// ParseVitalValue 解析 FormatVitalValue 格式的数据值并校验合理范围，用于医生修正AI提取的数据和解析旧格式数据
+func ParseVitalValue(definition config.VitalSignType, value string) (VitalReading, error) {
+	reading := VitalReading{Type: definition.Type, Values: map[string]float64{}}
+	numbers := strings.TrimSpace(value)
+	if len(definition.Contexts) > 0 {
+		if index := strings.Index(numbers, "-"); index >= 0 {
+			reading.Context = numbers[index+1:]
+			numbers = numbers[:index]
+		}
+	}
+
+	// 兼容旧数据中带单位的写法，如 65kg、6.5 mmol/L
+	numbers = strings.TrimSpace(strings.TrimSuffix(numbers, definition.Unit))
+
+	parts := strings.Split(numbers, "/")
+	if len(parts) != len(definition.Fields) {
+		return VitalReading{}, fmt.Errorf("%s数据格式错误，应包含%d个数值", definition.Name, len(definition.Fields))
+	}
+	raw := rawVitalReading{Type: definition.Type, Values: map[string]float64{}, Context: reading.Context}
+	for i, field := range definition.Fields {
+		number, err := strconv.ParseFloat(strings.TrimSpace(parts[i]), 64)
+		if err != nil {
+			return VitalReading{}, fmt.Errorf("%s不是有效的数值: %s", field.Label, parts[i])
+		}
+		raw.Values[field.Name] = number
+	}
+	if reading.Context != "" {
+		valid := false
+		for _, context := range definition.Contexts {
+			valid = valid || context == reading.Context
+		}
+		if !valid {
+			return VitalReading{}, fmt.Errorf("无效的测量场景 %s，可选 %s", reading.Context, strings.Join(definition.Contexts, "/"))
+		}
+	}
+	return validateVitalReading(raw, []config.VitalSignType{definition}, time.Now())
+}
+
+// applyVitalReading 用读数填充生理数据的数值分量、单位、测量场景和文本形式的数据值
+func applyVitalReading(data *models.PhysiologicalData, definition config.VitalSignType, reading VitalReading) {
+	data.Components = models.VitalComponents(reading.Values)
+	data.Unit = definition.Unit
+	data.Context = reading.Context
+	data.Value = FormatVitalValue(definition, reading)
+}
+
+// NormalizePhysiologicalData 按测量类型校验并补全生理数据：有数值分量时校验分量并生成数据值，
+// 只有数据值（旧接口）时从数据值解析出数值分量。类型不在测量类型定义中的数据原样保存
+func NormalizePhysiologicalData(data *models.PhysiologicalData) error {
+	definition, ok := VitalSignTypeByName(data.Type)
+	if !ok {
+		return nil
+	}
+
+	var reading VitalReading
+	var err error
+	if len(data.Components) > 0 {
+		reading, err = validateVitalReading(rawVitalReading{
+			Type:    data.Type,
+			Values:  data.Components,
+			Context: data.Context,
+		}, []config.VitalSignType{definition}, time.Now())
+		if err == nil && data.Context != "" && reading.Context != data.Context {
+			err = fmt.Errorf("无效的测量场景 %s，可选 %s", data.Context, strings.Join(definition.Contexts, "/"))
+		}
+	} else {
+		reading, err = ParseVitalValue(definition, data.Value)
+	}
+	if err != nil {
+		return err
+	}
+	applyVitalReading(data, definition, reading)
+	return nil
+}
+
+// MigratePhysiologicalComponents 将旧数据的文本数据值解析为数值分量，原来的数据值保持不变；
+// 已解析过的记录跳过，无法解析的记录计入 failed 并记录原因，之后不再重试
+func MigratePhysiologicalComponents() (migrated int, failed int, err error) {
+	types := VitalSignTypes()
+	names := make([]string, 0, len(types))
+	for _, item := range types {
+		names = append(names, item.Type)
+	}
+
+	dataStorage := storage.GetPhysiologicalDataStorage()
+	err = dataStorage.EachWithoutComponents(names, 200, func(records []models.PhysiologicalData) error {
+		for i := range records {
+			record := &records[i]
+			value := record.Value
+			if err := NormalizePhysiologicalData(record); err != nil {
+				log.Printf("无法解析生理数据 (ID: %s, 类型: %s, 数据值: %q): %v", record.ID, record.Type, value, err)
+				if err := dataStorage.MarkComponentsError(record.ID, err.Error()); err != nil {
+					return err
+				}
+				failed++
+				continue
+			}
+			if err := dataStorage.UpdateComponents(record); err != nil {
+				return err
+			}
+			migrated++
+		}
+		return nil
+	})
+	return migrated, failed, err
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+)
+
+func TestParseVitalReadings(t *testing.T) {
+	types := config.DefaultVitalSignTypes
+	now := time.Date(2024, 12, 18, 9, 0, 0, 0, time.Local)
+
+	content := `{"readings": [
+		{"type": "blood_pressure", "values": {"systolic": 138, "diastolic": 88}, "measuredAt": "2024-12-17 08:00:00"},
+		{"type": "blood_pressure", "values": {"systolic": 138, "diastolic": 88}, "measuredAt": "2024-12-17 08:00:00"},
+		{"type": "blood_sugar", "values": {"value": 7.24}, "context": "睡前"},
+		{"type": "heart_rate", "values": {"value": 760}},
+		{"type": "blood_oxygen", "values": {"value": 97}, "measuredAt": "2024-12-19 08:00:00"},
+		{"type": "temperature", "values": {}},
+		{"type": "cholesterol", "values": {"value": 5.2}}
+	]}`
+	readings, rejected, err := parseVitalReadings(content, types, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rejected) != 3 {
+		t.Errorf("expected out-of-range, incomplete and unknown readings to be rejected, got %v", rejected)
+	}
+	if len(readings) != 3 {
+		t.Fatalf("expected 3 readings after dedup, got %+v", readings)
+	}
+
+	if !readings[0].MeasuredAt.Equal(time.Date(2024, 12, 17, 8, 0, 0, 0, time.Local)) {
+		t.Errorf("expected measuredAt from the reply, got %v", readings[0].MeasuredAt)
+	}
+	sugar, _ := findVitalSignType(types, "blood_sugar")
+	if value := FormatVitalValue(sugar, readings[1]); value != "7.2-随机" {
+		t.Errorf("expected unknown context to fall back to default, got %q", value)
+	}
+	if !readings[1].MeasuredAt.Equal(now) || !readings[2].MeasuredAt.Equal(now) {
+		t.Errorf("expected missing or future measuredAt to fall back to now, got %v and %v", readings[1].MeasuredAt, readings[2].MeasuredAt)
+	}
+}
+
+func TestParseVitalValue(t *testing.T) {
+	pressure, _ := findVitalSignType(config.DefaultVitalSignTypes, "blood_pressure")
+	sugar, _ := findVitalSignType(config.DefaultVitalSignTypes, "blood_sugar")
+
+	reading, err := ParseVitalValue(sugar, " 6.8-餐后")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if value := FormatVitalValue(sugar, reading); value != "6.8-餐后" {
+		t.Errorf("unexpected value %q", value)
+	}
+
+	for _, value := range []string{"150", "150/abc", "300/95", "7.2-睡前"} {
+		definition := pressure
+		if value == "7.2-睡前" {
+			definition = sugar
+		}
+		if _, err := ParseVitalValue(definition, value); err == nil {
+			t.Errorf("expected %q to be rejected", value)
+		}
+	}
+}
+
+func TestNormalizePhysiologicalData(t *testing.T) {
+	legacy := &models.PhysiologicalData{Type: "blood_sugar", Value: "6.5-空腹"}
+	if err := NormalizePhysiologicalData(legacy); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if legacy.Components["value"] != 6.5 || legacy.Context != "空腹" || legacy.Unit != "mmol/L" {
+		t.Errorf("legacy value not parsed: %+v", legacy)
+	}
+
+	withUnit := &models.PhysiologicalData{Type: "weight", Value: "65kg"}
+	if err := NormalizePhysiologicalData(withUnit); err != nil || withUnit.Components["value"] != 65 || withUnit.Value != "65.0" {
+		t.Errorf("expected unit suffix to be accepted, got %+v (%v)", withUnit, err)
+	}
+
+	structured := &models.PhysiologicalData{Type: "blood_pressure", Components: models.VitalComponents{"systolic": 128, "diastolic": 82}}
+	if err := NormalizePhysiologicalData(structured); err != nil || structured.Value != "128/82" {
+		t.Errorf("expected value to be generated from components, got %+v (%v)", structured, err)
+	}
+
+	invalid := &models.PhysiologicalData{Type: "blood_pressure", Components: models.VitalComponents{"systolic": 128}}
+	if err := NormalizePhysiologicalData(invalid); err == nil {
+		t.Error("expected missing component to be rejected")
+	}
+
+	unknown := &models.PhysiologicalData{Type: "mood", Value: "不错"}
+	if err := NormalizePhysiologicalData(unknown); err != nil || unknown.Components != nil {
+		t.Errorf("expected unknown type to be kept as is, got %+v (%v)", unknown, err)
+	}
+}
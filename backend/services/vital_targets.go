@@ -0,0 +1,253 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"we-dear/config"
+	"we-dear/models"
+	"we-dear/storage"
+	"we-dear/utils"
+)
+
+// ResolvedTarget 患者某项指标生效的目标范围：医生为患者设置的优先，其次是患者慢性病对应的范围，
+// 最后是测量类型的默认范围
+type ResolvedTarget struct {
+	Type         string             `json:"type"`
+	Context      string             `json:"context,omitempty"`
+	Field        string             `json:"field"`
+	Label        string             `json:"label"`
+	Unit         string             `json:"unit"`
+	Target       *config.VitalRange `json:"target,omitempty"`       // 目标范围，为空表示不评估
+	CriticalLow  *float64           `json:"criticalLow,omitempty"`  // 低于该值为危急
+	CriticalHigh *float64           `json:"criticalHigh,omitempty"` // 高于该值为危急
+	Source       string             `json:"source"`                 // 来源（patient/protocol/default）
+	Disease      string             `json:"disease,omitempty"`      // 来源为 protocol 时对应的慢性病
+	TargetID     string             `json:"targetId,omitempty"`     // 来源为 patient 时的目标范围ID，用于删除
+}
+
+// hasChronicDisease 判断患者慢性病史是否包含某病种（如"2型糖尿病"包含"糖尿病"）
+func hasChronicDisease(patient *models.Patient, disease string) bool {
+	for _, item := range patient.ChronicDiseases {
+		if strings.Contains(item, disease) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveVitalTarget 按优先级确定一个数值字段在某测量场景下的目标范围；
+// 患者设置和慢病范围都先找相同场景的，再找不区分场景的
+func resolveVitalTarget(patient *models.Patient, overrides []models.VitalTarget, protocols []config.VitalTargetProtocol,
+	definition config.VitalSignType, field config.VitalField, context string) ResolvedTarget {
+	resolved := ResolvedTarget{
+		Type:    definition.Type,
+		Context: context,
+		Field:   field.Name,
+		Label:   field.Label,
+		Unit:    definition.Unit,
+	}
+
+	contexts := []string{context}
+	if context != "" {
+		contexts = append(contexts, "")
+	}
+	for _, candidate := range contexts {
+		for _, override := range overrides {
+			if override.Type == definition.Type && override.Field == field.Name && override.Context == candidate {
+				resolved.Target = &config.VitalRange{Low: override.Low, High: override.High}
+				resolved.CriticalLow = override.CriticalLow
+				resolved.CriticalHigh = override.CriticalHigh
+				resolved.Source = models.VitalTargetSourcePatient
+				resolved.TargetID = override.ID
+				return resolved
+			}
+		}
+	}
+	for _, candidate := range contexts {
+		for _, protocol := range protocols {
+			if protocol.Type == definition.Type && protocol.Field == field.Name && protocol.Context == candidate &&
+				hasChronicDisease(patient, protocol.Disease) {
+				target := protocol.Target
+				resolved.Target = &target
+				resolved.setCritical(protocol.Critical)
+				resolved.Source = models.VitalTargetSourceProtocol
+				resolved.Disease = protocol.Disease
+				return resolved
+			}
+		}
+	}
+
+	resolved.Target = field.Target
+	resolved.setCritical(field.Critical)
+	resolved.Source = models.VitalTargetSourceDefault
+	return resolved
+}
+
+func (t *ResolvedTarget) setCritical(critical *config.VitalRange) {
+	if critical == nil {
+		return
+	}
+	low, high := critical.Low, critical.High
+	t.CriticalLow = &low
+	t.CriticalHigh = &high
+}
+
+// PatientVitalTargets 返回患者全部指标生效的目标范围，区分测量场景的类型按场景逐一列出
+func PatientVitalTargets(patient *models.Patient) ([]ResolvedTarget, error) {
+	overrides, err := storage.GetVitalAlertStorage().ListTargets(patient.ID)
+	if err != nil {
+		return nil, err
+	}
+	var targets []ResolvedTarget
+	for _, definition := range VitalSignTypes() {
+		contexts := definition.Contexts
+		if len(contexts) == 0 {
+			contexts = []string{""}
+		}
+		for _, context := range contexts {
+			for _, field := range definition.Fields {
+				targets = append(targets, resolveVitalTarget(patient, overrides, config.DefaultVitalTargetProtocols, definition, field, context))
+			}
+		}
+	}
+	return targets, nil
+}
+
+// evaluateVitalData 检查生理数据各数值字段是否超出目标范围，返回未保存的提醒
+func evaluateVitalData(patient *models.Patient, overrides []models.VitalTarget, protocols []config.VitalTargetProtocol,
+	definition config.VitalSignType, data *models.PhysiologicalData) []models.VitalAlert {
+	var alerts []models.VitalAlert
+	for _, field := range definition.Fields {
+		value, ok := data.Components[field.Name]
+		if !ok {
+			continue
+		}
+		target := resolveVitalTarget(patient, overrides, protocols, definition, field, data.Context)
+
+		severity, direction := "", ""
+		switch {
+		case target.CriticalLow != nil && value < *target.CriticalLow:
+			severity, direction = models.VitalAlertSeverityCritical, "low"
+		case target.CriticalHigh != nil && value > *target.CriticalHigh:
+			severity, direction = models.VitalAlertSeverityCritical, "high"
+		case target.Target != nil && value < target.Target.Low:
+			severity, direction = models.VitalAlertSeverityWarning, "low"
+		case target.Target != nil && value > target.Target.High:
+			severity, direction = models.VitalAlertSeverityWarning, "high"
+		default:
+			continue
+		}
+
+		alert := models.VitalAlert{
+			PatientID:    data.PatientID,
+			DoctorID:     patient.DoctorID,
+			DataID:       data.ID,
+			Type:         data.Type,
+			Context:      data.Context,
+			Field:        field.Name,
+			Value:        value,
+			Direction:    direction,
+			Severity:     severity,
+			TargetSource: target.Source,
+			MeasuredAt:   data.MeasuredAt,
+			Status:       models.VitalAlertStatusOpen,
+		}
+		if target.Target != nil {
+			alert.Low, alert.High = target.Target.Low, target.Target.High
+		}
+		alert.Message = vitalAlertMessage(definition, field, alert, target)
+		alerts = append(alerts, alert)
+	}
+	return alerts
+}
+
+// vitalAlertMessage 生成提醒内容，如"空腹血糖值 16.9 mmol/L，高于目标范围 4.4-7（超过危急值 16.7）"
+func vitalAlertMessage(definition config.VitalSignType, field config.VitalField, alert models.VitalAlert, target ResolvedTarget) string {
+	label := field.Label
+	if alert.Context != "" {
+		label = alert.Context + label
+	}
+	message := fmt.Sprintf("%s %s %s", label, formatNumber(alert.Value), definition.Unit)
+
+	critical := ""
+	if alert.Severity == models.VitalAlertSeverityCritical {
+		if alert.Direction == "low" {
+			critical = "低于危急值 " + formatNumber(*target.CriticalLow)
+		} else {
+			critical = "超过危急值 " + formatNumber(*target.CriticalHigh)
+		}
+	}
+	if target.Target == nil {
+		return message + "，" + critical
+	}
+
+	direction := "高于"
+	if alert.Direction == "low" {
+		direction = "低于"
+	}
+	message += fmt.Sprintf("，%s目标范围 %s-%s", direction, formatNumber(alert.Low), formatNumber(alert.High))
+	if critical != "" {
+		message += "（" + critical + "）"
+	}
+	return message
+}
+
+func formatNumber(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
+
+// EvaluateVitalAlerts 按患者的目标范围评估一条生理数据并保存产生的提醒；已驳回和没有数值分量的数据不评估
+func EvaluateVitalAlerts(data *models.PhysiologicalData) ([]models.VitalAlert, error) {
+	// AI提取的数据可能有误，医生确认后才评估；驳回的数据不评估
+	if data.Status == models.PhysiologicalStatusRejected || data.Status == models.PhysiologicalStatusPending || len(data.Components) == 0 {
+		return nil, nil
+	}
+	definition, ok := VitalSignTypeByName(data.Type)
+	if !ok {
+		return nil, nil
+	}
+	patient, err := storage.GetPatientStorage().GetPatientByID(data.PatientID)
+	if err != nil {
+		return nil, err
+	}
+	overrides, err := storage.GetVitalAlertStorage().ListTargets(patient.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	alerts := evaluateVitalData(patient, overrides, config.DefaultVitalTargetProtocols, definition, data)
+	now := time.Now()
+	for i := range alerts {
+		alerts[i].ID = utils.GenerateID()
+		alerts[i].CreatedAt = now
+		alerts[i].UpdatedAt = now
+	}
+	if err := storage.GetVitalAlertStorage().CreateAlerts(alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+// ReevaluateVitalAlerts 数据被修正后作废原有的未处理提醒并重新评估
+func ReevaluateVitalAlerts(data *models.PhysiologicalData) ([]models.VitalAlert, error) {
+	if err := storage.GetVitalAlertStorage().DismissAlertsForData(data.ID); err != nil {
+		return nil, err
+	}
+	return EvaluateVitalAlerts(data)
+}
+
+// RecordPhysiologicalData 保存一条生理数据并评估是否需要提醒，手动录入、AI提取、设备上传等所有来源都通过这里保存；
+// 评估失败只打印错误，不影响数据保存
+func RecordPhysiologicalData(data *models.PhysiologicalData) error {
+	if err := storage.GetPhysiologicalDataStorage().Create(data); err != nil {
+		return err
+	}
+	if _, err := EvaluateVitalAlerts(data); err != nil {
+		log.Printf("评估生理数据提醒失败 (DataID: %s): %v", data.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+
+	"we-dear/config"
+	"we-dear/models"
+
+	"github.com/lib/pq"
+)
+
+func TestResolveVitalTarget(t *testing.T) {
+	sugar, _ := findVitalSignType(config.DefaultVitalSignTypes, "blood_sugar")
+	pressure, _ := findVitalSignType(config.DefaultVitalSignTypes, "blood_pressure")
+	protocols := config.DefaultVitalTargetProtocols
+
+	healthy := &models.Patient{}
+	diabetic := &models.Patient{ChronicDiseases: pq.StringArray{"2型糖尿病", "高血压"}}
+
+	if target := resolveVitalTarget(healthy, nil, protocols, sugar, sugar.Fields[0], "空腹"); target.Source != models.VitalTargetSourceDefault || target.Target.High != 10 {
+		t.Errorf("expected default target, got %+v", target)
+	}
+	if target := resolveVitalTarget(diabetic, nil, protocols, sugar, sugar.Fields[0], "空腹"); target.Source != models.VitalTargetSourceProtocol || target.Target.High != 7 {
+		t.Errorf("expected fasting diabetes protocol, got %+v", target)
+	}
+	if target := resolveVitalTarget(diabetic, nil, protocols, sugar, sugar.Fields[0], "餐后"); target.Target.High != 10 || target.Disease != "糖尿病" {
+		t.Errorf("expected context-free diabetes protocol for postprandial, got %+v", target)
+	}
+	if target := resolveVitalTarget(diabetic, nil, protocols, pressure, pressure.Fields[0], ""); target.Target.High != 129 {
+		t.Errorf("expected the stricter diabetes blood pressure target, got %+v", target)
+	}
+
+	overrides := []models.VitalTarget{{BaseModel: models.BaseModel{ID: "t1"}, Type: "blood_sugar", Field: "value", Low: 5, High: 8}}
+	if target := resolveVitalTarget(diabetic, overrides, protocols, sugar, sugar.Fields[0], "空腹"); target.Source != models.VitalTargetSourcePatient || target.Target.High != 8 || target.CriticalHigh != nil {
+		t.Errorf("expected patient override to win, got %+v", target)
+	}
+}
+
+func TestEvaluateVitalData(t *testing.T) {
+	pressure, _ := findVitalSignType(config.DefaultVitalSignTypes, "blood_pressure")
+	patient := &models.Patient{DoctorID: "doctor1", ChronicDiseases: pq.StringArray{"高血压"}}
+	data := &models.PhysiologicalData{
+		BaseModel:  models.BaseModel{ID: "data1"},
+		PatientID:  "patient1",
+		Type:       "blood_pressure",
+		Components: models.VitalComponents{"systolic": 182, "diastolic": 88},
+	}
+
+	alerts := evaluateVitalData(patient, nil, config.DefaultVitalTargetProtocols, pressure, data)
+	if len(alerts) != 1 {
+		t.Fatalf("expected one alert, got %+v", alerts)
+	}
+	alert := alerts[0]
+	if alert.Field != "systolic" || alert.Severity != models.VitalAlertSeverityCritical || alert.Direction != "high" || alert.DoctorID != "doctor1" {
+		t.Errorf("unexpected alert: %+v", alert)
+	}
+	if alert.Message != "收缩压 182 mmHg，高于目标范围 90-139（超过危急值 179）" {
+		t.Errorf("unexpected message %q", alert.Message)
+	}
+
+	data.Components = models.VitalComponents{"systolic": 125, "diastolic": 80}
+	if alerts := evaluateVitalData(patient, nil, config.DefaultVitalTargetProtocols, pressure, data); len(alerts) != 0 {
+		t.Errorf("expected no alerts in range, got %+v", alerts)
+	}
+}
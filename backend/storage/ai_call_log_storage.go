@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+)
+
+type AICallLogStorage struct {
+	db *gorm.DB
+}
+
+var (
+	aiCallLogInstance *AICallLogStorage
+	aiCallLogOnce     sync.Once
+)
+
+func GetAICallLogStorage() *AICallLogStorage {
+	aiCallLogOnce.Do(func() {
+		aiCallLogInstance = &AICallLogStorage{
+			db: config.DB,
+		}
+	})
+	return aiCallLogInstance
+}
+
+// AICallLogFilter 调用日志查询条件，为空的条件忽略
+type AICallLogFilter struct {
+	PatientID string
+	MessageID string
+	Purpose   string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// Create 保存调用日志
+func (s *AICallLogStorage) Create(log *models.AICallLog) error {
+	return s.db.Create(log).Error
+}
+
+// GetByID 获取调用日志
+func (s *AICallLogStorage) GetByID(id string) (*models.AICallLog, error) {
+	var log models.AICallLog
+	err := s.db.First(&log, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("ai call log not found")
+		}
+		return nil, err
+	}
+	return &log, nil
+}
+
+// List 按条件查询调用日志，按时间倒序
+func (s *AICallLogStorage) List(filter AICallLogFilter) ([]models.AICallLog, error) {
+	var logs []models.AICallLog
+	query := s.db.Model(&models.AICallLog{})
+	if filter.PatientID != "" {
+		query = query.Where("patient_id = ?", filter.PatientID)
+	}
+	if filter.MessageID != "" {
+		query = query.Where("message_id = ?", filter.MessageID)
+	}
+	if filter.Purpose != "" {
+		query = query.Where("purpose = ?", filter.Purpose)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+	err := query.Order("created_at desc").Find(&logs).Error
+	return logs, err
+}
@@ -0,0 +1,193 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+)
+
+type AIJobStorage struct {
+	db *gorm.DB
+}
+
+var (
+	aiJobInstance *AIJobStorage
+	aiJobOnce     sync.Once
+)
+
+func GetAIJobStorage() *AIJobStorage {
+	aiJobOnce.Do(func() {
+		aiJobInstance = &AIJobStorage{
+			db: config.DB,
+		}
+	})
+	return aiJobInstance
+}
+
+// Create 创建任务
+func (s *AIJobStorage) Create(job *models.AIJob) error {
+	return s.db.Create(job).Error
+}
+
+// GetByID 获取任务
+func (s *AIJobStorage) GetByID(id string) (*models.AIJob, error) {
+	var job models.AIJob
+	err := s.db.First(&job, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("job not found")
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// List 按条件查询任务，条件为空时忽略
+func (s *AIJobStorage) List(patientID, messageID, status string) ([]models.AIJob, error) {
+	var jobs []models.AIJob
+	query := s.db.Model(&models.AIJob{})
+	if patientID != "" {
+		query = query.Where("patient_id = ?", patientID)
+	}
+	if messageID != "" {
+		query = query.Where("message_id = ?", messageID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Order("created_at desc").Find(&jobs).Error
+	return jobs, err
+}
+
+// HasPending 判断患者是否有某类型的排队中、执行中或暂停中的任务
+func (s *AIJobStorage) HasPending(jobType string, patientID string) (bool, error) {
+	var count int64
+	err := s.db.Model(&models.AIJob{}).
+		Where("type = ? AND patient_id = ? AND status IN ?", jobType, patientID,
+			[]string{models.AIJobStatusQueued, models.AIJobStatusRunning, models.AIJobStatusPaused}).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// GetLatestByMessage 获取消息最近创建的某类型任务，没有时返回 nil
+func (s *AIJobStorage) GetLatestByMessage(jobType string, messageID string) (*models.AIJob, error) {
+	var job models.AIJob
+	err := s.db.Where("type = ? AND message_id = ?", jobType, messageID).
+		Order("created_at desc").First(&job).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Claim 领取指定的排队或暂停任务并标记为执行中（不检查是否到期），任务已被领取或已结束时返回 nil
+func (s *AIJobStorage) Claim(id string, now time.Time) (*models.AIJob, error) {
+	var jobs []models.AIJob
+	err := s.db.Raw(`
+		UPDATE ai_jobs SET status = ?, attempts = attempts + 1, started_at = ?, updated_at = ?
+		WHERE id = ? AND status IN (?, ?) AND deleted_at IS NULL
+		RETURNING *`,
+		models.AIJobStatusRunning, now, now,
+		id, models.AIJobStatusQueued, models.AIJobStatusPaused,
+	).Scan(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// ClaimNext 领取一个到期的排队或暂停任务并标记为执行中，没有任务时返回 nil。
+// 使用 SKIP LOCKED，多个 worker 并发领取时不会拿到同一个任务
+func (s *AIJobStorage) ClaimNext(now time.Time) (*models.AIJob, error) {
+	var jobs []models.AIJob
+	err := s.db.Raw(`
+		UPDATE ai_jobs SET status = ?, attempts = attempts + 1, started_at = ?, updated_at = ?
+		WHERE id = (
+			SELECT id FROM ai_jobs
+			WHERE status IN (?, ?) AND next_run_at <= ? AND deleted_at IS NULL
+			ORDER BY next_run_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING *`,
+		models.AIJobStatusRunning, now, now,
+		models.AIJobStatusQueued, models.AIJobStatusPaused, now,
+	).Scan(&jobs).Error
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// MarkSucceeded 标记任务成功
+func (s *AIJobStorage) MarkSucceeded(id string, resultID string) error {
+	now := time.Now()
+	return s.db.Model(&models.AIJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      models.AIJobStatusSucceeded,
+		"result_id":   resultID,
+		"last_error":  "",
+		"finished_at": now,
+		"updated_at":  now,
+	}).Error
+}
+
+// MarkRetry 记录失败原因并在 nextRunAt 之后重新排队
+func (s *AIJobStorage) MarkRetry(id string, lastError string, nextRunAt time.Time) error {
+	return s.db.Model(&models.AIJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      models.AIJobStatusQueued,
+		"last_error":  lastError,
+		"next_run_at": nextRunAt,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+// MarkPaused 暂停任务到 nextRunAt 再检查，本次领取不计入执行次数
+func (s *AIJobStorage) MarkPaused(id string, reason string, nextRunAt time.Time) error {
+	return s.db.Model(&models.AIJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      models.AIJobStatusPaused,
+		"attempts":    gorm.Expr("attempts - 1"),
+		"last_error":  reason,
+		"next_run_at": nextRunAt,
+		"updated_at":  time.Now(),
+	}).Error
+}
+
+// MarkFailed 标记任务最终失败
+func (s *AIJobStorage) MarkFailed(id string, lastError string) error {
+	now := time.Now()
+	return s.db.Model(&models.AIJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      models.AIJobStatusFailed,
+		"last_error":  lastError,
+		"finished_at": now,
+		"updated_at":  now,
+	}).Error
+}
+
+// Requeue 重置任务为排队状态并清空执行次数，用于手动重新执行
+func (s *AIJobStorage) Requeue(id string) error {
+	now := time.Now()
+	return s.db.Model(&models.AIJob{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":      models.AIJobStatusQueued,
+		"attempts":    0,
+		"last_error":  "",
+		"next_run_at": now,
+		"updated_at":  now,
+	}).Error
+}
+
+// ResetRunning 将执行中的任务重新排队（进程重启后这些任务已没有 worker 在执行）
+func (s *AIJobStorage) ResetRunning() (int64, error) {
+	result := s.db.Model(&models.AIJob{}).Where("status = ?", models.AIJobStatusRunning).Updates(map[string]interface{}{
+		"status":      models.AIJobStatusQueued,
+		"next_run_at": time.Now(),
+		"updated_at":  time.Now(),
+	})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,47 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+)
+
+type AITemplateStorage struct {
+	db *gorm.DB
+}
+
+var (
+	aiTemplateInstance *AITemplateStorage
+	aiTemplateOnce     sync.Once
+)
+
+func GetAITemplateStorage() *AITemplateStorage {
+	aiTemplateOnce.Do(func() {
+		aiTemplateInstance = &AITemplateStorage{
+			db: config.DB,
+		}
+	})
+	return aiTemplateInstance
+}
+
+// GetActiveByCategory 获取某分类下已审核通过且启用的模板，多个时取最近审核的版本，
+// 没有时返回 nil
+func (s *AITemplateStorage) GetActiveByCategory(category string) (*models.AIAgentTemplate, error) {
+	var template models.AIAgentTemplate
+	err := s.db.Where("status = ? AND audit_status = ? AND ? = ANY(categories)",
+		models.AIAgentStatusEnabled,
+		models.AIAgentAuditStatusApproved,
+		category).
+		Order("last_audit_at desc").
+		First(&template).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &template, nil
+}
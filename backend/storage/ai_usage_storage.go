@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type AIUsageStorage struct {
+	db *gorm.DB
+}
+
+var (
+	aiUsageInstance *AIUsageStorage
+	aiUsageOnce     sync.Once
+)
+
+func GetAIUsageStorage() *AIUsageStorage {
+	aiUsageOnce.Do(func() {
+		aiUsageInstance = &AIUsageStorage{
+			db: config.DB,
+		}
+	})
+	return aiUsageInstance
+}
+
+// 用量报表支持的分组维度及对应的列
+var usageGroupColumns = map[string]string{
+	"day":        "day",
+	"doctor":     "doctor_id",
+	"department": "department_id",
+	"patient":    "patient_id",
+	"template":   "template_id",
+	"purpose":    "purpose",
+	"model":      "model",
+}
+
+// UsageReportFilter 用量报表查询条件，日期为 2006-01-02 格式，包含两端
+type UsageReportFilter struct {
+	From         string
+	To           string
+	GroupBy      string
+	DoctorID     string
+	DepartmentID string
+}
+
+// UsageReportRow 报表中的一行
+type UsageReportRow struct {
+	Key              string  `json:"key"`
+	Name             string  `json:"name,omitempty"`
+	Calls            int64   `json:"calls"`
+	FailedCalls      int64   `json:"failedCalls"`
+	PromptTokens     int64   `json:"promptTokens"`
+	CompletionTokens int64   `json:"completionTokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// AddUsage 累加一次调用的用量，同一天同一维度组合只保留一条记录
+func (s *AIUsageStorage) AddUsage(usage *models.AIUsageDaily) error {
+	return s.db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "day"}, {Name: "doctor_id"}, {Name: "department_id"}, {Name: "patient_id"},
+			{Name: "template_id"}, {Name: "purpose"}, {Name: "provider"}, {Name: "model"},
+		},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"calls":             gorm.Expr("ai_usage_daily.calls + excluded.calls"),
+			"failed_calls":      gorm.Expr("ai_usage_daily.failed_calls + excluded.failed_calls"),
+			"prompt_tokens":     gorm.Expr("ai_usage_daily.prompt_tokens + excluded.prompt_tokens"),
+			"completion_tokens": gorm.Expr("ai_usage_daily.completion_tokens + excluded.completion_tokens"),
+			"cost":              gorm.Expr("ai_usage_daily.cost + excluded.cost"),
+			"updated_at":        gorm.Expr("excluded.updated_at"),
+		}),
+	}).Create(usage).Error
+}
+
+// Report 按维度汇总用量，按费用从高到低排序
+func (s *AIUsageStorage) Report(filter UsageReportFilter) ([]UsageReportRow, error) {
+	column, ok := usageGroupColumns[filter.GroupBy]
+	if !ok {
+		return nil, fmt.Errorf("不支持的分组维度: %s", filter.GroupBy)
+	}
+
+	query := s.db.Model(&models.AIUsageDaily{}).Select(column + ` AS "key",
+		SUM(calls) AS calls, SUM(failed_calls) AS failed_calls,
+		SUM(prompt_tokens) AS prompt_tokens, SUM(completion_tokens) AS completion_tokens,
+		SUM(cost) AS cost`)
+	if filter.From != "" {
+		query = query.Where("day >= ?", filter.From)
+	}
+	if filter.To != "" {
+		query = query.Where("day <= ?", filter.To)
+	}
+	if filter.DoctorID != "" {
+		query = query.Where("doctor_id = ?", filter.DoctorID)
+	}
+	if filter.DepartmentID != "" {
+		query = query.Where("department_id = ?", filter.DepartmentID)
+	}
+
+	var rows []UsageReportRow
+	err := query.Group(column).Order("cost desc, " + column).Scan(&rows).Error
+	return rows, err
+}
+
+// SpentSince 某范围自 since（含）以来的费用合计，scope 为 global 时统计全部
+func (s *AIUsageStorage) SpentSince(scope string, scopeID string, since time.Time) (float64, error) {
+	query := s.db.Model(&models.AIUsageDaily{}).Where("day >= ?", since.Format("2006-01-02"))
+	switch scope {
+	case models.AIBudgetScopeDepartment:
+		query = query.Where("department_id = ?", scopeID)
+	case models.AIBudgetScopeDoctor:
+		query = query.Where("doctor_id = ?", scopeID)
+	}
+	var spent float64
+	err := query.Select("COALESCE(SUM(cost), 0)").Scan(&spent).Error
+	return spent, err
+}
+
+// ListBudgets 获取全部预算
+func (s *AIUsageStorage) ListBudgets() ([]models.AIBudget, error) {
+	var budgets []models.AIBudget
+	err := s.db.Order("scope, scope_id").Find(&budgets).Error
+	return budgets, err
+}
+
+// GetBudget 获取某范围的预算，未设置时返回 nil
+func (s *AIUsageStorage) GetBudget(scope string, scopeID string) (*models.AIBudget, error) {
+	var budget models.AIBudget
+	err := s.db.Where("scope = ? AND scope_id = ?", scope, scopeID).First(&budget).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &budget, nil
+}
+
+// SaveBudget 保存预算
+func (s *AIUsageStorage) SaveBudget(budget *models.AIBudget) error {
+	return s.db.Save(budget).Error
+}
+
+// DeleteBudget 删除预算
+func (s *AIUsageStorage) DeleteBudget(id string) error {
+	result := s.db.Unscoped().Delete(&models.AIBudget{}, "id = ?", id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("budget not found")
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type ConversationSummaryStorage struct {
+	db *gorm.DB
+}
+
+var (
+	conversationSummaryInstance *ConversationSummaryStorage
+	conversationSummaryOnce     sync.Once
+)
+
+func GetConversationSummaryStorage() *ConversationSummaryStorage {
+	conversationSummaryOnce.Do(func() {
+		conversationSummaryInstance = &ConversationSummaryStorage{
+			db: config.DB,
+		}
+	})
+	return conversationSummaryInstance
+}
+
+// GetByPatientID 获取患者的对话摘要，还没有摘要时返回 nil
+func (s *ConversationSummaryStorage) GetByPatientID(patientID string) (*models.ConversationSummary, error) {
+	var summary models.ConversationSummary
+	err := s.db.Where("patient_id = ?", patientID).First(&summary).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// SaveIfVersion 仅当数据库中的摘要仍是 version 版本时保存，返回是否保存成功；
+// version 为 0 表示新建，患者已有摘要时不保存。用于避免AI更新和医生修正互相覆盖
+func (s *ConversationSummaryStorage) SaveIfVersion(summary *models.ConversationSummary, version int) (bool, error) {
+	summary.UpdatedAt = time.Now()
+	if version == 0 {
+		result := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(summary)
+		return result.RowsAffected == 1, result.Error
+	}
+	result := s.db.Model(&models.ConversationSummary{}).
+		Where("id = ? AND version = ?", summary.ID, version).
+		Updates(map[string]interface{}{
+			"content":         summary.Content,
+			"last_message_id": summary.LastMessageID,
+			"last_message_at": summary.LastMessageAt,
+			"message_count":   summary.MessageCount,
+			"version":         summary.Version,
+			"model_used":      summary.ModelUsed,
+			"edited_by":       summary.EditedBy,
+			"edited_at":       summary.EditedAt,
+			"updated_at":      summary.UpdatedAt,
+		})
+	return result.RowsAffected == 1, result.Error
+}
+
+// GetLatestMessage 获取患者最新的一条消息，没有消息时返回 nil
+func (s *ConversationSummaryStorage) GetLatestMessage(patientID string) (*models.Message, error) {
+	var message models.Message
+	err := s.db.Where("patient_id = ?", patientID).Order("created_at desc").First(&message).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &message, nil
+}
+
+// CountMessagesAfter 统计某时间之后的消息数量，after 为零值时统计全部
+func (s *ConversationSummaryStorage) CountMessagesAfter(patientID string, after time.Time) (int64, error) {
+	var count int64
+	err := s.db.Model(&models.Message{}).
+		Where("patient_id = ? AND created_at > ?", patientID, after).
+		Count(&count).Error
+	return count, err
+}
+
+// GetMessagesAfter 按时间正序获取某时间之后的消息，最多 limit 条
+func (s *ConversationSummaryStorage) GetMessagesAfter(patientID string, after time.Time, limit int) ([]models.Message, error) {
+	var messages []models.Message
+	err := s.db.Where("patient_id = ? AND created_at > ?", patientID, after).
+		Order("created_at asc").
+		Limit(limit).
+		Find(&messages).Error
+	return messages, err
+}
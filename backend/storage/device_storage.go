@@ -0,0 +1,73 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+)
+
+type DeviceStorage struct {
+	db *gorm.DB
+}
+
+var (
+	deviceInstance *DeviceStorage
+	deviceOnce     sync.Once
+)
+
+func GetDeviceStorage() *DeviceStorage {
+	deviceOnce.Do(func() {
+		deviceInstance = &DeviceStorage{
+			db: config.DB,
+		}
+	})
+	return deviceInstance
+}
+
+// Create 登记设备
+func (s *DeviceStorage) Create(device *models.Device) error {
+	return s.db.Create(device).Error
+}
+
+// Save 更新设备
+func (s *DeviceStorage) Save(device *models.Device) error {
+	return s.db.Save(device).Error
+}
+
+// GetByID 获取设备
+func (s *DeviceStorage) GetByID(id string) (*models.Device, error) {
+	var device models.Device
+	if err := s.db.First(&device, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// GetBySerialNumber 按序列号获取设备，未登记时返回 nil
+func (s *DeviceStorage) GetBySerialNumber(serialNumber string) (*models.Device, error) {
+	var device models.Device
+	err := s.db.First(&device, "serial_number = ?", serialNumber).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &device, nil
+}
+
+// ListByPatient 获取患者的设备
+func (s *DeviceStorage) ListByPatient(patientID string) ([]models.Device, error) {
+	var devices []models.Device
+	err := s.db.Where("patient_id = ?", patientID).Order("created_at asc").Find(&devices).Error
+	return devices, err
+}
+
+// TouchLastSeen 记录设备最近一次上传时间，不修改更新时间
+func (s *DeviceStorage) TouchLastSeen(id string, at time.Time) error {
+	return s.db.Model(&models.Device{}).Where("id = ?", id).UpdateColumn("last_seen_at", at).Error
+}
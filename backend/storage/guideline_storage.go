@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+)
+
+type GuidelineStorage struct {
+	db *gorm.DB
+
+	vectorOnce    sync.Once
+	vectorEnabled bool
+}
+
+var (
+	guidelineInstance *GuidelineStorage
+	guidelineOnce     sync.Once
+)
+
+func GetGuidelineStorage() *GuidelineStorage {
+	guidelineOnce.Do(func() {
+		guidelineInstance = &GuidelineStorage{
+			db: config.DB,
+		}
+	})
+	return guidelineInstance
+}
+
+// GuidelineMatch 检索到的片段及相似度
+type GuidelineMatch struct {
+	Chunk    models.GuidelineChunk
+	Document models.GuidelineDocument
+	Score    float64
+}
+
+// EnableVector 尝试启用 pgvector 扩展并添加 embedding_vec 列，数据库不支持时返回错误，
+// 此时检索回退为在内存中计算相似度
+func (s *GuidelineStorage) EnableVector() error {
+	if err := s.db.Exec("CREATE EXTENSION IF NOT EXISTS vector").Error; err != nil {
+		return fmt.Errorf("pgvector 扩展不可用: %w", err)
+	}
+	if err := s.db.Exec("ALTER TABLE guideline_chunks ADD COLUMN IF NOT EXISTS embedding_vec vector").Error; err != nil {
+		return fmt.Errorf("添加向量列失败: %w", err)
+	}
+	s.vectorOnce.Do(func() {})
+	s.vectorEnabled = true
+	return nil
+}
+
+// VectorEnabled 判断 guideline_chunks 表是否有 pgvector 列
+func (s *GuidelineStorage) VectorEnabled() bool {
+	s.vectorOnce.Do(func() {
+		var count int64
+		err := s.db.Raw(`SELECT COUNT(*) FROM information_schema.columns
+			WHERE table_name = 'guideline_chunks' AND column_name = 'embedding_vec'`).Scan(&count).Error
+		if err != nil {
+			log.Printf("检查向量列失败: %v", err)
+		}
+		s.vectorEnabled = err == nil && count > 0
+	})
+	return s.vectorEnabled
+}
+
+// GetDocumentBySource 按来源路径获取文档，不存在时返回 nil
+func (s *GuidelineStorage) GetDocumentBySource(source string) (*models.GuidelineDocument, error) {
+	var document models.GuidelineDocument
+	err := s.db.Where("source = ?", source).First(&document).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &document, nil
+}
+
+// ListDocuments 获取全部文档
+func (s *GuidelineStorage) ListDocuments() ([]models.GuidelineDocument, error) {
+	var documents []models.GuidelineDocument
+	err := s.db.Order("title asc").Find(&documents).Error
+	return documents, err
+}
+
+// ReplaceDocument 在一个事务中保存文档并替换它的全部片段
+func (s *GuidelineStorage) ReplaceDocument(document *models.GuidelineDocument, chunks []models.GuidelineChunk) error {
+	vector := s.VectorEnabled()
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("document_id = ?", document.ID).Delete(&models.GuidelineChunk{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Save(document).Error; err != nil {
+			return err
+		}
+		if len(chunks) == 0 {
+			return nil
+		}
+		if err := tx.CreateInBatches(chunks, 100).Error; err != nil {
+			return err
+		}
+		if vector {
+			for _, chunk := range chunks {
+				if err := tx.Exec("UPDATE guideline_chunks SET embedding_vec = ?::vector WHERE id = ?",
+					vectorLiteral(chunk.Embedding), chunk.ID).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// Search 检索与向量最相似的 k 个片段，只比较同一嵌入方式生成的向量
+func (s *GuidelineStorage) Search(embedder string, vector []float64, k int) ([]GuidelineMatch, error) {
+	if s.VectorEnabled() {
+		return s.searchVector(embedder, vector, k)
+	}
+	return s.searchInMemory(embedder, vector, k)
+}
+
+func (s *GuidelineStorage) searchVector(embedder string, vector []float64, k int) ([]GuidelineMatch, error) {
+	var rows []struct {
+		models.GuidelineChunk
+		Distance float64
+	}
+	err := s.db.Raw(`SELECT *, embedding_vec <=> ?::vector AS distance FROM guideline_chunks
+		WHERE embedder = ? AND deleted_at IS NULL AND embedding_vec IS NOT NULL
+		ORDER BY distance LIMIT ?`, vectorLiteral(vector), embedder, k).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	matches := make([]GuidelineMatch, 0, len(rows))
+	for _, row := range rows {
+		matches = append(matches, GuidelineMatch{Chunk: row.GuidelineChunk, Score: 1 - row.Distance})
+	}
+	return matches, s.attachDocuments(matches)
+}
+
+// searchInMemory 没有 pgvector 时加载全部片段计算相似度，规范文档数量有限，开销可以接受
+func (s *GuidelineStorage) searchInMemory(embedder string, vector []float64, k int) ([]GuidelineMatch, error) {
+	var chunks []models.GuidelineChunk
+	if err := s.db.Where("embedder = ?", embedder).Find(&chunks).Error; err != nil {
+		return nil, err
+	}
+
+	var matches []GuidelineMatch
+	for _, chunk := range chunks {
+		if len(chunk.Embedding) != len(vector) {
+			continue
+		}
+		var score float64
+		for i := range vector {
+			score += vector[i] * chunk.Embedding[i]
+		}
+		matches = append(matches, GuidelineMatch{Chunk: chunk, Score: score})
+	}
+
+	// 部分选择排序，只需要前 k 个
+	for i := 0; i < len(matches) && i < k; i++ {
+		best := i
+		for j := i + 1; j < len(matches); j++ {
+			if matches[j].Score > matches[best].Score {
+				best = j
+			}
+		}
+		matches[i], matches[best] = matches[best], matches[i]
+	}
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches, s.attachDocuments(matches)
+}
+
+func (s *GuidelineStorage) attachDocuments(matches []GuidelineMatch) error {
+	if len(matches) == 0 {
+		return nil
+	}
+	ids := make([]string, 0, len(matches))
+	for _, match := range matches {
+		ids = append(ids, match.Chunk.DocumentID)
+	}
+	var documents []models.GuidelineDocument
+	if err := s.db.Where("id IN ?", ids).Find(&documents).Error; err != nil {
+		return err
+	}
+	byID := map[string]models.GuidelineDocument{}
+	for _, document := range documents {
+		byID[document.ID] = document
+	}
+	for i := range matches {
+		matches[i].Document = byID[matches[i].Chunk.DocumentID]
+	}
+	return nil
+}
+
+// vectorLiteral 转换为 pgvector 的文本格式，如 [0.1,0.2]
+func vectorLiteral(vector []float64) string {
+	parts := make([]string, len(vector))
+	for i, v := range vector {
+		parts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
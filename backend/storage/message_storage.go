@@ -0,0 +1,75 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+)
+
+type MessageStorage struct {
+	db *gorm.DB
+}
+
+var (
+	messageInstance *MessageStorage
+	messageOnce     sync.Once
+)
+
+func GetMessageStorage() *MessageStorage {
+	messageOnce.Do(func() {
+		messageInstance = &MessageStorage{
+			db: config.DB,
+		}
+	})
+	return messageInstance
+}
+
+// GetByID 获取患者会话中的一条消息，不存在时返回 nil
+func (s *MessageStorage) GetByID(patientID string, messageID string) (*models.Message, error) {
+	var message models.Message
+	err := s.db.Where("id = ? AND patient_id = ?", messageID, patientID).First(&message).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &message, nil
+}
+
+// MarkRead 将会话中 senderRole 一方在 until 及之前发送的未读消息标记为已读，返回标记的数量
+func (s *MessageStorage) MarkRead(patientID string, senderRole string, until time.Time, readAt time.Time) (int64, error) {
+	result := s.db.Model(&models.Message{}).
+		Where("patient_id = ? AND role = ? AND read = ? AND created_at <= ?", patientID, senderRole, false, until).
+		Updates(map[string]interface{}{
+			"read":    true,
+			"read_at": readAt,
+		})
+	return result.RowsAffected, result.Error
+}
+
+// UnreadCounts 统计会话中各发送方角色的未读消息数量
+func (s *MessageStorage) UnreadCounts(patientID string) (map[string]int, error) {
+	var rows []struct {
+		Role  string
+		Count int
+	}
+	err := s.db.Model(&models.Message{}).
+		Select("role, count(*) as count").
+		Where("patient_id = ? AND read = ?", patientID, false).
+		Group("role").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int{}
+	for _, row := range rows {
+		counts[row.Role] = row.Count
+	}
+	return counts, nil
+}
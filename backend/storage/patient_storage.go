@@ -73,6 +73,30 @@ func (s *PatientStorage) GetAISuggestions(patientID string, messageID string) ([
 	return suggestions, err
 }
 
+// GetAISuggestionByID 获取一条 AI 建议及其引用和用药安全警告，不存在时返回 nil
+func (s *PatientStorage) GetAISuggestionByID(id string) (*models.AISuggestion, error) {
+	return s.firstAISuggestion(s.db.Where("id = ?", id))
+}
+
+// GetLatestAISuggestion 获取消息最近生成的 AI 建议，不存在时返回 nil
+func (s *PatientStorage) GetLatestAISuggestion(patientID string, messageID string) (*models.AISuggestion, error) {
+	return s.firstAISuggestion(s.db.Where("patient_id = ? AND message_id = ?", patientID, messageID).Order("created_at desc"))
+}
+
+func (s *PatientStorage) firstAISuggestion(query *gorm.DB) (*models.AISuggestion, error) {
+	var suggestion models.AISuggestion
+	err := query.Preload("Citations", func(db *gorm.DB) *gorm.DB {
+		return db.Order("\"index\" asc")
+	}).Preload("SafetyWarnings").First(&suggestion).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &suggestion, nil
+}
+
 func (s *PatientStorage) SaveAISuggestion(suggestion *models.AISuggestion) error {
 	return s.db.Create(suggestion).Error
 }
@@ -1,6 +1,10 @@
 package storage
 
 import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
 	"we-dear/config"
 	"we-dear/models"
 
@@ -27,20 +31,121 @@ func (s *PhysiologicalDataStorage) Create(data *models.PhysiologicalData) error
 	return s.db.Create(data).Error
 }
 
-// GetByPatientID 获取患者的生理数据记录
+// GetByPatientID 获取患者已确认的生理数据记录
 func (s *PhysiologicalDataStorage) GetByPatientID(patientID string) ([]models.PhysiologicalData, error) {
+	return s.ListByPatient(patientID, "", models.PhysiologicalStatusConfirmed)
+}
+
+// GetByPatientIDAndType 获取患者特定类型已确认的生理数据记录
+func (s *PhysiologicalDataStorage) GetByPatientIDAndType(patientID string, dataType string) ([]models.PhysiologicalData, error) {
+	return s.ListByPatient(patientID, dataType, models.PhysiologicalStatusConfirmed)
+}
+
+// ListByPatient 按类型和状态获取患者的生理数据记录，dataType 为空时不限类型
+func (s *PhysiologicalDataStorage) ListByPatient(patientID string, dataType string, status string) ([]models.PhysiologicalData, error) {
 	var records []models.PhysiologicalData
-	err := s.db.Where("patient_id = ?", patientID).Order("measured_at desc").Find(&records).Error
+	query := s.db.Where("patient_id = ? AND status = ?", patientID, status)
+	if dataType != "" {
+		query = query.Where("type = ?", dataType)
+	}
+	err := query.Order("measured_at desc").Find(&records).Error
 	return records, err
 }
 
-// GetByPatientIDAndType 获取患者特定类型的生理数据记录
-func (s *PhysiologicalDataStorage) GetByPatientIDAndType(patientID string, dataType string) ([]models.PhysiologicalData, error) {
+// ListPending 获取待确认的生理数据，doctorID 不为空时只返回该医生患者的数据
+func (s *PhysiologicalDataStorage) ListPending(doctorID string, patientID string) ([]models.PhysiologicalData, error) {
+	var records []models.PhysiologicalData
+	query := s.db.Model(&models.PhysiologicalData{}).Where("physiological_data.status = ?", models.PhysiologicalStatusPending)
+	if doctorID != "" {
+		query = query.Joins("JOIN patients ON patients.id = physiological_data.patient_id").
+			Where("patients.doctor_id = ?", doctorID)
+	}
+	if patientID != "" {
+		query = query.Where("physiological_data.patient_id = ?", patientID)
+	}
+	err := query.Order("physiological_data.created_at asc").Find(&records).Error
+	return records, err
+}
+
+// GetByID 获取单条生理数据记录
+func (s *PhysiologicalDataStorage) GetByID(id string) (*models.PhysiologicalData, error) {
+	var record models.PhysiologicalData
+	if err := s.db.First(&record, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// ListMeasuredSince 获取患者某时间之后测量的已确认且有数值分量的数据，按测量时间升序
+func (s *PhysiologicalDataStorage) ListMeasuredSince(patientID string, from time.Time) ([]models.PhysiologicalData, error) {
 	var records []models.PhysiologicalData
-	err := s.db.Where("patient_id = ? AND type = ?", patientID, dataType).Order("measured_at desc").Find(&records).Error
+	err := s.db.Where("patient_id = ? AND status = ? AND components IS NOT NULL AND measured_at >= ?",
+		patientID, models.PhysiologicalStatusConfirmed, from).
+		Order("measured_at asc").Find(&records).Error
 	return records, err
 }
 
+// PatientsMeasuredSince 获取某时间之后有已确认数据的患者ID
+func (s *PhysiologicalDataStorage) PatientsMeasuredSince(from time.Time) ([]string, error) {
+	var patientIDs []string
+	err := s.db.Model(&models.PhysiologicalData{}).
+		Where("status = ? AND measured_at >= ?", models.PhysiologicalStatusConfirmed, from).
+		Distinct().Pluck("patient_id", &patientIDs).Error
+	return patientIDs, err
+}
+
+// GetByIdempotencyKey 按设备和幂等键获取已上传的数据，没有时返回 nil
+func (s *PhysiologicalDataStorage) GetByIdempotencyKey(deviceID string, key string) (*models.PhysiologicalData, error) {
+	var record models.PhysiologicalData
+	err := s.db.Where("device_id = ? AND idempotency_key = ?", deviceID, key).First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// FindDuplicate 查找患者同一时间、同一类型、数值相同且未被驳回的数据，没有时返回 nil
+func (s *PhysiologicalDataStorage) FindDuplicate(data *models.PhysiologicalData) (*models.PhysiologicalData, error) {
+	var record models.PhysiologicalData
+	err := s.db.Where("patient_id = ? AND type = ? AND measured_at = ? AND components = ?::jsonb AND status <> ?",
+		data.PatientID, data.Type, data.MeasuredAt, data.Components, models.PhysiologicalStatusRejected).
+		First(&record).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &record, nil
+}
+
+// EachWithoutComponents 分批遍历指定类型中还没有数值分量、也没有记录过解析失败的记录
+func (s *PhysiologicalDataStorage) EachWithoutComponents(types []string, batchSize int, fn func([]models.PhysiologicalData) error) error {
+	var records []models.PhysiologicalData
+	return s.db.Where("components IS NULL AND COALESCE(components_error, '') = '' AND type IN ?", types).
+		FindInBatches(&records, batchSize, func(tx *gorm.DB, batch int) error {
+			return fn(records)
+		}).Error
+}
+
+// UpdateComponents 只更新数值分量、单位和测量场景，保留用户原来填写的数据值，不修改更新时间
+func (s *PhysiologicalDataStorage) UpdateComponents(data *models.PhysiologicalData) error {
+	return s.db.Model(&models.PhysiologicalData{}).Where("id = ?", data.ID).UpdateColumns(map[string]interface{}{
+		"components": data.Components,
+		"unit":       data.Unit,
+		"context":    data.Context,
+	}).Error
+}
+
+// MarkComponentsError 记录无法解析为数值分量的原因，不修改更新时间
+func (s *PhysiologicalDataStorage) MarkComponentsError(id string, reason string) error {
+	return s.db.Model(&models.PhysiologicalData{}).Where("id = ?", id).
+		UpdateColumn("components_error", reason).Error
+}
+
 // Update 更新生理数据记录
 func (s *PhysiologicalDataStorage) Update(data *models.PhysiologicalData) error {
 	return s.db.Save(data).Error
@@ -49,4 +154,84 @@ func (s *PhysiologicalDataStorage) Update(data *models.PhysiologicalData) error
 // Delete 删除生理数据记录
 func (s *PhysiologicalDataStorage) Delete(id string) error {
 	return s.db.Delete(&models.PhysiologicalData{}, "id = ?", id).Error
-}
\ No newline at end of file
+}
+
+// SeriesBuckets 时间序列支持的聚合粒度（PostgreSQL date_trunc 的单位）
+var SeriesBuckets = map[string]bool{
+	"hour":  true,
+	"day":   true,
+	"week":  true,
+	"month": true,
+}
+
+// SeriesTarget 数值分量的目标范围，用于统计达标率
+type SeriesTarget struct {
+	Field string
+	Low   float64
+	High  float64
+}
+
+// SeriesFilter 时间序列查询条件，时间范围包含 From，不包含 To
+type SeriesFilter struct {
+	PatientID string
+	Type      string
+	Context   string // 测量场景，为空时不限
+	From      time.Time
+	To        time.Time
+	Bucket    string
+	Targets   []SeriesTarget
+}
+
+// SeriesRow 一个时间段内一个数值分量的统计
+type SeriesRow struct {
+	Bucket time.Time
+	Field  string
+	Count  int64
+	Min    float64
+	Max    float64
+	Mean   float64
+	Below  int64 // 低于目标范围的读数数量
+	Above  int64 // 高于目标范围的读数数量
+}
+
+// Series 按时间段统计已确认数据各数值分量的最小值、最大值、均值、数量，以及低于和高于目标范围的数量，
+// 统计在数据库中完成。没有目标范围的分量 Below、Above 为 0
+func (s *PhysiologicalDataStorage) Series(filter SeriesFilter) ([]SeriesRow, error) {
+	if !SeriesBuckets[filter.Bucket] {
+		return nil, fmt.Errorf("不支持的聚合粒度: %s", filter.Bucket)
+	}
+
+	// 目标范围作为 VALUES 表与数值分量关联
+	targets := "SELECT NULL::text AS field, NULL::float8 AS low, NULL::float8 AS high WHERE false"
+	var args []interface{}
+	if len(filter.Targets) > 0 {
+		rows := make([]string, 0, len(filter.Targets))
+		for _, target := range filter.Targets {
+			rows = append(rows, "(?::text, ?::float8, ?::float8)")
+			args = append(args, target.Field, target.Low, target.High)
+		}
+		targets = "VALUES " + strings.Join(rows, ", ")
+	}
+
+	query := `SELECT date_trunc(?::text, p.measured_at) AS bucket, c.key AS field,
+			COUNT(*) AS count,
+			MIN(c.value::float8) AS min, MAX(c.value::float8) AS max, AVG(c.value::float8) AS mean,
+			COUNT(*) FILTER (WHERE c.value::float8 < t.low) AS below,
+			COUNT(*) FILTER (WHERE c.value::float8 > t.high) AS above
+		FROM physiological_data p
+		CROSS JOIN LATERAL jsonb_each_text(p.components) c
+		LEFT JOIN (` + targets + `) AS t(field, low, high) ON t.field = c.key
+		WHERE p.deleted_at IS NULL AND p.patient_id = ? AND p.type = ? AND p.status = ?
+			AND p.measured_at >= ? AND p.measured_at < ?`
+	args = append([]interface{}{filter.Bucket}, args...)
+	args = append(args, filter.PatientID, filter.Type, models.PhysiologicalStatusConfirmed, filter.From, filter.To)
+	if filter.Context != "" {
+		query += " AND p.context = ?"
+		args = append(args, filter.Context)
+	}
+	query += " GROUP BY 1, 2 ORDER BY 1, 2"
+
+	var rows []SeriesRow
+	err := s.db.Raw(query, args...).Scan(&rows).Error
+	return rows, err
+}
@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+)
+
+type SafetyWarningStorage struct {
+	db *gorm.DB
+}
+
+var (
+	safetyWarningInstance *SafetyWarningStorage
+	safetyWarningOnce     sync.Once
+)
+
+func GetSafetyWarningStorage() *SafetyWarningStorage {
+	safetyWarningOnce.Do(func() {
+		safetyWarningInstance = &SafetyWarningStorage{
+			db: config.DB,
+		}
+	})
+	return safetyWarningInstance
+}
+
+// Create 保存警告
+func (s *SafetyWarningStorage) Create(warnings []models.SuggestionSafetyWarning) error {
+	if len(warnings) == 0 {
+		return nil
+	}
+	return s.db.Create(&warnings).Error
+}
+
+// GetByID 获取警告，不存在时返回 nil
+func (s *SafetyWarningStorage) GetByID(id string) (*models.SuggestionSafetyWarning, error) {
+	var warning models.SuggestionSafetyWarning
+	err := s.db.First(&warning, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &warning, nil
+}
+
+// Save 更新警告
+func (s *SafetyWarningStorage) Save(warning *models.SuggestionSafetyWarning) error {
+	return s.db.Save(warning).Error
+}
+
+// ListDrafts 获取医生自己撰写、尚未发送的消息产生的警告
+func (s *SafetyWarningStorage) ListDrafts(patientID string) ([]models.SuggestionSafetyWarning, error) {
+	var warnings []models.SuggestionSafetyWarning
+	err := s.db.Where("patient_id = ? AND suggestion_id = '' AND message_id = ''", patientID).
+		Order("created_at asc").Find(&warnings).Error
+	return warnings, err
+}
+
+// AttachDrafts 消息发送后，将患者待发送消息的警告关联到该消息，之后的消息重新确认
+func (s *SafetyWarningStorage) AttachDrafts(patientID string, messageID string) error {
+	return s.db.Model(&models.SuggestionSafetyWarning{}).
+		Where("patient_id = ? AND suggestion_id = '' AND message_id = ''", patientID).
+		Update("message_id", messageID).Error
+}
@@ -0,0 +1,103 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"time"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+)
+
+type TriageStorage struct {
+	db *gorm.DB
+}
+
+var (
+	triageInstance *TriageStorage
+	triageOnce     sync.Once
+)
+
+func GetTriageStorage() *TriageStorage {
+	triageOnce.Do(func() {
+		triageInstance = &TriageStorage{
+			db: config.DB,
+		}
+	})
+	return triageInstance
+}
+
+// CreateDecision 保存一条分诊记录
+func (s *TriageStorage) CreateDecision(decision *models.TriageDecision) error {
+	return s.db.Create(decision).Error
+}
+
+// GetDecisionsByMessageID 获取消息的全部分诊记录
+func (s *TriageStorage) GetDecisionsByMessageID(messageID string) ([]models.TriageDecision, error) {
+	var decisions []models.TriageDecision
+	err := s.db.Where("message_id = ?", messageID).Order("created_at asc").Find(&decisions).Error
+	return decisions, err
+}
+
+// UpdateMessageUrgency 更新消息的紧急程度
+func (s *TriageStorage) UpdateMessageUrgency(messageID string, urgency string) error {
+	return s.db.Model(&models.Message{}).Where("id = ?", messageID).Update("urgency", urgency).Error
+}
+
+// GetOpenEscalationByMessageID 获取消息未处理完的升级事件，没有时返回 nil
+func (s *TriageStorage) GetOpenEscalationByMessageID(messageID string) (*models.Escalation, error) {
+	var escalation models.Escalation
+	err := s.db.Where("message_id = ? AND status <> ?", messageID, models.EscalationStatusResolved).
+		First(&escalation).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &escalation, nil
+}
+
+// GetEscalationByID 获取升级事件
+func (s *TriageStorage) GetEscalationByID(id string) (*models.Escalation, error) {
+	var escalation models.Escalation
+	err := s.db.First(&escalation, "id = ?", id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("escalation not found")
+		}
+		return nil, err
+	}
+	return &escalation, nil
+}
+
+// CreateEscalation 创建升级事件
+func (s *TriageStorage) CreateEscalation(escalation *models.Escalation) error {
+	return s.db.Create(escalation).Error
+}
+
+// SaveEscalation 保存升级事件
+func (s *TriageStorage) SaveEscalation(escalation *models.Escalation) error {
+	escalation.UpdatedAt = time.Now()
+	return s.db.Save(escalation).Error
+}
+
+// ListEscalations 查询升级事件，doctorID 为空时查询全部医生，status 为空时查询未处理完的事件
+func (s *TriageStorage) ListEscalations(doctorID string, patientID string, status string) ([]models.Escalation, error) {
+	var escalations []models.Escalation
+	query := s.db.Model(&models.Escalation{})
+	if doctorID != "" {
+		query = query.Where("doctor_id = ?", doctorID)
+	}
+	if patientID != "" {
+		query = query.Where("patient_id = ?", patientID)
+	}
+	if status != "" {
+		query = query.Where("status = ?", status)
+	} else {
+		query = query.Where("status <> ?", models.EscalationStatusResolved)
+	}
+	err := query.Order("created_at desc").Find(&escalations).Error
+	return escalations, err
+}
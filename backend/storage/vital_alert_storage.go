@@ -0,0 +1,136 @@
+package storage
+
+import (
+	"errors"
+	"sync"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+)
+
+type VitalAlertStorage struct {
+	db *gorm.DB
+}
+
+var (
+	vitalAlertInstance *VitalAlertStorage
+	vitalAlertOnce     sync.Once
+)
+
+func GetVitalAlertStorage() *VitalAlertStorage {
+	vitalAlertOnce.Do(func() {
+		vitalAlertInstance = &VitalAlertStorage{
+			db: config.DB,
+		}
+	})
+	return vitalAlertInstance
+}
+
+// ListTargets 获取患者设置的全部目标范围
+func (s *VitalAlertStorage) ListTargets(patientID string) ([]models.VitalTarget, error) {
+	var targets []models.VitalTarget
+	err := s.db.Where("patient_id = ?", patientID).Order("type, context, field").Find(&targets).Error
+	return targets, err
+}
+
+// GetTarget 获取患者某项指标的目标范围，未设置时返回 nil
+func (s *VitalAlertStorage) GetTarget(patientID string, dataType string, context string, field string) (*models.VitalTarget, error) {
+	var target models.VitalTarget
+	err := s.db.Where("patient_id = ? AND type = ? AND context = ? AND field = ?", patientID, dataType, context, field).
+		First(&target).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &target, nil
+}
+
+// SaveTarget 保存目标范围
+func (s *VitalAlertStorage) SaveTarget(target *models.VitalTarget) error {
+	return s.db.Save(target).Error
+}
+
+// DeleteTarget 删除患者的目标范围，恢复使用默认范围
+func (s *VitalAlertStorage) DeleteTarget(patientID string, id string) error {
+	result := s.db.Unscoped().Delete(&models.VitalTarget{}, "id = ? AND patient_id = ?", id, patientID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errors.New("target not found")
+	}
+	return nil
+}
+
+// CreateAlerts 保存提醒
+func (s *VitalAlertStorage) CreateAlerts(alerts []models.VitalAlert) error {
+	if len(alerts) == 0 {
+		return nil
+	}
+	return s.db.Create(&alerts).Error
+}
+
+// ListAlerts 获取提醒，doctorID 不为空时只返回该医生的提醒；status 为空时返回未处理的提醒
+func (s *VitalAlertStorage) ListAlerts(doctorID string, patientID string, status string, severity string) ([]models.VitalAlert, error) {
+	var alerts []models.VitalAlert
+	query := s.db.Model(&models.VitalAlert{})
+	if doctorID != "" {
+		query = query.Where("doctor_id = ?", doctorID)
+	}
+	if patientID != "" {
+		query = query.Where("patient_id = ?", patientID)
+	}
+	if status == "" {
+		status = models.VitalAlertStatusOpen
+	}
+	query = query.Where("status = ?", status)
+	if severity != "" {
+		query = query.Where("severity = ?", severity)
+	}
+	err := query.Order("measured_at desc").Find(&alerts).Error
+	return alerts, err
+}
+
+// GetAlertByID 获取提醒
+func (s *VitalAlertStorage) GetAlertByID(id string) (*models.VitalAlert, error) {
+	var alert models.VitalAlert
+	if err := s.db.First(&alert, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// SaveAlert 保存提醒
+func (s *VitalAlertStorage) SaveAlert(alert *models.VitalAlert) error {
+	return s.db.Save(alert).Error
+}
+
+// DismissAlertsForData 作废某条生理数据未处理的提醒
+func (s *VitalAlertStorage) DismissAlertsForData(dataID string) error {
+	return s.db.Model(&models.VitalAlert{}).
+		Where("data_id = ? AND status = ?", dataID, models.VitalAlertStatusOpen).
+		Update("status", models.VitalAlertStatusDismissed).Error
+}
+
+// OpenAlertCounts 统计患者未处理的提醒数量，按严重程度分组
+func (s *VitalAlertStorage) OpenAlertCounts(patientID string) (map[string]int, error) {
+	var rows []struct {
+		Severity string
+		Count    int
+	}
+	err := s.db.Model(&models.VitalAlert{}).
+		Select("severity, COUNT(*) AS count").
+		Where("patient_id = ? AND status = ?", patientID, models.VitalAlertStatusOpen).
+		Group("severity").Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+	counts := map[string]int{}
+	for _, row := range rows {
+		counts[row.Severity] = row.Count
+	}
+	return counts, nil
+}
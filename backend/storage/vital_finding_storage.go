@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"sync"
+	"we-dear/config"
+	"we-dear/models"
+
+	"gorm.io/gorm"
+)
+
+type VitalFindingStorage struct {
+	db *gorm.DB
+}
+
+var (
+	vitalFindingInstance *VitalFindingStorage
+	vitalFindingOnce     sync.Once
+)
+
+func GetVitalFindingStorage() *VitalFindingStorage {
+	vitalFindingOnce.Do(func() {
+		vitalFindingInstance = &VitalFindingStorage{
+			db: config.DB,
+		}
+	})
+	return vitalFindingInstance
+}
+
+// ListActive 获取患者尚未关闭（待处理或已确认）的趋势异常
+func (s *VitalFindingStorage) ListActive(patientID string) ([]models.VitalFinding, error) {
+	var findings []models.VitalFinding
+	err := s.db.Where("patient_id = ? AND status IN ?", patientID,
+		[]string{models.VitalFindingStatusOpen, models.VitalFindingStatusAcknowledged}).
+		Order("created_at asc").Find(&findings).Error
+	return findings, err
+}
+
+// List 获取趋势异常，doctorID 不为空时只返回该医生的记录；status 为空时返回待处理的记录
+func (s *VitalFindingStorage) List(doctorID string, patientID string, status string, kind string) ([]models.VitalFinding, error) {
+	var findings []models.VitalFinding
+	query := s.db.Model(&models.VitalFinding{})
+	if doctorID != "" {
+		query = query.Where("doctor_id = ?", doctorID)
+	}
+	if patientID != "" {
+		query = query.Where("patient_id = ?", patientID)
+	}
+	if status == "" {
+		status = models.VitalFindingStatusOpen
+	}
+	query = query.Where("status = ?", status)
+	if kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+	err := query.Order("updated_at desc").Find(&findings).Error
+	return findings, err
+}
+
+// GetByID 获取趋势异常
+func (s *VitalFindingStorage) GetByID(id string) (*models.VitalFinding, error) {
+	var finding models.VitalFinding
+	if err := s.db.First(&finding, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &finding, nil
+}
+
+// WithPatientLock 持有患者级的 advisory lock 执行 fn，同一患者的检测（包括多个实例）依次进行，
+// 避免手动检测和后台检测同时读到没有记录而重复创建同一异常。锁在事务结束时释放，fn 中的读写不在该事务内
+func (s *VitalFindingStorage) WithPatientLock(patientID string, fn func() error) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", "vital_finding:"+patientID).Error; err != nil {
+			return err
+		}
+		return fn()
+	})
+}
+
+// Create 保存新的趋势异常
+func (s *VitalFindingStorage) Create(finding *models.VitalFinding) error {
+	return s.db.Create(finding).Error
+}
+
+// Save 更新趋势异常
+func (s *VitalFindingStorage) Save(finding *models.VitalFinding) error {
+	return s.db.Save(finding).Error
+}
+
+// PatientsWithActive 获取有未关闭趋势异常的患者ID
+func (s *VitalFindingStorage) PatientsWithActive() ([]string, error) {
+	var patientIDs []string
+	err := s.db.Model(&models.VitalFinding{}).
+		Where("status IN ?", []string{models.VitalFindingStatusOpen, models.VitalFindingStatusAcknowledged}).
+		Distinct().Pluck("patient_id", &patientIDs).Error
+	return patientIDs, err
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"we-dear/config"
+	"we-dear/services"
+	"we-dear/storage"
+)
+
+// 导入诊疗规范文档，用于AI建议的规范检索
+// 用法: go run tools/ingest_guidelines.go -dir guidelines
+//
+//	go run tools/ingest_guidelines.go 高血压防治指南.md 糖尿病指南.pdf
+func main() {
+	dir := flag.String("dir", "guidelines", "规范文档目录（未指定文件时导入目录下的 .md/.txt/.pdf 文件）")
+	flag.Parse()
+
+	// 初始化配置和数据库连接
+	config.Init()
+	config.InitDB()
+
+	embedder, err := services.NewEmbedder(config.GlobalConfig.AI)
+	if err != nil {
+		log.Fatalf("初始化嵌入器失败: %v", err)
+	}
+
+	if err := storage.GetGuidelineStorage().EnableVector(); err != nil {
+		log.Printf("未启用 pgvector，检索时在内存中计算相似度: %v", err)
+	}
+
+	paths := flag.Args()
+	if len(paths) == 0 {
+		entries, err := os.ReadDir(*dir)
+		if err != nil {
+			log.Fatalf("读取目录失败: %v", err)
+		}
+		for _, entry := range entries {
+			ext := strings.ToLower(filepath.Ext(entry.Name()))
+			if entry.IsDir() || (ext != ".md" && ext != ".markdown" && ext != ".txt" && ext != ".pdf") {
+				continue
+			}
+			paths = append(paths, filepath.Join(*dir, entry.Name()))
+		}
+	}
+
+	failed := 0
+	for _, path := range paths {
+		updated, document, err := services.IngestGuideline(context.Background(), embedder, path)
+		if err != nil {
+			log.Printf("导入 %s 失败: %v", path, err)
+			failed++
+			continue
+		}
+		if !updated {
+			log.Printf("%s 未变化，跳过", path)
+			continue
+		}
+		log.Printf("已导入 %s：%d 个片段（%s）", document.Title, document.ChunkCount, embedder.Name())
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d 个文档导入失败", failed)
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"log"
+	"we-dear/config"
+	"we-dear/services"
+)
+
+// 将旧格式的生理数据值解析为数值分量，升级后执行一次；重复执行只处理新出现的未解析记录
+// 用法: go run tools/migrate_vital_components.go
+func main() {
+	// 初始化配置和数据库连接
+	config.Init()
+	config.InitDB()
+
+	migrated, failed, err := services.MigratePhysiologicalComponents()
+	if err != nil {
+		log.Fatalf("迁移生理数据失败: %v", err)
+	}
+	log.Printf("生理数据迁移完成: 解析 %d 条，无法解析 %d 条（原因记录在 components_error 中，不再重试）", migrated, failed)
+}
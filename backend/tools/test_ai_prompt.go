@@ -6,25 +6,28 @@ import (
 	"log"
 	"time"
 	"we-dear/config"
-
-	deepseek "github.com/cohesion-org/deepseek-go"
+	"we-dear/services"
 )
 
+// 使用 AI_PROVIDER 配置的供应商测试提示词，AI_PROVIDER=mock 时无需网络和密钥
 func main() {
 	// 初始化配置
 	config.Init()
 
-	// 初始化 Deepseek 客户端
-	client := deepseek.NewClient(config.GlobalConfig.AI.DeepseekKey)
+	// 初始化供应商
+	provider, err := services.NewChatProvider(config.GlobalConfig.AI)
+	if err != nil {
+		log.Fatalf("初始化AI提供商失败: %v", err)
+	}
 
 	// 构建测试消息
-	messages := []deepseek.ChatCompletionMessage{
+	messages := []services.ChatMessage{
 		{
-			Role:    "system",
+			Role:    services.ChatRoleSystem,
 			Content: "你是一位专业的医生，请用专业且易懂的语言回答病人的问题。",
 		},
 		{
-			Role:    "user",
+			Role:    services.ChatRoleUser,
 			Content: "我最近血压一直在波动，早上测了收缩压160，舒张压95，我现在在服用络活喜，需要调整用药吗？",
 		},
 	}
@@ -33,21 +36,18 @@ func main() {
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	resp, err := client.CreateChatCompletion(
-		ctx,
-		&deepseek.ChatCompletionRequest{
-			Model:    deepseek.DeepSeekChat,
-			Messages: messages,
-		},
-	)
-
+	resp, err := provider.CreateChatCompletion(ctx, services.ChatRequest{
+		Messages:    messages,
+		Temperature: config.GlobalConfig.AI.Temperature,
+		MaxTokens:   config.GlobalConfig.AI.MaxTokens,
+	})
 	if err != nil {
-		log.Fatalf("Deepseek API 调用失败: %v", err)
+		log.Fatalf("%s API 调用失败: %v", provider.Name(), err)
 	}
 
 	// 打印响应
-	fmt.Printf("\n=== Deepseek 测试结果 ===\n")
+	fmt.Printf("\n=== %s 测试结果 ===\n", provider.Name())
 	fmt.Printf("问题: %s\n", messages[1].Content)
-	fmt.Printf("\n回复:\n%s\n", resp.Choices[0].Message.Content)
+	fmt.Printf("\n回复:\n%s\n", resp.Content)
 	fmt.Printf("===========================\n")
 }
@@ -0,0 +1,45 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+// GenerateDeviceKey 生成设备凭据（API Key 或 HMAC 密钥）
+func GenerateDeviceKey() (string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return "wdk_" + base64.RawURLEncoding.EncodeToString(bytes), nil
+}
+
+// HashDeviceKey 计算 API Key 的哈希，数据库只保存哈希
+func HashDeviceKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// VerifyDeviceKey 校验 API Key 与保存的哈希是否一致
+func VerifyDeviceKey(key string, hash string) bool {
+	return key != "" && subtle.ConstantTimeCompare([]byte(HashDeviceKey(key)), []byte(hash)) == 1
+}
+
+// SignDeviceRequest 计算设备请求签名：HMAC-SHA256(secret, timestamp + "\n" + body) 的十六进制
+func SignDeviceRequest(secret string, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyDeviceSignature 校验设备请求签名
+func VerifyDeviceSignature(secret string, timestamp string, body []byte, signature string) bool {
+	expected := SignDeviceRequest(secret, timestamp, body)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
@@ -0,0 +1,26 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDeviceCredentials(t *testing.T) {
+	key, err := GenerateDeviceKey()
+	if err != nil || !strings.HasPrefix(key, "wdk_") {
+		t.Fatalf("unexpected key %q: %v", key, err)
+	}
+	hash := HashDeviceKey(key)
+	if !VerifyDeviceKey(key, hash) || VerifyDeviceKey(key+"x", hash) || VerifyDeviceKey("", HashDeviceKey("")) {
+		t.Error("api key verification mismatch")
+	}
+
+	body := []byte(`{"readings":[]}`)
+	signature := SignDeviceRequest(key, "1760774400", body)
+	if !VerifyDeviceSignature(key, "1760774400", body, signature) {
+		t.Error("expected signature to verify")
+	}
+	if VerifyDeviceSignature(key, "1760774401", body, signature) || VerifyDeviceSignature(key, "1760774400", []byte(`{}`), signature) {
+		t.Error("signature should cover timestamp and body")
+	}
+}